@@ -1,7 +1,21 @@
 package main
 
-import "github.com/jmsilvadev/de-crypto/internal"
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/jmsilvadev/de-crypto/internal"
+)
 
 func main() {
+	// without arguments we run the service, the others are admin commands
+	if len(os.Args) > 1 && os.Args[1] == "dlq" {
+		if err := internal.DLQCommand(context.Background(), os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	internal.Start()
 }
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/dlq"
+	"github.com/jmsilvadev/de-crypto/pkg/sink"
+)
+
+var errUsage = errors.New("usage: de-crypto dlq <list [-n N] | replay | purge>")
+
+// DLQCommand inspects, replays or purges the dead letter queue. The service redelivers by
+// itself, this is for when we want to do it by hand, with the service stopped.
+func DLQCommand(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	q, err := dlq.Open(config.GetDLQDir(), config.DefaultDLQSegmentSize)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("list", flag.ContinueOnError)
+		fs.SetOutput(out)
+		limit := fs.Int("n", 20, "how many messages to show, 0 shows all")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		records, err := q.Pending(*limit)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%d messages pending\n", q.Len())
+		for _, r := range records {
+			fmt.Fprintf(out, "%d\t%s\t%s\t%s\t%s\n", r.ID, r.FailedAt.Format("2006-01-02T15:04:05Z"), r.Key, r.Error, r.Message)
+		}
+		return nil
+
+	case "replay":
+		s, err := newSink(ctx)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+
+		n, err := q.Replay(func(r dlq.Record) error { return sink.Publish(ctx, s, fromDeadLetter(r)) })
+		fmt.Fprintf(out, "%d messages replayed, %d pending\n", n, q.Len())
+		return err
+
+	case "purge":
+		n, err := q.Purge()
+		fmt.Fprintf(out, "%d messages purged\n", n)
+		return err
+	}
+	return errUsage
+}
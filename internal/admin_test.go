@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/dlq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDLQCommand(t *testing.T) {
+	dir := t.TempDir()
+	os.Setenv("DLQ_DIR", dir)
+	defer os.Unsetenv("DLQ_DIR")
+
+	q, err := dlq.Open(dir, config.DefaultDLQSegmentSize)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Append(dlq.Record{Key: []byte("user1"), Message: []byte(`{"txHash":"0xabc"}`), Error: "broker down"}))
+	assert.NoError(t, q.Append(dlq.Record{Key: []byte("user2"), Message: []byte(`{"txHash":"0xdef"}`), Error: "broker down"}))
+	assert.NoError(t, q.Close())
+
+	ctx := context.Background()
+
+	t.Run("dlq_command_without_args", func(t *testing.T) {
+		assert.ErrorIs(t, DLQCommand(ctx, nil, &bytes.Buffer{}), errUsage)
+		assert.ErrorIs(t, DLQCommand(ctx, []string{"unknown"}, &bytes.Buffer{}), errUsage)
+	})
+
+	t.Run("dlq_command_list", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, DLQCommand(ctx, []string{"list", "-n", "1"}, &out))
+		assert.Contains(t, out.String(), "2 messages pending")
+		assert.Contains(t, out.String(), "0xabc")
+		assert.NotContains(t, out.String(), "0xdef")
+	})
+
+	t.Run("dlq_command_purge", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, DLQCommand(ctx, []string{"purge"}, &out))
+		assert.Contains(t, out.String(), "2 messages purged")
+
+		out.Reset()
+		assert.NoError(t, DLQCommand(ctx, []string{"list"}, &out))
+		assert.Contains(t, out.String(), "0 messages pending")
+	})
+}
@@ -3,80 +3,242 @@ package internal
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"math"
 	"math/rand/v2"
+	"net"
 	"time"
 
+	"github.com/jmsilvadev/de-crypto/pkg/address"
 	"github.com/jmsilvadev/de-crypto/pkg/config"
 	"github.com/jmsilvadev/de-crypto/pkg/jsonrpc"
 	"github.com/jmsilvadev/de-crypto/pkg/utils"
 )
 
-func blockFetcher(ctx context.Context, cfg config.BlockFetcherConfig, rpc jsonrpc.JsonRpcClient, headCh <-chan uint64, out chan<- jsonrpc.Block) {
+var errUnexpectedBlock = errors.New("unexpected block number")
+
+func blockFetcher(ctx context.Context, cfg config.BlockFetcherConfig, rpc jsonrpc.JsonRpcClient, addrIdx address.AddressIndex, headCh <-chan uint64, out chan<- jsonrpc.Block) {
+	retries := newRetryQueue(cfg)
+	retryCh := make(chan uint64, cfg.Workers)
+	go retries.run(ctx, retryCh)
+
 	for i := 0; i < cfg.Workers; i++ {
-		go worker(ctx, rpc, cfg, headCh, out)
+		go worker(ctx, rpc, cfg, addrIdx, headCh, retryCh, retries, out)
 	}
 	<-ctx.Done()
 }
 
-func worker(ctx context.Context, rpc jsonrpc.JsonRpcClient, cfg config.BlockFetcherConfig, headCh <-chan uint64, out chan<- jsonrpc.Block) {
+func worker(ctx context.Context, rpc jsonrpc.JsonRpcClient, cfg config.BlockFetcherConfig, addrIdx address.AddressIndex, headCh <-chan uint64, retryCh <-chan uint64, retries *retryQueue, out chan<- jsonrpc.Block) {
 	log.Println("Starting block fetcher worker")
 	for {
+		// while the provider is down we don't take heights, they stay queued
+		if !waitReady(ctx, rpc) {
+			return
+		}
+
+		var h uint64
 		select {
 		case <-ctx.Done():
 			return
-		case h, ok := <-headCh:
+		case h = <-retryCh:
+		case n, ok := <-headCh:
 			if !ok {
 				return
 			}
-			blk, err := fetchWithRetry(ctx, rpc, cfg, h)
-			if err != nil {
+			h = n
+			// when we are far behind the head the channel is full, so we get the blocks
+			// in batches to save round trips
+			if cfg.BatchSize > 1 && len(headCh) >= cfg.BatchThreshold {
+				if !fetchBatch(ctx, rpc, cfg, addrIdx, takeHeights(headCh, h, cfg.BatchSize), retries, out) {
+					return
+				}
 				continue
 			}
-			select {
-			case <-ctx.Done():
-				return
-			case out <- *blk:
+		}
+
+		if !fetchOne(ctx, rpc, cfg, addrIdx, h, retries, out) {
+			return
+		}
+	}
+}
+
+// readyWaiter is a client that knows when it is not worth sending requests, like the circuit breaker
+type readyWaiter interface {
+	WaitReady(ctx context.Context) error
+}
+
+// waitReady pauses while the client is not taking requests, it returns false only when the context is done
+func waitReady(ctx context.Context, rpc jsonrpc.JsonRpcClient) bool {
+	if w, ok := rpc.(readyWaiter); ok {
+		return w.WaitReady(ctx) == nil
+	}
+	return ctx.Err() == nil
+}
+
+// takeHeights gets the heights already waiting in the channel without blocking
+func takeHeights(headCh <-chan uint64, first uint64, max int) []uint64 {
+	heights := []uint64{first}
+	for len(heights) < max {
+		select {
+		case n, ok := <-headCh:
+			if !ok {
+				return heights
 			}
+			heights = append(heights, n)
+		default:
+			return heights
 		}
 	}
+	return heights
 }
 
-func fetchWithRetry(ctx context.Context, rpc jsonrpc.JsonRpcClient, cfg config.BlockFetcherConfig, blockNumber uint64) (*jsonrpc.Block, error) {
-	attempt := 0
+// fetchBatch gets the blocks in one request, the heights that fail in the batch are fetched
+// one by one so they get the same retries as the others. It returns false only when the context is done.
+func fetchBatch(ctx context.Context, rpc jsonrpc.JsonRpcClient, cfg config.BlockFetcherConfig, addrIdx address.AddressIndex, heights []uint64, retries *retryQueue, out chan<- jsonrpc.Block) bool {
+	reqCtx, cancel := context.WithTimeout(ctx, cfg.ReqTimeout)
+	blocks, errs, err := rpc.GetBlocksByNumber(reqCtx, heights)
+	cancel()
+	if err != nil && ctx.Err() == nil {
+		log.Printf("fetching batch of %d blocks: %v", len(heights), err)
+	}
+
+	for i, h := range heights {
+		if err == nil && errs[i] == nil && prepareBlock(ctx, rpc, cfg, addrIdx, h, blocks[i]) == nil {
+			retries.done(h)
+			if !sendBlock(ctx, out, *blocks[i]) {
+				return false
+			}
+			continue
+		}
+		if !fetchOne(ctx, rpc, cfg, addrIdx, h, retries, out) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchOne fetches the block and sends it. It returns false only when the context is done.
+func fetchOne(ctx context.Context, rpc jsonrpc.JsonRpcClient, cfg config.BlockFetcherConfig, addrIdx address.AddressIndex, h uint64, retries *retryQueue, out chan<- jsonrpc.Block) bool {
+	blk, err := fetchWithRetry(ctx, rpc, cfg, addrIdx, h)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		// never drop the height, the checkpoint can't move over it until we get it
+		retries.push(h, err)
+		return true
+	}
+	retries.done(h)
+
+	return sendBlock(ctx, out, *blk)
+}
+
+func sendBlock(ctx context.Context, out chan<- jsonrpc.Block, b jsonrpc.Block) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case out <- b:
+		return true
+	}
+}
+
+func fetchWithRetry(ctx context.Context, rpc jsonrpc.JsonRpcClient, cfg config.BlockFetcherConfig, addrIdx address.AddressIndex, blockNumber uint64) (*jsonrpc.Block, error) {
+	attempt, waits := 0, 0
 	for {
 		reqCtx, cancel := context.WithTimeout(ctx, cfg.ReqTimeout)
 		blk, err := rpc.GetBlockByNumber(reqCtx, blockNumber)
 		cancel()
 
-		if err != nil {
-			return nil, err
-		}
-
 		if errors.Is(ctx.Err(), context.Canceled) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			return nil, ctx.Err()
 		}
 
-		blkNumber, err := utils.ParseHexUint64(blk.Number)
-		if err != nil {
-			return nil, err
+		if err == nil {
+			err = prepareBlock(ctx, rpc, cfg, addrIdx, blockNumber, blk)
+			if err == nil {
+				return blk, nil
+			}
 		}
 
-		if blk != nil && blkNumber == blockNumber {
-			return blk, nil
+		// the node doesn't have the block yet, so we just wait for it without spending the attempts
+		if errors.Is(err, jsonrpc.ErrBlockNotFound) {
+			waits++
+			delay := backoffWithJitter(cfg, waits-1)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
+		}
+
+		// the circuit is open, the provider is down so we wait for it without spending the attempts
+		if errors.Is(err, jsonrpc.ErrCircuitOpen) {
+			if !waitReady(ctx, rpc) {
+				return nil, ctx.Err()
+			}
+			continue
 		}
 
-		delay := backoffWithJitter(cfg, attempt)
+		// fatal errors go straight to the retry queue, no reason to hammer the provider here
+		attempt++
+		if !isRetryable(err) || attempt >= cfg.MaxAttempts {
+			return nil, err
+		}
+
+		delay := backoffWithJitter(cfg, attempt-1)
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
 		case <-time.After(delay):
 		}
-		attempt++
 	}
 }
 
+// prepareBlock checks we got the block we asked for and fetches the data that is not in it
+func prepareBlock(ctx context.Context, rpc jsonrpc.JsonRpcClient, cfg config.BlockFetcherConfig, addrIdx address.AddressIndex, blockNumber uint64, blk *jsonrpc.Block) error {
+	if err := checkBlockNumber(blk, blockNumber); err != nil {
+		return err
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, cfg.ReqTimeout)
+	defer cancel()
+	return enrichBlock(reqCtx, cfg.Enrich, rpc, addrIdx, blk)
+}
+
+// checkBlockNumber makes sure the provider sent the height we asked for, a lagging or
+// misbehaving one can answer with another block
+func checkBlockNumber(blk *jsonrpc.Block, blockNumber uint64) error {
+	blkNumber, err := utils.ParseHexUint64(blk.Number)
+	if err != nil {
+		return err
+	}
+	if blkNumber != blockNumber {
+		return fmt.Errorf("%w: got %d instead of %d", errUnexpectedBlock, blkNumber, blockNumber)
+	}
+	return nil
+}
+
+// isRetryable says if the error is transient and worth retrying right away
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, jsonrpc.ErrBlockNotFound) ||
+		errors.Is(err, jsonrpc.ErrRateLimited) ||
+		errors.Is(err, jsonrpc.ErrServer) ||
+		errors.Is(err, errUnexpectedBlock)
+}
+
 func backoffWithJitter(cfg config.BlockFetcherConfig, attempt int) time.Duration {
 	exp := float64(cfg.RetryBaseDelay) * math.Pow(2, float64(attempt)) // veru basic backoff
 	base := time.Duration(exp)
@@ -3,6 +3,8 @@ package internal
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"testing"
 	"time"
 
@@ -29,7 +31,7 @@ func TestBlockFetcher(t *testing.T) {
 			Jitter:         0.1,
 		}
 
-		go blockFetcher(ctx, cfg, rpcClient, headCh, outCh)
+		go blockFetcher(ctx, cfg, rpcClient, newMockAddressIndex(), headCh, outCh)
 
 		headCh <- 12345
 
@@ -53,7 +55,7 @@ func TestBlockFetcher(t *testing.T) {
 			Jitter:         0.1,
 		}
 
-		go worker(ctx, rpcClient, cfg, headCh, outCh)
+		go worker(ctx, rpcClient, cfg, newMockAddressIndex(), headCh, nil, newRetryQueue(cfg), outCh)
 
 		headCh <- 12345
 
@@ -77,7 +79,7 @@ func TestBlockFetcher(t *testing.T) {
 			Jitter:         0.1,
 		}
 
-		go worker(ctx, rpcClient, cfg, headCh, outCh)
+		go worker(ctx, rpcClient, cfg, newMockAddressIndex(), headCh, nil, newRetryQueue(cfg), outCh)
 
 		headCh <- 12345
 
@@ -85,6 +87,122 @@ func TestBlockFetcher(t *testing.T) {
 	})
 }
 
+func TestWorker_RetryQueue(t *testing.T) {
+	t.Run("worker_requeues_failed_height", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		headCh := make(chan uint64, 1)
+		retryCh := make(chan uint64, 1)
+		outCh := make(chan jsonrpc.Block, 1)
+		cfg := testRetryConfig()
+		retries := newRetryQueue(cfg)
+		rpc := &mockRpcClient{blocks: map[uint64]jsonrpc.Block{}}
+
+		go retries.run(ctx, retryCh)
+		go worker(ctx, rpc, cfg, newMockAddressIndex(), headCh, retryCh, retries, outCh)
+
+		headCh <- 100
+		time.Sleep(20 * time.Millisecond)
+
+		rpc.mu.Lock()
+		rpc.blocks[100] = testBlock(100, "0xa", "0x9")
+		rpc.mu.Unlock()
+
+		select {
+		case b := <-outCh:
+			assert.Equal(t, "0xa", b.Hash)
+		case <-time.After(time.Second):
+			t.Fatal("expected the failed height to be fetched again")
+		}
+		assert.Empty(t, retries.due(time.Now().Add(time.Hour)))
+	})
+}
+
+func TestFetchBatch(t *testing.T) {
+	t.Run("worker_fetches_in_batches_when_behind", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		headCh := make(chan uint64, 10)
+		outCh := make(chan jsonrpc.Block, 10)
+		cfg := testRetryConfig()
+		cfg.BatchSize = 4
+		cfg.BatchThreshold = 2
+		rpc := &mockRpcClient{blocks: map[uint64]jsonrpc.Block{}}
+		for n := uint64(100); n < 104; n++ {
+			rpc.blocks[n] = testBlock(n, fmt.Sprintf("0x%x", n), fmt.Sprintf("0x%x", n-1))
+			headCh <- n
+		}
+
+		go worker(ctx, rpc, cfg, newMockAddressIndex(), headCh, nil, newRetryQueue(cfg), outCh)
+
+		for i := 0; i < 4; i++ {
+			select {
+			case <-outCh:
+			case <-time.After(time.Second):
+				t.Fatal("expected the blocks of the batch")
+			}
+		}
+		rpc.mu.Lock()
+		defer rpc.mu.Unlock()
+		assert.Equal(t, 1, rpc.batches)
+	})
+
+	t.Run("fetch_batch_failed_elements_are_fetched_again", func(t *testing.T) {
+		ctx := context.Background()
+		outCh := make(chan jsonrpc.Block, 10)
+		cfg := testRetryConfig()
+		retries := newRetryQueue(cfg)
+		// 101 is not in the node, 102 is another block
+		rpc := &mockRpcClient{blocks: map[uint64]jsonrpc.Block{
+			100: testBlock(100, "0xa", "0x9"),
+			102: testBlock(99, "0xc", "0xb"),
+		}}
+
+		ok := fetchBatch(ctx, rpc, cfg, newMockAddressIndex(), []uint64{100, 101, 102}, retries, outCh)
+
+		assert.True(t, ok)
+		assert.Len(t, outCh, 1)
+		assert.Equal(t, "0xa", (<-outCh).Hash)
+		// the batch and one single call for each failed height
+		assert.Equal(t, 1, rpc.batches)
+		assert.Equal(t, 5, rpc.calls)
+		assert.Len(t, retries.due(time.Now().Add(time.Hour)), 2)
+	})
+
+	t.Run("fetch_batch_request_error", func(t *testing.T) {
+		ctx := context.Background()
+		outCh := make(chan jsonrpc.Block, 10)
+		cfg := testRetryConfig()
+		retries := newRetryQueue(cfg)
+		rpc := &mockRpcClient{err: assert.AnError}
+
+		ok := fetchBatch(ctx, rpc, cfg, newMockAddressIndex(), []uint64{100, 101}, retries, outCh)
+
+		assert.True(t, ok)
+		assert.Empty(t, outCh)
+		assert.Len(t, retries.due(time.Now().Add(time.Hour)), 2)
+	})
+}
+
+func TestTakeHeights(t *testing.T) {
+	t.Run("take_heights_up_to_max", func(t *testing.T) {
+		headCh := make(chan uint64, 10)
+		for n := uint64(101); n < 106; n++ {
+			headCh <- n
+		}
+		assert.Equal(t, []uint64{100, 101, 102}, takeHeights(headCh, 100, 3))
+		assert.Len(t, headCh, 3)
+	})
+
+	t.Run("take_heights_does_not_block", func(t *testing.T) {
+		headCh := make(chan uint64, 10)
+		headCh <- 101
+		assert.Equal(t, []uint64{100, 101}, takeHeights(headCh, 100, 5))
+	})
+}
+
 func TestFetchWithRetry(t *testing.T) {
 	t.Run("fetch_with_retry_success_on_first_attempt", func(t *testing.T) {
 		ctx := context.Background()
@@ -98,7 +216,7 @@ func TestFetchWithRetry(t *testing.T) {
 			Jitter:         0.1,
 		}
 
-		_, err := fetchWithRetry(ctx, rpcClient, cfg, 12345)
+		_, err := fetchWithRetry(ctx, rpcClient, cfg, newMockAddressIndex(), 12345)
 
 		if err != nil {
 			t.Logf("Expected error in test environment: %v", err)
@@ -119,7 +237,7 @@ func TestFetchWithRetry(t *testing.T) {
 
 		cancel()
 
-		block, err := fetchWithRetry(ctx, rpcClient, cfg, 12345)
+		block, err := fetchWithRetry(ctx, rpcClient, cfg, newMockAddressIndex(), 12345)
 
 		assert.Error(t, err)
 		assert.Nil(t, block)
@@ -127,6 +245,62 @@ func TestFetchWithRetry(t *testing.T) {
 	})
 }
 
+func TestFetchWithRetry_Attempts(t *testing.T) {
+	t.Run("fetch_with_retry_retries_unexpected_block", func(t *testing.T) {
+		rpc := &mockRpcClient{blocks: map[uint64]jsonrpc.Block{100: testBlock(99, "0xa", "0x9")}}
+		cfg := testRetryConfig()
+		cfg.MaxAttempts = 3
+
+		_, err := fetchWithRetry(context.Background(), rpc, cfg, newMockAddressIndex(), 100)
+		assert.ErrorIs(t, err, errUnexpectedBlock)
+		assert.Equal(t, 3, rpc.calls)
+	})
+
+	t.Run("fetch_with_retry_waits_for_block_not_found", func(t *testing.T) {
+		rpc := &mockRpcClient{blocks: map[uint64]jsonrpc.Block{100: testBlock(100, "0xa", "0x9")}, missing: 5}
+		cfg := testRetryConfig()
+		cfg.MaxAttempts = 1
+
+		blk, err := fetchWithRetry(context.Background(), rpc, cfg, newMockAddressIndex(), 100)
+		assert.NoError(t, err)
+		assert.Equal(t, "0xa", blk.Hash)
+		assert.Equal(t, 6, rpc.calls)
+	})
+
+	t.Run("fetch_with_retry_fatal_error_returns_right_away", func(t *testing.T) {
+		rpc := &mockRpcClient{blocks: map[uint64]jsonrpc.Block{}}
+		cfg := testRetryConfig()
+		cfg.MaxAttempts = 3
+
+		_, err := fetchWithRetry(context.Background(), rpc, cfg, newMockAddressIndex(), 100)
+		assert.Error(t, err)
+		assert.Equal(t, 1, rpc.calls)
+	})
+}
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"nil_error", nil, false},
+		{"deadline_exceeded", context.DeadlineExceeded, true},
+		{"unexpected_eof", io.ErrUnexpectedEOF, true},
+		{"block_not_found", fmt.Errorf("%w: 0x1", jsonrpc.ErrBlockNotFound), true},
+		{"rate_limited", &jsonrpc.Error{Code: -32005, Message: "limit exceeded"}, true},
+		{"server_error", fmt.Errorf("%w: http status 502", jsonrpc.ErrServer), true},
+		{"malformed_response", fmt.Errorf("%w: bad json", jsonrpc.ErrMalformedResponse), false},
+		{"unexpected_block", fmt.Errorf("%w: got 1 instead of 2", errUnexpectedBlock), true},
+		{"other_error", assert.AnError, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.retryable, isRetryable(tc.err))
+		})
+	}
+}
+
 func TestBackoffWithJitter(t *testing.T) {
 	t.Run("backoff_with_jitter_no_jitter", func(t *testing.T) {
 		cfg := config.BlockFetcherConfig{
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	// the events are crypto.transfer.native and crypto.transfer.erc20
+	cloudEventsTypePrefix = "crypto.transfer."
+)
+
+// cloudEvent is the CloudEvents 1.0 envelope of an event, in the structured mode the data
+// is the encoded event, json in data and the binary encodings in data_base64
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      []byte          `json:"data_base64,omitempty"`
+}
+
+func newCloudEvent(cfg config.SinkConfig, ev Event) cloudEvent {
+	source := cfg.CloudEventsSource
+	if source == "" {
+		source = fmt.Sprintf("/de-crypto/eip155/%d", cfg.ChainID)
+	}
+
+	// the event id has the status, so it is unique for every event of the source
+	ce := cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              ev.ID,
+		Source:          source,
+		Type:            cloudEventsTypePrefix + ev.Type,
+		Subject:         ev.UserID,
+		DataContentType: contentType(cfg.Encoding),
+	}
+	if ev.BlockTime > 0 {
+		ce.Time = time.Unix(int64(ev.BlockTime), 0).UTC().Format(time.RFC3339)
+	}
+	return ce
+}
+
+// structured wraps the encoded event in the envelope
+func (ce cloudEvent) structured(data []byte) ([]byte, error) {
+	if strings.HasSuffix(ce.DataContentType, "json") {
+		ce.Data = data
+	} else {
+		ce.DataBase64 = data
+	}
+	return json.Marshal(ce)
+}
+
+// binaryHeaders are the attributes in the kafka binary mode, the body is the event as it is
+// and the content-type header is the datacontenttype
+func (ce cloudEvent) binaryHeaders() map[string]string {
+	headers := map[string]string{
+		"ce_specversion": ce.SpecVersion,
+		"ce_id":          ce.ID,
+		"ce_source":      ce.Source,
+		"ce_type":        ce.Type,
+		"ce_subject":     ce.Subject,
+	}
+	if ce.Time != "" {
+		headers["ce_time"] = ce.Time
+	}
+	return headers
+}
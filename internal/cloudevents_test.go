@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudEvents(t *testing.T) {
+	ev := Event{
+		ID:          "id1",
+		Type:        EventTypeNative,
+		UserID:      "user1",
+		TxHash:      "0xabc",
+		BlockNumber: 100,
+		BlockTime:   1700000000,
+		Direction:   DirectionIn,
+	}
+	cfg := config.SinkConfig{ChainID: 1, CloudEvents: config.CloudEventsStructured}
+
+	t.Run("cloud_events_structured_json", func(t *testing.T) {
+		msg, err := eventMessage(cfg, ev)
+		assert.NoError(t, err)
+		assert.Equal(t, "application/cloudevents+json", msg.Headers["content-type"])
+
+		var ce map[string]any
+		assert.NoError(t, json.Unmarshal(msg.Value, &ce))
+		assert.Equal(t, "1.0", ce["specversion"])
+		assert.Equal(t, "id1", ce["id"])
+		assert.Equal(t, "/de-crypto/eip155/1", ce["source"])
+		assert.Equal(t, "crypto.transfer.native", ce["type"])
+		assert.Equal(t, "user1", ce["subject"])
+		assert.Equal(t, "2023-11-14T22:13:20Z", ce["time"])
+		assert.Equal(t, "application/json", ce["datacontenttype"])
+		assert.Equal(t, "0xabc", ce["data"].(map[string]any)["hash"])
+	})
+
+	t.Run("cloud_events_structured_binary_data", func(t *testing.T) {
+		cfg := cfg
+		cfg.Encoding = config.EncodingProtobuf
+		msg, err := eventMessage(cfg, ev)
+		assert.NoError(t, err)
+
+		var ce cloudEvent
+		assert.NoError(t, json.Unmarshal(msg.Value, &ce))
+		assert.Equal(t, "application/x-protobuf", ce.DataContentType)
+		assert.Nil(t, ce.Data)
+		data, err := encodeEvent(cfg, ev)
+		assert.NoError(t, err)
+		assert.Equal(t, data, ce.DataBase64)
+	})
+
+	t.Run("cloud_events_binary_mode", func(t *testing.T) {
+		cfg := cfg
+		cfg.CloudEvents = config.CloudEventsBinary
+		cfg.CloudEventsSource = "//rpc.example.com/eip155/1"
+		ev := ev
+		ev.Type, ev.Status = EventTypeERC20, EventStatusConfirmed
+		ev.ID = ev.eventID()
+
+		msg, err := eventMessage(cfg, ev)
+		assert.NoError(t, err)
+		// the body is the event as it is
+		data, err := encodeEvent(cfg, ev)
+		assert.NoError(t, err)
+		assert.Equal(t, data, msg.Value)
+
+		assert.Equal(t, "application/json", msg.Headers["content-type"])
+		assert.Equal(t, "1.0", msg.Headers["ce_specversion"])
+		assert.Equal(t, msg.Headers["event-id"], msg.Headers["ce_id"])
+		assert.True(t, strings.HasSuffix(msg.Headers["ce_id"], ":confirmed"))
+		assert.Equal(t, "//rpc.example.com/eip155/1", msg.Headers["ce_source"])
+		assert.Equal(t, "crypto.transfer.erc20", msg.Headers["ce_type"])
+		assert.Equal(t, "user1", msg.Headers["ce_subject"])
+		assert.Equal(t, "2023-11-14T22:13:20Z", msg.Headers["ce_time"])
+	})
+
+	t.Run("cloud_events_disabled", func(t *testing.T) {
+		msg, err := eventMessage(config.SinkConfig{}, ev)
+		assert.NoError(t, err)
+		assert.NotContains(t, msg.Headers, "ce_id")
+		var decoded Event
+		assert.NoError(t, json.Unmarshal(msg.Value, &decoded))
+		assert.Equal(t, ev, decoded)
+	})
+
+	t.Run("cloud_events_without_block_time", func(t *testing.T) {
+		ev := ev
+		ev.BlockTime = 0
+		assert.Equal(t, "", newCloudEvent(cfg, ev).Time)
+		assert.NotContains(t, newCloudEvent(cfg, ev).binaryHeaders(), "ce_time")
+	})
+}
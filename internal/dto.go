@@ -1,10 +1,99 @@
 package internal
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// in the dual mode events are sent at inclusion as unconfirmed and again
+	// as confirmed when the block reaches the confirmation depth
+	EventStatusUnconfirmed = "unconfirmed"
+	EventStatusConfirmed   = "confirmed"
+	// events for blocks that were orphaned by a reorg are sent again with this status
+	// so the consumers can compensate what was already booked
+	EventStatusReverted = "reverted"
+)
+
+const (
+	EventTypeNative = "native"
+	EventTypeERC20  = "erc20"
+)
+
+// the side of the transfer the user is on
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// EventSchemaVersion goes in the message headers, it changes when the event fields change
+const EventSchemaVersion = "3"
+
+const (
+	TxStatusSuccess = "success"
+	TxStatusFailed  = "failed"
+)
+
 type Event struct {
+	// the same transfer gets the same id every time it is sent, see eventID
+	ID          string `json:"id"`
+	Type        string `json:"type"`
 	UserID      string `json:"userId"`
 	From        string `json:"from"`
 	To          string `json:"to"`
 	AmountWei   string `json:"amountWei"`
 	TxHash      string `json:"hash"`
 	BlockNumber uint64 `json:"blockNumber"`
+	BlockHash   string `json:"blockHash"`
+	// unix seconds of the block
+	BlockTime uint64 `json:"blockTime,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Direction string `json:"direction"`
+
+	// only for token transfers, the amount is the raw uint256 without the token decimals
+	TokenAddress string `json:"tokenAddress,omitempty"`
+	TokenAmount  string `json:"tokenAmount,omitempty"`
+	LogIndex     string `json:"logIndex,omitempty"`
+
+	// only for value moved inside a contract call, the path is the position in the call tree
+	Internal  bool   `json:"internal,omitempty"`
+	TracePath string `json:"tracePath,omitempty"`
+
+	// only when the receipts are enabled, the fee is gasUsed * effectiveGasPrice in wei
+	TxStatus          string `json:"txStatus,omitempty"`
+	GasUsed           string `json:"gasUsed,omitempty"`
+	EffectiveGasPrice string `json:"effectiveGasPrice,omitempty"`
+	FeeWei            string `json:"feeWei,omitempty"`
+	ContractAddress   string `json:"contractAddress,omitempty"`
+}
+
+// userAddress is the address of the user in the transfer
+func (e Event) userAddress() string {
+	if e.Direction == DirectionOut {
+		return strings.ToLower(e.From)
+	}
+	return strings.ToLower(e.To)
+}
+
+// eventID is derived from what makes the event unique, so a message published again
+// after a crash or a replay has the same id and the consumers can drop the duplicate.
+// The block hash is part of it, a transaction included again in another block after a reorg
+// is a new transfer and not a duplicate of the reverted one. The status goes after the hash,
+// the confirmed and reverted events of a transfer share the prefix of the unconfirmed one.
+func (e Event) eventID() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		strings.ToLower(e.BlockHash),
+		strings.ToLower(e.TxHash),
+		e.Type,
+		e.LogIndex,
+		e.TracePath,
+		e.UserID,
+		e.Direction,
+	}, "|")))
+	id := hex.EncodeToString(sum[:16])
+	if e.Status != "" {
+		id += ":" + e.Status
+	}
+	return id
 }
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/schema"
+)
+
+// the schemas of the events, they are registered in the schema registry and are what
+// the consumers use to decode the protobuf and avro messages
+var (
+	//go:embed schemas/event.proto
+	eventProtoSchema string
+	//go:embed schemas/event.avsc
+	eventAvroSchema string
+)
+
+// eventField is a field of the event schemas, the protobuf field number is the position
+// in eventFields plus one and the avro record has the fields in this order
+type eventField struct {
+	name  string
+	value func(ev Event) any
+}
+
+var eventFields = []eventField{
+	{"id", func(ev Event) any { return ev.ID }},
+	{"type", func(ev Event) any { return ev.Type }},
+	{"userId", func(ev Event) any { return ev.UserID }},
+	{"from", func(ev Event) any { return ev.From }},
+	{"to", func(ev Event) any { return ev.To }},
+	{"amountWei", func(ev Event) any { return ev.AmountWei }},
+	{"hash", func(ev Event) any { return ev.TxHash }},
+	{"blockNumber", func(ev Event) any { return ev.BlockNumber }},
+	{"blockHash", func(ev Event) any { return ev.BlockHash }},
+	{"status", func(ev Event) any { return ev.Status }},
+	{"direction", func(ev Event) any { return ev.Direction }},
+	{"tokenAddress", func(ev Event) any { return ev.TokenAddress }},
+	{"tokenAmount", func(ev Event) any { return ev.TokenAmount }},
+	{"logIndex", func(ev Event) any { return ev.LogIndex }},
+	{"internal", func(ev Event) any { return ev.Internal }},
+	{"tracePath", func(ev Event) any { return ev.TracePath }},
+	{"txStatus", func(ev Event) any { return ev.TxStatus }},
+	{"gasUsed", func(ev Event) any { return ev.GasUsed }},
+	{"effectiveGasPrice", func(ev Event) any { return ev.EffectiveGasPrice }},
+	{"feeWei", func(ev Event) any { return ev.FeeWei }},
+	{"contractAddress", func(ev Event) any { return ev.ContractAddress }},
+	{"blockTime", func(ev Event) any { return ev.BlockTime }},
+}
+
+// encodeEvent encodes the event in the encoding of the sink, with a schema id the
+// message has the Confluent wire format
+func encodeEvent(cfg config.SinkConfig, ev Event) ([]byte, error) {
+	switch cfg.Encoding {
+	case config.EncodingProtobuf:
+		var p schema.Proto
+		for i, f := range eventFields {
+			switch v := f.value(ev).(type) {
+			case string:
+				p.String(i+1, v)
+			case uint64:
+				p.Uint64(i+1, v)
+			case bool:
+				p.Bool(i+1, v)
+			}
+		}
+		if cfg.SchemaID > 0 {
+			return schema.FrameProtobuf(cfg.SchemaID, p.Bytes()), nil
+		}
+		return p.Bytes(), nil
+
+	case config.EncodingAvro:
+		var a schema.Avro
+		for _, f := range eventFields {
+			switch v := f.value(ev).(type) {
+			case string:
+				a.String(v)
+			case uint64:
+				a.Long(int64(v))
+			case bool:
+				a.Boolean(v)
+			}
+		}
+		if cfg.SchemaID > 0 {
+			return schema.Frame(cfg.SchemaID, a.Bytes()), nil
+		}
+		return a.Bytes(), nil
+
+	case "", config.EncodingJSON:
+		return json.Marshal(ev)
+	}
+	return nil, fmt.Errorf("unknown encoding %q", cfg.Encoding)
+}
+
+// contentType goes in the headers, so the consumers know how to decode the message
+func contentType(encoding string) string {
+	switch encoding {
+	case config.EncodingProtobuf:
+		return "application/x-protobuf"
+	case config.EncodingAvro:
+		return "application/avro"
+	}
+	return "application/json"
+}
+
+// eventSchema returns the schema the registry knows the encoding by
+func eventSchema(encoding string) (schemaType, s string, ok bool) {
+	switch encoding {
+	case config.EncodingProtobuf:
+		return schema.TypeProtobuf, eventProtoSchema, true
+	case config.EncodingAvro:
+		return schema.TypeAvro, eventAvroSchema, true
+	}
+	return "", "", false
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeEvent(t *testing.T) {
+	ev := Event{ID: "id1", Type: EventTypeNative, BlockNumber: 150, Internal: true}
+
+	t.Run("encode_event_json", func(t *testing.T) {
+		b, err := encodeEvent(config.SinkConfig{}, ev)
+		assert.NoError(t, err)
+		var decoded Event
+		assert.NoError(t, json.Unmarshal(b, &decoded))
+		assert.Equal(t, ev, decoded)
+	})
+	t.Run("encode_event_protobuf", func(t *testing.T) {
+		b, err := encodeEvent(config.SinkConfig{Encoding: config.EncodingProtobuf}, ev)
+		assert.NoError(t, err)
+		// id = 1, type = 2, block_number = 8, internal = 15, the empty fields are not written
+		want := []byte{0x0a, 3, 'i', 'd', '1', 0x12, 6, 'n', 'a', 't', 'i', 'v', 'e', 0x40, 0x96, 0x01, 0x78, 0x01}
+		assert.Equal(t, want, b)
+
+		framed, err := encodeEvent(config.SinkConfig{Encoding: config.EncodingProtobuf, SchemaID: 7}, ev)
+		assert.NoError(t, err)
+		assert.Equal(t, schema.FrameProtobuf(7, want), framed)
+	})
+	t.Run("encode_event_avro", func(t *testing.T) {
+		b, err := encodeEvent(config.SinkConfig{Encoding: config.EncodingAvro}, ev)
+		assert.NoError(t, err)
+		// all the fields in the order of the schema, the empty strings are a zero length
+		want := []byte{6, 'i', 'd', '1', 12, 'n', 'a', 't', 'i', 'v', 'e', 0, 0, 0, 0, 0, 0xac, 0x02, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0}
+		assert.Equal(t, want, b)
+
+		framed, err := encodeEvent(config.SinkConfig{Encoding: config.EncodingAvro, SchemaID: 7}, ev)
+		assert.NoError(t, err)
+		assert.Equal(t, schema.Frame(7, want), framed)
+	})
+	t.Run("encode_event_unknown_encoding", func(t *testing.T) {
+		_, err := encodeEvent(config.SinkConfig{Encoding: "xml"}, ev)
+		assert.Error(t, err)
+	})
+}
+
+// the schemas must have every field of the event, in the order of eventFields
+func TestEventSchemas(t *testing.T) {
+	kinds := map[string]string{}
+	for _, f := range eventFields {
+		kinds[f.name] = reflect.TypeOf(f.value(Event{})).Kind().String()
+	}
+
+	t.Run("event_schemas_have_every_event_field", func(t *testing.T) {
+		typ := reflect.TypeOf(Event{})
+		for i := 0; i < typ.NumField(); i++ {
+			name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+			assert.Contains(t, kinds, name, "the field %s is missing in eventFields and in the schemas", name)
+		}
+		assert.Len(t, eventFields, typ.NumField())
+	})
+
+	t.Run("event_schemas_avro", func(t *testing.T) {
+		var avsc struct {
+			Fields []struct {
+				Name string `json:"name"`
+				Type string `json:"type"`
+			} `json:"fields"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(eventAvroSchema), &avsc))
+		avroTypes := map[string]string{"string": "string", "uint64": "long", "bool": "boolean"}
+		assert.Len(t, avsc.Fields, len(eventFields))
+		for i, f := range avsc.Fields {
+			assert.Equal(t, eventFields[i].name, f.Name)
+			assert.Equal(t, avroTypes[kinds[f.Name]], f.Type, f.Name)
+		}
+	})
+
+	t.Run("event_schemas_protobuf", func(t *testing.T) {
+		re := regexp.MustCompile(`(?m)^\s+(\w+) (\w+) = (\d+);`)
+		snake := regexp.MustCompile(`([A-Z])`)
+		fields := re.FindAllStringSubmatch(eventProtoSchema, -1)
+		assert.Len(t, fields, len(eventFields))
+		for _, f := range fields {
+			n, _ := strconv.Atoi(f[3])
+			name := eventFields[n-1].name
+			assert.Equal(t, strings.ToLower(snake.ReplaceAllString(name, "_$1")), f[2])
+			assert.Equal(t, kinds[name], map[string]string{"string": "string", "uint64": "uint64", "bool": "bool"}[f[1]], name)
+		}
+	})
+}
+
+func TestSinkEncoding(t *testing.T) {
+	ctx := context.Background()
+	var paths []string
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"id":7}`))
+	}))
+	defer registry.Close()
+
+	t.Run("sink_encoding_registers_the_kafka_schema", func(t *testing.T) {
+		os.Setenv("SINK", "kafka")
+		os.Setenv("KAFKA_ENCODING", "avro")
+		os.Setenv("SCHEMA_REGISTRY_URL", registry.URL)
+		defer os.Unsetenv("SINK")
+		defer os.Unsetenv("KAFKA_ENCODING")
+		defer os.Unsetenv("SCHEMA_REGISTRY_URL")
+
+		encoding, id, err := sinkEncoding(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, config.EncodingAvro, encoding)
+		assert.Equal(t, 7, id)
+
+		os.Setenv("SCHEMA_REGISTRY_AUTO_REGISTER", "false")
+		defer os.Unsetenv("SCHEMA_REGISTRY_AUTO_REGISTER")
+		_, id, err = sinkEncoding(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 7, id)
+		assert.Equal(t, []string{"/subjects/de-crypto-events-value/versions", "/subjects/de-crypto-events-value"}, paths)
+	})
+	t.Run("sink_encoding_without_registry", func(t *testing.T) {
+		os.Setenv("SINK", "kafka")
+		os.Setenv("KAFKA_ENCODING", "protobuf")
+		defer os.Unsetenv("SINK")
+		defer os.Unsetenv("KAFKA_ENCODING")
+
+		encoding, id, err := sinkEncoding(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, config.EncodingProtobuf, encoding)
+		assert.Equal(t, 0, id)
+	})
+	t.Run("sink_encoding_json_lines", func(t *testing.T) {
+		os.Setenv("SINK", "file")
+		os.Setenv("KAFKA_ENCODING", "protobuf")
+		defer os.Unsetenv("SINK")
+		defer os.Unsetenv("KAFKA_ENCODING")
+
+		encoding, _, err := sinkEncoding(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, config.EncodingJSON, encoding)
+	})
+	t.Run("sink_encoding_webhook_batches_are_json", func(t *testing.T) {
+		os.Setenv("SINK", "webhook")
+		os.Setenv("WEBHOOK_ENCODING", "protobuf")
+		os.Setenv("WEBHOOK_BATCH", "true")
+		defer os.Unsetenv("SINK")
+		defer os.Unsetenv("WEBHOOK_ENCODING")
+		defer os.Unsetenv("WEBHOOK_BATCH")
+
+		_, _, err := sinkEncoding(ctx)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmsilvadev/de-crypto/pkg/address"
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/jsonrpc"
+	"github.com/jmsilvadev/de-crypto/pkg/utils"
+)
+
+var (
+	errTraceMismatch   = errors.New("trace does not belong to the block")
+	errReceiptMismatch = errors.New("receipt does not belong to the block")
+)
+
+// enrichBlock fetches the data that is not in the block response, like the token transfer logs.
+// The fetcher and the reorg validator use it so every block in the pipeline has the same data.
+func enrichBlock(ctx context.Context, cfg config.EnrichConfig, rpc jsonrpc.JsonRpcClient, addrIdx address.AddressIndex, b *jsonrpc.Block) error {
+	if cfg.TokenTransfers {
+		// by block hash so we never mix logs from another fork
+		logs, err := rpc.GetLogs(ctx, jsonrpc.LogFilter{
+			BlockHash: b.Hash,
+			Topics:    [][]string{{jsonrpc.TransferTopic}},
+		})
+		if err != nil {
+			return err
+		}
+		b.Logs = logs
+	}
+
+	if cfg.TraceMode != "" {
+		n, err := utils.ParseHexUint64(b.Number)
+		if err != nil {
+			return err
+		}
+		transfers, err := rpc.GetInternalTransfers(ctx, n, cfg.TraceMode)
+		if err != nil {
+			return err
+		}
+		// the traces are by number, if the node moved to another fork in the meantime
+		// they have transactions that are not in our block
+		if err := checkTraces(*b, transfers); err != nil {
+			return err
+		}
+		b.InternalTransfers = transfers
+	}
+
+	if cfg.Receipts || cfg.SkipFailedTxs {
+		receipts, err := fetchReceipts(ctx, rpc, addrIdx, *b)
+		if err != nil {
+			return err
+		}
+		b.Receipts = receipts
+		if cfg.SkipFailedTxs {
+			dropFailedTxs(b)
+		}
+	}
+	return nil
+}
+
+// fetchReceipts gets all the receipts of the block in one call, when the node doesn't have
+// eth_getBlockReceipts we get only the receipts of the matched transactions in a batch
+func fetchReceipts(ctx context.Context, rpc jsonrpc.JsonRpcClient, addrIdx address.AddressIndex, b jsonrpc.Block) (map[string]jsonrpc.Receipt, error) {
+	list, err := rpc.GetBlockReceipts(ctx, b.Hash)
+	if err == nil {
+		receipts := make(map[string]jsonrpc.Receipt, len(list))
+		for _, r := range list {
+			receipts[strings.ToLower(r.TransactionHash)] = r
+		}
+		return receipts, nil
+	}
+	if !errors.Is(err, jsonrpc.ErrMethodNotFound) {
+		return nil, err
+	}
+
+	var hashes []string
+	seen := make(map[string]struct{})
+	for _, ev := range matchBlock(b, addrIdx) {
+		hash := strings.ToLower(ev.TxHash)
+		if _, ok := seen[hash]; ok {
+			continue
+		}
+		seen[hash] = struct{}{}
+		hashes = append(hashes, ev.TxHash)
+	}
+
+	receipts := make(map[string]jsonrpc.Receipt, len(hashes))
+	if len(hashes) == 0 {
+		return receipts, nil
+	}
+
+	found, errs, err := rpc.GetTransactionReceipts(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range found {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		// the transaction may be included in another fork by now
+		if !strings.EqualFold(r.BlockHash, b.Hash) {
+			return nil, fmt.Errorf("%w: tx %s in block %s", errReceiptMismatch, hashes[i], b.Hash)
+		}
+		receipts[strings.ToLower(hashes[i])] = *r
+	}
+	return receipts, nil
+}
+
+// dropFailedTxs removes the reverted transactions so no event is sent for them, they have
+// no logs and the traces already skip them
+func dropFailedTxs(b *jsonrpc.Block) {
+	txs := b.Transactions[:0:0]
+	for _, tx := range b.Transactions {
+		if r, ok := b.Receipts[strings.ToLower(tx.Hash)]; ok && r.Failed() {
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	b.Transactions = txs
+}
+
+// checkTraces makes sure the traces are of our block, when the node doesn't send the tx hash
+// we take it from the transaction at the same position if the sender matches
+func checkTraces(b jsonrpc.Block, transfers []jsonrpc.InternalTransfer) error {
+	if len(transfers) == 0 {
+		return nil
+	}
+
+	txs := make(map[string]struct{}, len(b.Transactions))
+	for _, tx := range b.Transactions {
+		txs[strings.ToLower(tx.Hash)] = struct{}{}
+	}
+	for i, it := range transfers {
+		if it.TxHash == "" {
+			if it.TxIndex >= len(b.Transactions) || !strings.EqualFold(it.TxFrom, b.Transactions[it.TxIndex].From) {
+				return fmt.Errorf("%w: tx %d in block %s", errTraceMismatch, it.TxIndex, b.Hash)
+			}
+			transfers[i].TxHash = b.Transactions[it.TxIndex].Hash
+			continue
+		}
+		if _, ok := txs[strings.ToLower(it.TxHash)]; !ok {
+			return fmt.Errorf("%w: tx %s in block %s", errTraceMismatch, it.TxHash, b.Hash)
+		}
+	}
+	return nil
+}
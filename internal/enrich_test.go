@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/jsonrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrichBlock(t *testing.T) {
+	t.Run("enrich_block_disabled", func(t *testing.T) {
+		rpc := &mockRpcClient{}
+		b := testBlock(100, "0xa", "0x9")
+
+		err := enrichBlock(context.Background(), config.EnrichConfig{}, rpc, newMockAddressIndex(), &b)
+
+		assert.NoError(t, err)
+		assert.Nil(t, b.Logs)
+		assert.Equal(t, 0, rpc.calls)
+	})
+
+	t.Run("enrich_block_token_transfers", func(t *testing.T) {
+		rpc := &mockRpcClient{logs: map[string][]jsonrpc.Log{"0xa": {{TransactionHash: "0xtx"}}}}
+		b := testBlock(100, "0xa", "0x9")
+
+		err := enrichBlock(context.Background(), config.EnrichConfig{TokenTransfers: true}, rpc, newMockAddressIndex(), &b)
+
+		assert.NoError(t, err)
+		assert.Len(t, b.Logs, 1)
+	})
+
+	t.Run("enrich_block_error", func(t *testing.T) {
+		rpc := &mockRpcClient{err: assert.AnError}
+		b := testBlock(100, "0xa", "0x9")
+
+		err := enrichBlock(context.Background(), config.EnrichConfig{TokenTransfers: true}, rpc, newMockAddressIndex(), &b)
+
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
+
+func TestEnrichBlock_InternalTransfers(t *testing.T) {
+	cfg := config.EnrichConfig{TraceMode: jsonrpc.TraceModeCallTracer}
+
+	t.Run("enrich_block_internal_transfers", func(t *testing.T) {
+		rpc := &mockRpcClient{traces: map[uint64][]jsonrpc.InternalTransfer{100: {{TxHash: "0xTX1", Path: "0"}}}}
+		b := testBlock(100, "0xa", "0x9", jsonrpc.Transaction{Hash: "0xtx1"})
+
+		err := enrichBlock(context.Background(), cfg, rpc, newMockAddressIndex(), &b)
+
+		assert.NoError(t, err)
+		assert.Len(t, b.InternalTransfers, 1)
+	})
+
+	t.Run("enrich_block_internal_transfers_from_another_fork", func(t *testing.T) {
+		rpc := &mockRpcClient{traces: map[uint64][]jsonrpc.InternalTransfer{100: {{TxHash: "0xother", Path: "0"}}}}
+		b := testBlock(100, "0xa", "0x9", jsonrpc.Transaction{Hash: "0xtx1"})
+
+		err := enrichBlock(context.Background(), cfg, rpc, newMockAddressIndex(), &b)
+
+		assert.ErrorIs(t, err, errTraceMismatch)
+		assert.Nil(t, b.InternalTransfers)
+	})
+
+	t.Run("enrich_block_internal_transfers_without_tx_hash", func(t *testing.T) {
+		rpc := &mockRpcClient{traces: map[uint64][]jsonrpc.InternalTransfer{100: {{TxIndex: 1, TxFrom: "0xEOA", Path: "0"}}}}
+		b := testBlock(100, "0xa", "0x9", jsonrpc.Transaction{Hash: "0xtx1", From: "0xother"}, jsonrpc.Transaction{Hash: "0xtx2", From: "0xeoa"})
+
+		err := enrichBlock(context.Background(), cfg, rpc, newMockAddressIndex(), &b)
+
+		assert.NoError(t, err)
+		assert.Len(t, b.InternalTransfers, 1)
+		assert.Equal(t, "0xtx2", b.InternalTransfers[0].TxHash)
+	})
+
+	t.Run("enrich_block_internal_transfers_without_tx_hash_from_another_fork", func(t *testing.T) {
+		rpc := &mockRpcClient{traces: map[uint64][]jsonrpc.InternalTransfer{100: {
+			{TxIndex: 0, TxFrom: "0xeoa", Path: "0"},
+			{TxIndex: 1, TxFrom: "0xeoa", Path: "0"},
+		}}}
+		b := testBlock(100, "0xa", "0x9", jsonrpc.Transaction{Hash: "0xtx1", From: "0xeoa"})
+
+		err := enrichBlock(context.Background(), cfg, rpc, newMockAddressIndex(), &b)
+
+		assert.ErrorIs(t, err, errTraceMismatch)
+		assert.Nil(t, b.InternalTransfers)
+	})
+}
+
+func TestEnrichBlock_Receipts(t *testing.T) {
+	deposit := "0xd8da6bf26964af9d7eed9e03e53415d37aa96045"
+	other := "0x1234567890123456789012345678901234567890"
+	newBlock := func() jsonrpc.Block {
+		return testBlock(100, "0xa", "0x9",
+			jsonrpc.Transaction{Hash: "0xtx1", From: other, To: &deposit},
+			jsonrpc.Transaction{Hash: "0xtx2", From: other, To: &deposit},
+			jsonrpc.Transaction{Hash: "0xtx3", From: other, To: &other},
+		)
+	}
+	receipts := []jsonrpc.Receipt{
+		{TransactionHash: "0xtx1", BlockHash: "0xa", Status: jsonrpc.ReceiptStatusSuccess},
+		{TransactionHash: "0xtx2", BlockHash: "0xa", Status: jsonrpc.ReceiptStatusFailed},
+		{TransactionHash: "0xtx3", BlockHash: "0xa", Status: jsonrpc.ReceiptStatusSuccess},
+	}
+
+	t.Run("enrich_block_receipts", func(t *testing.T) {
+		rpc := &mockRpcClient{receipts: map[string][]jsonrpc.Receipt{"0xa": receipts}}
+		b := newBlock()
+
+		err := enrichBlock(context.Background(), config.EnrichConfig{Receipts: true}, rpc, newMockAddressIndex(), &b)
+
+		assert.NoError(t, err)
+		assert.Len(t, b.Receipts, 3)
+		assert.Len(t, b.Transactions, 3)
+		assert.Equal(t, 1, rpc.calls)
+	})
+
+	t.Run("enrich_block_receipts_fallback_for_matched_transactions", func(t *testing.T) {
+		rpc := &mockRpcClient{txReceipts: receipts}
+		b := newBlock()
+
+		err := enrichBlock(context.Background(), config.EnrichConfig{Receipts: true}, rpc, newMockAddressIndex(), &b)
+
+		assert.NoError(t, err)
+		assert.Len(t, b.Receipts, 2)
+		assert.Contains(t, b.Receipts, "0xtx1")
+		assert.Contains(t, b.Receipts, "0xtx2")
+		// only the matched transactions, in one batch
+		assert.Equal(t, 1, rpc.batches)
+	})
+
+	t.Run("enrich_block_receipts_fallback_from_another_fork", func(t *testing.T) {
+		rpc := &mockRpcClient{txReceipts: []jsonrpc.Receipt{{TransactionHash: "0xtx1", BlockHash: "0xb"}}}
+		b := newBlock()
+
+		err := enrichBlock(context.Background(), config.EnrichConfig{Receipts: true}, rpc, newMockAddressIndex(), &b)
+
+		assert.ErrorIs(t, err, errReceiptMismatch)
+	})
+
+	t.Run("enrich_block_skip_failed_transactions", func(t *testing.T) {
+		rpc := &mockRpcClient{receipts: map[string][]jsonrpc.Receipt{"0xa": receipts}}
+		b := newBlock()
+
+		err := enrichBlock(context.Background(), config.EnrichConfig{SkipFailedTxs: true}, rpc, newMockAddressIndex(), &b)
+
+		assert.NoError(t, err)
+		assert.Len(t, b.Transactions, 2)
+		assert.Equal(t, "0xtx1", b.Transactions[0].Hash)
+		assert.Equal(t, "0xtx3", b.Transactions[1].Hash)
+	})
+}
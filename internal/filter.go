@@ -12,7 +12,7 @@ import (
 	"github.com/jmsilvadev/de-crypto/pkg/utils"
 )
 
-func filterMatcher(ctx context.Context, cfg config.FilterConfig, blocksCh <-chan jsonrpc.Block, addrIdx address.AddressIndex, eventsCh chan<- Event) {
+func filterMatcher(ctx context.Context, cfg config.FilterConfig, blocksCh <-chan jsonrpc.Block, addrIdx address.AddressIndex, eventsCh chan<- Event, progress *progressTracker) {
 	log.Println("Starting filter matcher")
 
 	workers := cfg.Workers
@@ -20,6 +20,11 @@ func filterMatcher(ctx context.Context, cfg config.FilterConfig, blocksCh <-chan
 		workers = 1
 	}
 
+	status := ""
+	if cfg.EmitUnconfirmed {
+		status = EventStatusUnconfirmed
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(workers)
 
@@ -35,7 +40,7 @@ func filterMatcher(ctx context.Context, cfg config.FilterConfig, blocksCh <-chan
 					if !ok {
 						return
 					}
-					processBlock(ctx, b, addrIdx, eventsCh)
+					processBlock(ctx, b, addrIdx, eventsCh, status, progress)
 				}
 			}
 		}()
@@ -44,7 +49,58 @@ func filterMatcher(ctx context.Context, cfg config.FilterConfig, blocksCh <-chan
 	wg.Wait()
 }
 
-func processBlock(ctx context.Context, b jsonrpc.Block, addrIdx address.AddressIndex, eventsCh chan<- Event) {
+// processBlock sends the events of the block and marks it as done, even when nothing matched,
+// so the checkpoint can move over it
+func processBlock(ctx context.Context, b jsonrpc.Block, addrIdx address.AddressIndex, eventsCh chan<- Event, status string, progress *progressTracker) {
+	n, err := utils.ParseHexUint64(b.Number)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	emitBlockEvents(ctx, b, addrIdx, eventsCh, status, progress)
+	progress.filtered(n)
+	if ctx.Err() == nil {
+		progress.markDone(n)
+	}
+}
+
+// revertBlock sends again the events of an orphaned block flagged as reverted
+func revertBlock(ctx context.Context, b jsonrpc.Block, addrIdx address.AddressIndex, eventsCh chan<- Event, progress *progressTracker) {
+	emitBlockEvents(ctx, b, addrIdx, eventsCh, EventStatusReverted, progress)
+}
+
+// confirmBlock sends again the events of a block that reached the confirmation depth
+func confirmBlock(ctx context.Context, b jsonrpc.Block, addrIdx address.AddressIndex, eventsCh chan<- Event, progress *progressTracker) {
+	emitBlockEvents(ctx, b, addrIdx, eventsCh, EventStatusConfirmed, progress)
+}
+
+func emitBlockEvents(ctx context.Context, b jsonrpc.Block, addrIdx address.AddressIndex, eventsCh chan<- Event, status string, progress *progressTracker) {
+	events := matchBlock(b, addrIdx)
+	if len(events) == 0 {
+		return
+	}
+
+	// register before sending, otherwise the sink could ack them before we count
+	progress.add(events[0].BlockNumber, len(events))
+	for _, ev := range events {
+		ev.Status = status
+		emitEvent(ctx, eventsCh, ev)
+	}
+}
+
+func matchBlock(b jsonrpc.Block, addrIdx address.AddressIndex) []Event {
+	if len(b.Transactions) == 0 && len(b.Logs) == 0 && len(b.InternalTransfers) == 0 {
+		return nil
+	}
+
+	n, err := utils.ParseHexUint64(b.Number)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	var events []Event
 	for _, tx := range b.Transactions {
 		from := strings.ToLower(tx.From)
 		to := ""
@@ -52,36 +108,135 @@ func processBlock(ctx context.Context, b jsonrpc.Block, addrIdx address.AddressI
 			to = strings.ToLower(*tx.To)
 		}
 
-		n, err := utils.ParseHexUint64(b.Number)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-
 		if userID, ok := addrIdx.Lookup(from); ok {
-			ev := Event{
+			events = append(events, Event{
+				Type:        EventTypeNative,
 				UserID:      userID,
+				Direction:   DirectionOut,
 				From:        tx.From,
 				To:          to,
 				AmountWei:   tx.Value,
 				TxHash:      tx.Hash,
 				BlockNumber: n,
-			}
-			emitEvent(ctx, eventsCh, ev)
+				BlockHash:   b.Hash,
+			})
 		}
 
 		if userID, ok := addrIdx.Lookup(to); ok {
-			ev := Event{
+			events = append(events, Event{
+				Type:        EventTypeNative,
 				UserID:      userID,
+				Direction:   DirectionIn,
 				From:        tx.From,
 				To:          to,
 				AmountWei:   tx.Value,
 				TxHash:      tx.Hash,
 				BlockNumber: n,
+				BlockHash:   b.Hash,
+			})
+		}
+	}
+
+	events = append(events, matchInternalTransfers(b, n, addrIdx)...)
+	events = append(events, matchLogs(b, n, addrIdx)...)
+
+	// the blocks of some tests and old nodes have no timestamp, the time is left out then
+	if ts, err := utils.ParseHexUint64(b.Timestamp); err == nil {
+		for i := range events {
+			events[i].BlockTime = ts
+		}
+	}
+
+	if b.Receipts != nil {
+		for i := range events {
+			if r, ok := b.Receipts[strings.ToLower(events[i].TxHash)]; ok {
+				applyReceipt(&events[i], r)
 			}
-			emitEvent(ctx, eventsCh, ev)
 		}
 	}
+	return events
+}
+
+func applyReceipt(ev *Event, r jsonrpc.Receipt) {
+	ev.TxStatus = TxStatusSuccess
+	if r.Failed() {
+		ev.TxStatus = TxStatusFailed
+	}
+	ev.GasUsed = r.GasUsed
+	ev.EffectiveGasPrice = r.EffectiveGasPrice
+	ev.FeeWei = r.Fee()
+	if r.ContractAddress != nil {
+		ev.ContractAddress = strings.ToLower(*r.ContractAddress)
+	}
+}
+
+// matchInternalTransfers matches both sides of the value moved inside the contract calls
+func matchInternalTransfers(b jsonrpc.Block, n uint64, addrIdx address.AddressIndex) []Event {
+	var events []Event
+	for _, it := range b.InternalTransfers {
+		from := strings.ToLower(it.From)
+		to := strings.ToLower(it.To)
+
+		ev := Event{
+			Type:        EventTypeNative,
+			From:        from,
+			To:          to,
+			AmountWei:   it.Value,
+			TxHash:      it.TxHash,
+			BlockNumber: n,
+			BlockHash:   b.Hash,
+			Internal:    true,
+			TracePath:   it.Path,
+		}
+
+		if userID, ok := addrIdx.Lookup(from); ok {
+			ev.UserID, ev.Direction = userID, DirectionOut
+			events = append(events, ev)
+		}
+
+		if userID, ok := addrIdx.Lookup(to); ok {
+			ev.UserID, ev.Direction = userID, DirectionIn
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// matchLogs matches both sides of the ERC-20 transfers of the block
+func matchLogs(b jsonrpc.Block, n uint64, addrIdx address.AddressIndex) []Event {
+	var events []Event
+	for _, l := range b.Logs {
+		if l.Removed {
+			continue
+		}
+		from, to, amount, ok := l.DecodeTransfer()
+		if !ok {
+			continue
+		}
+
+		ev := Event{
+			Type:         EventTypeERC20,
+			From:         from,
+			To:           to,
+			TxHash:       l.TransactionHash,
+			BlockNumber:  n,
+			BlockHash:    b.Hash,
+			TokenAddress: strings.ToLower(l.Address),
+			TokenAmount:  amount,
+			LogIndex:     l.LogIndex,
+		}
+
+		if userID, ok := addrIdx.Lookup(from); ok {
+			ev.UserID, ev.Direction = userID, DirectionOut
+			events = append(events, ev)
+		}
+
+		if userID, ok := addrIdx.Lookup(to); ok {
+			ev.UserID, ev.Direction = userID, DirectionIn
+			events = append(events, ev)
+		}
+	}
+	return events
 }
 
 func emitEvent(ctx context.Context, eventsCh chan<- Event, ev Event) {
@@ -39,7 +39,7 @@ func TestFilterMatcher(t *testing.T) {
 		cfg := config.FilterConfig{
 			Workers: 1,
 		}
-		go filterMatcher(ctx, cfg, blocksCh, addrIdx, eventsCh)
+		go filterMatcher(ctx, cfg, blocksCh, addrIdx, eventsCh, nil)
 		toAddr := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
 		block := jsonrpc.Block{
 			Number: "0x3039",
@@ -64,6 +64,40 @@ func TestFilterMatcher(t *testing.T) {
 			t.Error("Expected event but got timeout")
 		}
 	})
+	t.Run("filter_matcher_emits_unconfirmed_events", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		blocksCh := make(chan jsonrpc.Block, 1)
+		eventsCh := make(chan Event, 1)
+		addrIdx := newMockAddressIndex()
+		cfg := config.FilterConfig{
+			Workers:         1,
+			EmitUnconfirmed: true,
+		}
+		go filterMatcher(ctx, cfg, blocksCh, addrIdx, eventsCh, nil)
+		toAddr := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+		blocksCh <- jsonrpc.Block{
+			Number: "0x3039",
+			Hash:   "0xabc123",
+			Transactions: []jsonrpc.Transaction{
+				{
+					From:  "0x1234567890123456789012345678901234567890",
+					To:    &toAddr,
+					Value: "0xde0b6b3a7640000",
+					Hash:  "0xtx123",
+				},
+			},
+		}
+		close(blocksCh)
+		select {
+		case event := <-eventsCh:
+			if event.Status != EventStatusUnconfirmed {
+				t.Errorf("Expected status '%s', got '%s'", EventStatusUnconfirmed, event.Status)
+			}
+		case <-time.After(30 * time.Millisecond):
+			t.Error("Expected event but got timeout")
+		}
+	})
 	t.Run("filter_matcher_handles_context_cancellation", func(t *testing.T) {
 		ctx, cancel := context.WithCancel(context.Background())
 		blocksCh := make(chan jsonrpc.Block, 1)
@@ -72,7 +106,7 @@ func TestFilterMatcher(t *testing.T) {
 		cfg := config.FilterConfig{
 			Workers: 1,
 		}
-		go filterMatcher(ctx, cfg, blocksCh, addrIdx, eventsCh)
+		go filterMatcher(ctx, cfg, blocksCh, addrIdx, eventsCh, nil)
 		cancel()
 	})
 	t.Run("filter_matcher_with_zero_workers", func(t *testing.T) {
@@ -84,7 +118,7 @@ func TestFilterMatcher(t *testing.T) {
 		cfg := config.FilterConfig{
 			Workers: 0,
 		}
-		go filterMatcher(ctx, cfg, blocksCh, addrIdx, eventsCh)
+		go filterMatcher(ctx, cfg, blocksCh, addrIdx, eventsCh, nil)
 	})
 	t.Run("filter_matcher_with_negative_workers", func(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
@@ -95,7 +129,7 @@ func TestFilterMatcher(t *testing.T) {
 		cfg := config.FilterConfig{
 			Workers: -1,
 		}
-		go filterMatcher(ctx, cfg, blocksCh, addrIdx, eventsCh)
+		go filterMatcher(ctx, cfg, blocksCh, addrIdx, eventsCh, nil)
 	})
 	t.Run("filter_matcher_channel_close", func(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
@@ -106,7 +140,7 @@ func TestFilterMatcher(t *testing.T) {
 		cfg := config.FilterConfig{
 			Workers: 1,
 		}
-		go filterMatcher(ctx, cfg, blocksCh, addrIdx, eventsCh)
+		go filterMatcher(ctx, cfg, blocksCh, addrIdx, eventsCh, nil)
 		close(blocksCh)
 	})
 }
@@ -129,7 +163,7 @@ func TestProcessBlock(t *testing.T) {
 				},
 			},
 		}
-		processBlock(ctx, block, addrIdx, eventsCh)
+		processBlock(ctx, block, addrIdx, eventsCh, "", nil)
 		select {
 		case event := <-eventsCh:
 			if event.UserID != "vitalik" {
@@ -157,7 +191,7 @@ func TestProcessBlock(t *testing.T) {
 				},
 			},
 		}
-		processBlock(ctx, block, addrIdx, eventsCh)
+		processBlock(ctx, block, addrIdx, eventsCh, "", nil)
 		select {
 		case event := <-eventsCh:
 			if event.UserID != "binance" {
@@ -185,7 +219,7 @@ func TestProcessBlock(t *testing.T) {
 				},
 			},
 		}
-		processBlock(ctx, block, addrIdx, eventsCh)
+		processBlock(ctx, block, addrIdx, eventsCh, "", nil)
 		select {
 		case <-eventsCh:
 			t.Error("Expected no events but got one")
@@ -209,7 +243,7 @@ func TestProcessBlock(t *testing.T) {
 				},
 			},
 		}
-		processBlock(ctx, block, addrIdx, eventsCh)
+		processBlock(ctx, block, addrIdx, eventsCh, "", nil)
 		select {
 		case event := <-eventsCh:
 			if event.UserID != "vitalik" {
@@ -237,7 +271,7 @@ func TestProcessBlock(t *testing.T) {
 				},
 			},
 		}
-		processBlock(ctx, block, addrIdx, eventsCh)
+		processBlock(ctx, block, addrIdx, eventsCh, "", nil)
 		select {
 		case <-eventsCh:
 			t.Error("Expected no events due to invalid block number but got one")
@@ -247,6 +281,229 @@ func TestProcessBlock(t *testing.T) {
 	})
 }
 
+func TestProcessBlock_Progress(t *testing.T) {
+	t.Run("process_block_marks_block_without_events_as_done", func(t *testing.T) {
+		ctx := context.Background()
+		eventsCh := make(chan Event, 1)
+		progress := newProgressTracker(12345)
+		processBlock(ctx, jsonrpc.Block{Number: "0x3039"}, newMockAddressIndex(), eventsCh, "", progress)
+		n, ok := progress.watermark()
+		if !ok || n != 12345 {
+			t.Errorf("Expected watermark 12345, got %d", n)
+		}
+	})
+	t.Run("process_block_waits_for_event_ack", func(t *testing.T) {
+		ctx := context.Background()
+		eventsCh := make(chan Event, 1)
+		progress := newProgressTracker(12345)
+		toAddr := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+		block := jsonrpc.Block{
+			Number: "0x3039",
+			Transactions: []jsonrpc.Transaction{
+				{From: "0x1234567890123456789012345678901234567890", To: &toAddr, Hash: "0xtx123"},
+			},
+		}
+		processBlock(ctx, block, newMockAddressIndex(), eventsCh, "", progress)
+		if _, ok := progress.watermark(); ok {
+			t.Error("Expected no watermark before the event is acked")
+		}
+		progress.ack((<-eventsCh).BlockNumber)
+		if n, ok := progress.watermark(); !ok || n != 12345 {
+			t.Errorf("Expected watermark 12345, got %d", n)
+		}
+	})
+}
+
+func TestMatchLogs(t *testing.T) {
+	transfer := func(from, to string) jsonrpc.Log {
+		return jsonrpc.Log{
+			Address:         "0xdAC17F958D2ee523a2206206994597C13D831ec7",
+			Topics:          []string{jsonrpc.TransferTopic, "0x000000000000000000000000" + from[2:], "0x000000000000000000000000" + to[2:]},
+			Data:            "0x00000000000000000000000000000000000000000000000000000000000f4240",
+			TransactionHash: "0xtx123",
+			LogIndex:        "0x1",
+		}
+	}
+
+	t.Run("match_logs_token_deposit", func(t *testing.T) {
+		block := jsonrpc.Block{
+			Number: "0x3039",
+			Hash:   "0xabc123",
+			Logs:   []jsonrpc.Log{transfer("0x1234567890123456789012345678901234567890", "0xd8da6bf26964af9d7eed9e03e53415d37aa96045")},
+		}
+		events := matchBlock(block, newMockAddressIndex())
+		if len(events) != 1 {
+			t.Fatalf("Expected 1 event, got %d", len(events))
+		}
+		ev := events[0]
+		if ev.Type != EventTypeERC20 || ev.UserID != "vitalik" {
+			t.Errorf("Unexpected event %+v", ev)
+		}
+		if ev.TokenAddress != "0xdac17f958d2ee523a2206206994597c13d831ec7" || ev.TokenAmount != "0xf4240" {
+			t.Errorf("Unexpected token data %+v", ev)
+		}
+		if ev.BlockNumber != 12345 || ev.LogIndex != "0x1" || ev.TxHash != "0xtx123" {
+			t.Errorf("Unexpected log data %+v", ev)
+		}
+	})
+
+	t.Run("match_logs_both_sides", func(t *testing.T) {
+		block := jsonrpc.Block{
+			Number: "0x3039",
+			Logs:   []jsonrpc.Log{transfer("0x28c6c06298d514db089934071355e5743bf21d60", "0xd8da6bf26964af9d7eed9e03e53415d37aa96045")},
+		}
+		events := matchBlock(block, newMockAddressIndex())
+		if len(events) != 2 {
+			t.Fatalf("Expected 2 events, got %d", len(events))
+		}
+		if events[0].UserID != "binance2" || events[1].UserID != "vitalik" {
+			t.Errorf("Unexpected users %s and %s", events[0].UserID, events[1].UserID)
+		}
+	})
+
+	t.Run("match_logs_ignores_removed_logs", func(t *testing.T) {
+		l := transfer("0x1234567890123456789012345678901234567890", "0xd8da6bf26964af9d7eed9e03e53415d37aa96045")
+		l.Removed = true
+		block := jsonrpc.Block{Number: "0x3039", Logs: []jsonrpc.Log{l}}
+		if events := matchBlock(block, newMockAddressIndex()); len(events) != 0 {
+			t.Errorf("Expected no events, got %d", len(events))
+		}
+	})
+}
+
+func TestMatchInternalTransfers(t *testing.T) {
+	t.Run("match_internal_transfers_payout", func(t *testing.T) {
+		block := jsonrpc.Block{
+			Number: "0x3039",
+			Hash:   "0xabc123",
+			InternalTransfers: []jsonrpc.InternalTransfer{
+				{TxHash: "0xtx123", Type: "CALL", From: "0x1234567890123456789012345678901234567890", To: "0xD8dA6BF26964aF9D7eEd9e03E53415D37aA96045", Value: "0xde0b6b3a7640000", Path: "0.1"},
+			},
+		}
+		events := matchBlock(block, newMockAddressIndex())
+		if len(events) != 1 {
+			t.Fatalf("Expected 1 event, got %d", len(events))
+		}
+		ev := events[0]
+		if ev.Type != EventTypeNative || ev.UserID != "vitalik" || !ev.Internal || ev.TracePath != "0.1" {
+			t.Errorf("Unexpected event %+v", ev)
+		}
+		if ev.AmountWei != "0xde0b6b3a7640000" || ev.BlockNumber != 12345 || ev.TxHash != "0xtx123" {
+			t.Errorf("Unexpected transfer data %+v", ev)
+		}
+	})
+
+	t.Run("match_internal_transfers_both_sides", func(t *testing.T) {
+		block := jsonrpc.Block{
+			Number: "0x3039",
+			InternalTransfers: []jsonrpc.InternalTransfer{
+				{TxHash: "0xtx123", From: "0x28c6c06298d514db089934071355e5743bf21d60", To: "0xd8da6bf26964af9d7eed9e03e53415d37aa96045", Value: "0x1", Path: "0"},
+			},
+		}
+		events := matchBlock(block, newMockAddressIndex())
+		if len(events) != 2 {
+			t.Fatalf("Expected 2 events, got %d", len(events))
+		}
+		if events[0].UserID != "binance2" || events[1].UserID != "vitalik" {
+			t.Errorf("Unexpected users %s and %s", events[0].UserID, events[1].UserID)
+		}
+	})
+}
+
+func TestMatchBlock_Receipts(t *testing.T) {
+	t.Run("match_block_applies_receipts", func(t *testing.T) {
+		to := "0xd8da6bf26964af9d7eed9e03e53415d37aa96045"
+		contract := "0xABC0000000000000000000000000000000000001"
+		block := jsonrpc.Block{
+			Number: "0x3039",
+			Transactions: []jsonrpc.Transaction{
+				{Hash: "0xtx1", From: "0x1234567890123456789012345678901234567890", To: &to, Value: "0x1"},
+				{Hash: "0xtx2", From: to, Value: "0x0"},
+			},
+			Receipts: map[string]jsonrpc.Receipt{
+				"0xtx1": {TransactionHash: "0xtx1", Status: jsonrpc.ReceiptStatusFailed, GasUsed: "0x5208", EffectiveGasPrice: "0x3b9aca00"},
+				"0xtx2": {TransactionHash: "0xtx2", Status: jsonrpc.ReceiptStatusSuccess, GasUsed: "0x5208", ContractAddress: &contract},
+			},
+		}
+		events := matchBlock(block, newMockAddressIndex())
+		if len(events) != 2 {
+			t.Fatalf("Expected 2 events, got %d", len(events))
+		}
+		if events[0].TxStatus != TxStatusFailed || events[0].GasUsed != "0x5208" || events[0].EffectiveGasPrice != "0x3b9aca00" || events[0].FeeWei != "0x1319718a5000" {
+			t.Errorf("Unexpected receipt data %+v", events[0])
+		}
+		if events[1].TxStatus != TxStatusSuccess || events[1].ContractAddress != "0xabc0000000000000000000000000000000000001" || events[1].FeeWei != "" {
+			t.Errorf("Unexpected receipt data %+v", events[1])
+		}
+	})
+
+	t.Run("match_block_without_receipts", func(t *testing.T) {
+		to := "0xd8da6bf26964af9d7eed9e03e53415d37aa96045"
+		block := jsonrpc.Block{
+			Number:       "0x3039",
+			Transactions: []jsonrpc.Transaction{{Hash: "0xtx1", From: "0x1234567890123456789012345678901234567890", To: &to, Value: "0x1"}},
+		}
+		events := matchBlock(block, newMockAddressIndex())
+		if len(events) != 1 || events[0].TxStatus != "" {
+			t.Errorf("Unexpected events %+v", events)
+		}
+	})
+}
+
+func TestMatchBlock_Timestamp(t *testing.T) {
+	t.Run("match_block_sets_the_block_time", func(t *testing.T) {
+		to := "0xd8da6bf26964af9d7eed9e03e53415d37aa96045"
+		block := jsonrpc.Block{
+			Number:       "0x3039",
+			Timestamp:    "0x6553f100",
+			Transactions: []jsonrpc.Transaction{{Hash: "0xtx1", From: "0x1234567890123456789012345678901234567890", To: &to, Value: "0x1"}},
+		}
+		events := matchBlock(block, newMockAddressIndex())
+		if len(events) != 1 {
+			t.Fatalf("Expected 1 event, got %d", len(events))
+		}
+		for _, ev := range events {
+			if ev.BlockTime != 1700000000 {
+				t.Errorf("Expected block time 1700000000, got %d", ev.BlockTime)
+			}
+		}
+	})
+}
+
+func TestRevertBlock(t *testing.T) {
+	t.Run("revert_block_flags_events_as_reverted", func(t *testing.T) {
+		ctx := context.Background()
+		eventsCh := make(chan Event, 1)
+		addrIdx := newMockAddressIndex()
+		toAddr := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+		block := jsonrpc.Block{
+			Number: "0x3039",
+			Hash:   "0xabc123",
+			Transactions: []jsonrpc.Transaction{
+				{
+					From:  "0x1234567890123456789012345678901234567890",
+					To:    &toAddr,
+					Value: "0xde0b6b3a7640000",
+					Hash:  "0xtx123",
+				},
+			},
+		}
+		revertBlock(ctx, block, addrIdx, eventsCh, nil)
+		select {
+		case event := <-eventsCh:
+			if event.Status != EventStatusReverted {
+				t.Errorf("Expected status '%s', got '%s'", EventStatusReverted, event.Status)
+			}
+			if event.BlockHash != "0xabc123" {
+				t.Errorf("Expected block hash '0xabc123', got '%s'", event.BlockHash)
+			}
+		case <-time.After(10 * time.Millisecond):
+			t.Error("Expected event but got timeout")
+		}
+		close(eventsCh)
+	})
+}
+
 func TestEmitEvent(t *testing.T) {
 	t.Run("emit_event_success", func(t *testing.T) {
 		ctx := context.Background()
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"log"
 	"math/rand/v2"
 	"time"
@@ -10,10 +11,26 @@ import (
 	"github.com/jmsilvadev/de-crypto/pkg/jsonrpc"
 )
 
-func headMonitor(ctx context.Context, cfg config.HeadMonitorConfig, rpc jsonrpc.JsonRpcClient, headsCh chan<- uint64) {
+var errNotEnoughConfirmations = errors.New("head is below the confirmation depth")
+
+// headMonitor sends the heights to fetch up to the head. With a subscriber the heads are pushed
+// and we only poll the node while the subscription is down. We never go more than MaxAhead
+// heights past the first one that is not complete, the blocks after a height that keeps
+// failing wait in memory for it.
+func headMonitor(ctx context.Context, cfg config.HeadMonitorConfig, rpc jsonrpc.JsonRpcClient, sub jsonrpc.HeadSubscriber, headsCh chan<- uint64, progress *progressTracker) {
 	log.Println("Starting head monitor")
 
+	var pushCh chan uint64
+	if sub != nil {
+		pushCh = make(chan uint64, 1)
+		go sub.SubscribeNewHeads(ctx, pushCh)
+	}
+
 	nextHeight := cfg.StartFrom
+	// the last upper bound we got, used to keep enqueueing between the pushes
+	var bound uint64
+	haveBound := false
+
 	timer := time.NewTimer(0)
 	defer timer.Stop()
 
@@ -21,22 +38,28 @@ func headMonitor(ctx context.Context, cfg config.HeadMonitorConfig, rpc jsonrpc.
 		select {
 		case <-ctx.Done():
 			return
+		case n := <-pushCh:
+			head, err := n, error(nil)
+			if cfg.BlockTag != "" && cfg.BlockTag != jsonrpc.BlockTagLatest {
+				// the subscription only says there is a new block, the tag block we have to ask
+				head, err = currentHead(ctx, cfg, rpc)
+			}
+			if b, err := upperBound(cfg, head, err); err == nil {
+				bound, haveBound = b, true
+				if !enqueueHeights(ctx, cfg, bound, &nextHeight, headsCh, progress) {
+					return
+				}
+			}
 		case <-timer.C:
-			head, err := rpc.GetCurrentBlockNumber(ctx)
-			if err == nil {
-				sent := 0
-				for nextHeight <= head && sent < cfg.MaxEnqueuePerTick {
-					select {
-					case <-ctx.Done():
-						return
-					case headsCh <- nextHeight:
-						nextHeight++
-						sent++
-					default:
-						sent = cfg.MaxEnqueuePerTick
-					}
+			if sub == nil || !sub.Connected() || !haveBound {
+				head, err := currentHead(ctx, cfg, rpc)
+				if b, err := upperBound(cfg, head, err); err == nil {
+					bound, haveBound = b, true
 				}
 			}
+			if haveBound && !enqueueHeights(ctx, cfg, bound, &nextHeight, headsCh, progress) {
+				return
+			}
 
 			// lets add a jit to avoid have the amount of request at the same time
 			// we can also reduce this time if the queue is full but i'll maintain the code simpler
@@ -46,6 +69,50 @@ func headMonitor(ctx context.Context, cfg config.HeadMonitorConfig, rpc jsonrpc.
 	}
 }
 
+// upperBound is the last height we can process for the head
+func upperBound(cfg config.HeadMonitorConfig, head uint64, err error) (uint64, error) {
+	// in the dual mode we process at inclusion and the reorg validator sends the confirmations
+	if err != nil || cfg.EmitUnconfirmed {
+		return head, err
+	}
+	if head < cfg.ConfirmationDepth {
+		return 0, errNotEnoughConfirmations
+	}
+	return head - cfg.ConfirmationDepth, nil
+}
+
+// enqueueHeights sends the next heights up to the bound, it returns false only when the context is done
+func enqueueHeights(ctx context.Context, cfg config.HeadMonitorConfig, bound uint64, nextHeight *uint64, headsCh chan<- uint64, progress *progressTracker) bool {
+	// the reorg validator logs the height it is waiting for
+	if first, ok := progress.firstPending(); ok && cfg.MaxAhead > 0 && first+cfg.MaxAhead < bound {
+		bound = first + cfg.MaxAhead
+	}
+
+	sent := 0
+	for *nextHeight <= bound && sent < cfg.MaxEnqueuePerTick {
+		select {
+		case <-ctx.Done():
+			return false
+		case headsCh <- *nextHeight:
+			*nextHeight++
+			sent++
+		default:
+			sent = cfg.MaxEnqueuePerTick
+		}
+	}
+	return true
+}
+
+// currentHead returns the upper bound to process, the latest head or the safe/finalized block
+func currentHead(ctx context.Context, cfg config.HeadMonitorConfig, rpc jsonrpc.JsonRpcClient) (uint64, error) {
+	switch cfg.BlockTag {
+	case "", jsonrpc.BlockTagLatest:
+		return rpc.GetCurrentBlockNumber(ctx)
+	default:
+		return rpc.GetBlockNumberByTag(ctx, cfg.BlockTag)
+	}
+}
+
 func withJitter(base time.Duration, jitter float64) time.Duration {
 	if jitter <= 0 {
 		return base
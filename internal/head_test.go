@@ -2,6 +2,7 @@ package internal
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -23,7 +24,7 @@ func TestHeadMonitor(t *testing.T) {
 			PollInterval: 50 * time.Millisecond,
 		}
 
-		go headMonitor(ctx, cfg, rpcClient, headCh)
+		go headMonitor(ctx, cfg, rpcClient, nil, headCh, nil)
 
 		<-ctx.Done()
 	})
@@ -40,7 +41,7 @@ func TestHeadMonitor(t *testing.T) {
 			PollInterval: 50 * time.Millisecond,
 		}
 
-		go headMonitor(ctx, cfg, rpcClient, headCh)
+		go headMonitor(ctx, cfg, rpcClient, nil, headCh, nil)
 
 		<-ctx.Done()
 	})
@@ -58,7 +59,7 @@ func TestHeadMonitor(t *testing.T) {
 			MaxEnqueuePerTick: 1,
 		}
 
-		go headMonitor(ctx, cfg, rpcClient, headCh)
+		go headMonitor(ctx, cfg, rpcClient, nil, headCh, nil)
 
 		<-ctx.Done()
 	})
@@ -74,7 +75,7 @@ func TestHeadMonitor(t *testing.T) {
 			PollInterval: 50 * time.Millisecond,
 		}
 
-		go headMonitor(ctx, cfg, rpcClient, headCh)
+		go headMonitor(ctx, cfg, rpcClient, nil, headCh, nil)
 
 		cancel()
 
@@ -82,6 +83,122 @@ func TestHeadMonitor(t *testing.T) {
 	})
 }
 
+func TestHeadMonitor_ConfirmationDepth(t *testing.T) {
+	drain := func(headCh chan uint64) []uint64 {
+		var heights []uint64
+		for {
+			select {
+			case h := <-headCh:
+				heights = append(heights, h)
+			case <-time.After(100 * time.Millisecond):
+				return heights
+			}
+		}
+	}
+
+	t.Run("head_monitor_waits_for_confirmation_depth", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		headCh := make(chan uint64, 10)
+
+		cfg := config.HeadMonitorConfig{
+			PollInterval:      time.Second,
+			StartFrom:         98,
+			MaxEnqueuePerTick: 10,
+			ConfirmationDepth: 5,
+		}
+
+		go headMonitor(ctx, cfg, &mockRpcClient{head: 105}, nil, headCh, nil)
+
+		assert.Equal(t, []uint64{98, 99, 100}, drain(headCh))
+	})
+
+	t.Run("head_monitor_head_below_confirmation_depth", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		headCh := make(chan uint64, 10)
+
+		cfg := config.HeadMonitorConfig{
+			PollInterval:      time.Second,
+			MaxEnqueuePerTick: 10,
+			ConfirmationDepth: 12,
+		}
+
+		go headMonitor(ctx, cfg, &mockRpcClient{head: 3}, nil, headCh, nil)
+
+		assert.Empty(t, drain(headCh))
+	})
+
+	t.Run("head_monitor_dual_mode_enqueues_up_to_head", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		headCh := make(chan uint64, 10)
+
+		cfg := config.HeadMonitorConfig{
+			PollInterval:      time.Second,
+			StartFrom:         103,
+			MaxEnqueuePerTick: 10,
+			ConfirmationDepth: 5,
+			EmitUnconfirmed:   true,
+		}
+
+		go headMonitor(ctx, cfg, &mockRpcClient{head: 105}, nil, headCh, nil)
+
+		assert.Equal(t, []uint64{103, 104, 105}, drain(headCh))
+	})
+	t.Run("head_monitor_stops_ahead_of_the_first_pending_height", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		headCh := make(chan uint64, 20)
+		progress := newProgressTracker(100)
+
+		cfg := config.HeadMonitorConfig{
+			PollInterval:      20 * time.Millisecond,
+			StartFrom:         100,
+			MaxEnqueuePerTick: 20,
+			MaxAhead:          3,
+		}
+
+		go headMonitor(ctx, cfg, &mockRpcClient{head: 110}, nil, headCh, progress)
+
+		// 100 keeps failing, nothing after 103 is fetched
+		assert.Equal(t, []uint64{100, 101, 102, 103}, drain(headCh))
+
+		progress.markDone(100)
+		assert.Equal(t, []uint64{104}, drain(headCh))
+	})
+}
+
+func TestCurrentHead(t *testing.T) {
+	rpc := &mockRpcClient{head: 110, tags: map[string]uint64{
+		jsonrpc.BlockTagSafe:      105,
+		jsonrpc.BlockTagFinalized: 90,
+	}}
+
+	t.Run("current_head_latest", func(t *testing.T) {
+		head, err := currentHead(context.Background(), config.HeadMonitorConfig{}, rpc)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(110), head)
+	})
+
+	t.Run("current_head_safe", func(t *testing.T) {
+		head, err := currentHead(context.Background(), config.HeadMonitorConfig{BlockTag: jsonrpc.BlockTagSafe}, rpc)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(105), head)
+	})
+
+	t.Run("current_head_finalized", func(t *testing.T) {
+		head, err := currentHead(context.Background(), config.HeadMonitorConfig{BlockTag: jsonrpc.BlockTagFinalized}, rpc)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(90), head)
+	})
+
+	t.Run("current_head_unknown_tag", func(t *testing.T) {
+		_, err := currentHead(context.Background(), config.HeadMonitorConfig{BlockTag: "pending"}, rpc)
+		assert.Error(t, err)
+	})
+}
+
 func TestWithJitter(t *testing.T) {
 	t.Run("with_jitter_no_jitter", func(t *testing.T) {
 		base := 100 * time.Millisecond
@@ -166,3 +283,115 @@ func TestResetTimer(t *testing.T) {
 		}
 	})
 }
+
+type mockHeadSubscriber struct {
+	heads     []uint64
+	connected atomic.Bool
+}
+
+func (m *mockHeadSubscriber) SubscribeNewHeads(ctx context.Context, heads chan<- uint64) {
+	for _, h := range m.heads {
+		select {
+		case <-ctx.Done():
+			return
+		case heads <- h:
+		}
+	}
+}
+
+func (m *mockHeadSubscriber) Connected() bool {
+	return m.connected.Load()
+}
+
+func TestHeadMonitor_Subscription(t *testing.T) {
+	drain := func(headCh chan uint64) []uint64 {
+		var heights []uint64
+		for {
+			select {
+			case h := <-headCh:
+				heights = append(heights, h)
+			case <-time.After(100 * time.Millisecond):
+				return heights
+			}
+		}
+	}
+
+	t.Run("head_monitor_uses_pushed_heads", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		headCh := make(chan uint64, 10)
+		rpc := &mockRpcClient{head: 100}
+		sub := &mockHeadSubscriber{heads: []uint64{102, 103}}
+
+		cfg := config.HeadMonitorConfig{
+			PollInterval:      time.Hour,
+			StartFrom:         100,
+			MaxEnqueuePerTick: 10,
+		}
+
+		go headMonitor(ctx, cfg, rpc, sub, headCh, nil)
+
+		assert.Equal(t, []uint64{100, 101, 102, 103}, drain(headCh))
+	})
+
+	t.Run("head_monitor_does_not_poll_while_connected", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		headCh := make(chan uint64, 10)
+		rpc := &mockRpcClient{head: 100}
+		sub := &mockHeadSubscriber{heads: []uint64{105}}
+		sub.connected.Store(true)
+
+		cfg := config.HeadMonitorConfig{
+			PollInterval:      10 * time.Millisecond,
+			StartFrom:         100,
+			MaxEnqueuePerTick: 2,
+		}
+
+		go headMonitor(ctx, cfg, rpc, sub, headCh, nil)
+
+		// the ticks keep enqueueing from the pushed head
+		assert.Equal(t, []uint64{100, 101, 102, 103, 104, 105}, drain(headCh))
+		rpc.mu.Lock()
+		defer rpc.mu.Unlock()
+		// only the first tick, before the first push, may poll
+		assert.LessOrEqual(t, rpc.calls, 1)
+	})
+
+	t.Run("head_monitor_polls_when_disconnected", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		headCh := make(chan uint64, 10)
+		rpc := &mockRpcClient{head: 102}
+		sub := &mockHeadSubscriber{}
+
+		cfg := config.HeadMonitorConfig{
+			PollInterval:      10 * time.Millisecond,
+			StartFrom:         100,
+			MaxEnqueuePerTick: 10,
+		}
+
+		go headMonitor(ctx, cfg, rpc, sub, headCh, nil)
+
+		assert.Equal(t, []uint64{100, 101, 102}, drain(headCh))
+	})
+
+	t.Run("head_monitor_asks_the_tag_on_push", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		headCh := make(chan uint64, 10)
+		rpc := &mockRpcClient{tags: map[string]uint64{jsonrpc.BlockTagFinalized: 101}}
+		sub := &mockHeadSubscriber{heads: []uint64{110}}
+
+		cfg := config.HeadMonitorConfig{
+			PollInterval:      time.Hour,
+			StartFrom:         100,
+			MaxEnqueuePerTick: 10,
+			BlockTag:          jsonrpc.BlockTagFinalized,
+		}
+
+		go headMonitor(ctx, cfg, rpc, sub, headCh, nil)
+
+		assert.Equal(t, []uint64{100, 101}, drain(headCh))
+	})
+}
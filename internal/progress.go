@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"context"
+	"sync"
+)
+
+// progressTracker keeps which blocks were fully processed, a block is complete when the
+// filter matcher is done with it and every event sent for it was acknowledged by the sink.
+// The watermark is the highest contiguous complete height, so it is safe to checkpoint.
+type progressTracker struct {
+	mu     sync.Mutex
+	start  uint64
+	next   uint64
+	done   map[uint64]bool
+	events map[uint64]int
+	// events of heights the watermark already passed, a reorg sends the reverted events and
+	// the replacements of blocks that may be checkpointed already
+	late map[uint64]int
+	// the blocks the reorg validator sent to the filter matcher and it didn't process yet
+	filtering map[uint64]*filtering
+}
+
+type filtering struct {
+	blocks int
+	// closed when the filter matcher processed all of them
+	done chan struct{}
+}
+
+func newProgressTracker(start uint64) *progressTracker {
+	return &progressTracker{
+		start:     start,
+		next:      start,
+		done:      make(map[uint64]bool),
+		events:    make(map[uint64]int),
+		late:      make(map[uint64]int),
+		filtering: make(map[uint64]*filtering),
+	}
+}
+
+// add registers events that will be sent for the block, it must be called before sending them
+func (p *progressTracker) add(n uint64, events int) {
+	if p == nil || events == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n < p.next {
+		p.late[n] += events
+		return
+	}
+	p.events[n] += events
+}
+
+// markDone is called by the filter matcher when all the events of the block were sent
+func (p *progressTracker) markDone(n uint64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n < p.next {
+		return
+	}
+	p.done[n] = true
+	p.advance()
+}
+
+// ack is called by the sink for every event that was published or kept in the dlq
+func (p *progressTracker) ack(n uint64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n < p.next {
+		// the events of the height were all acked before it was passed, so it is a late one
+		if p.late[n] > 0 {
+			p.late[n]--
+			if p.late[n] == 0 {
+				delete(p.late, n)
+			}
+		}
+		return
+	}
+	if p.events[n] == 0 {
+		return
+	}
+	p.events[n]--
+	if p.events[n] == 0 {
+		delete(p.events, n)
+	}
+	p.advance()
+}
+
+// forwarded is called by the reorg validator for every block it sends to the filter matcher
+func (p *progressTracker) forwarded(n uint64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f := p.filtering[n]
+	if f == nil {
+		f = &filtering{done: make(chan struct{})}
+		p.filtering[n] = f
+	}
+	f.blocks++
+}
+
+// filtered is called by the filter matcher when it sent the events of a block
+func (p *progressTracker) filtered(n uint64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f := p.filtering[n]
+	if f == nil {
+		return
+	}
+	f.blocks--
+	if f.blocks == 0 {
+		close(f.done)
+		delete(p.filtering, n)
+	}
+}
+
+// waitFiltered waits until the filter matcher sent the events of every block of the height
+// it got. The reverted and confirmed events of a block are sent by the reorg validator, they
+// can't go before the events they refer to. It returns false only when the context is done.
+func (p *progressTracker) waitFiltered(ctx context.Context, n uint64) bool {
+	if p == nil {
+		return ctx.Err() == nil
+	}
+	p.mu.Lock()
+	f := p.filtering[n]
+	p.mu.Unlock()
+	if f == nil {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-f.done:
+		return true
+	}
+}
+
+// firstPending returns the lowest height that is not complete yet
+func (p *progressTracker) firstPending() (uint64, bool) {
+	if p == nil {
+		return 0, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.next, true
+}
+
+// watermark returns the highest contiguous complete height, false if none is complete yet.
+// While there are late events it goes back to the height before the lowest of them, the
+// checkpoint moves back to the fork point so a crash processes the new blocks again.
+func (p *progressTracker) watermark() (uint64, bool) {
+	if p == nil {
+		return 0, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w, ok, _ := p.lowest()
+	return w, ok
+}
+
+// checkpoint returns the watermark when it must replace the saved checkpoint. It only goes
+// back for the late events, after a restart from before the saved checkpoint (the dual mode
+// starts again from the depth) we keep the saved one until the watermark passes it.
+func (p *progressTracker) checkpoint(saved uint64) (uint64, bool) {
+	if p == nil {
+		return 0, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w, ok, late := p.lowest()
+	if !ok || w == saved || (w < saved && !late) {
+		return 0, false
+	}
+	return w, true
+}
+
+// lowest is the watermark, late says if the late events moved it back
+func (p *progressTracker) lowest() (uint64, bool, bool) {
+	if p.next == p.start {
+		return 0, false, false
+	}
+	w, late := p.next-1, false
+	for n := range p.late {
+		if n == 0 {
+			return 0, false, true
+		}
+		if n <= w {
+			w, late = n-1, true
+		}
+	}
+	return w, true, late
+}
+
+func (p *progressTracker) advance() {
+	for p.done[p.next] && p.events[p.next] == 0 {
+		delete(p.done, p.next)
+		delete(p.events, p.next)
+		p.next++
+	}
+}
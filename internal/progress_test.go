@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressTracker(t *testing.T) {
+	t.Run("progress_tracker_empty", func(t *testing.T) {
+		p := newProgressTracker(100)
+
+		_, ok := p.watermark()
+		assert.False(t, ok)
+	})
+
+	t.Run("progress_tracker_contiguous_blocks", func(t *testing.T) {
+		p := newProgressTracker(100)
+		p.markDone(100)
+		p.markDone(101)
+
+		n, ok := p.watermark()
+		assert.True(t, ok)
+		assert.Equal(t, uint64(101), n)
+	})
+
+	t.Run("progress_tracker_waits_for_gap", func(t *testing.T) {
+		p := newProgressTracker(100)
+		p.markDone(100)
+		p.markDone(102)
+		p.markDone(103)
+
+		n, _ := p.watermark()
+		assert.Equal(t, uint64(100), n)
+
+		p.markDone(101)
+		n, _ = p.watermark()
+		assert.Equal(t, uint64(103), n)
+	})
+
+	t.Run("progress_tracker_waits_for_acks", func(t *testing.T) {
+		p := newProgressTracker(100)
+		p.add(100, 2)
+		p.markDone(100)
+
+		_, ok := p.watermark()
+		assert.False(t, ok)
+
+		p.ack(100)
+		_, ok = p.watermark()
+		assert.False(t, ok)
+
+		p.ack(100)
+		n, ok := p.watermark()
+		assert.True(t, ok)
+		assert.Equal(t, uint64(100), n)
+	})
+
+	t.Run("progress_tracker_acks_before_done", func(t *testing.T) {
+		p := newProgressTracker(100)
+		p.add(100, 1)
+		p.ack(100)
+		p.markDone(100)
+
+		n, ok := p.watermark()
+		assert.True(t, ok)
+		assert.Equal(t, uint64(100), n)
+	})
+
+	t.Run("progress_tracker_ignores_completed_heights", func(t *testing.T) {
+		p := newProgressTracker(100)
+		p.markDone(100)
+		p.add(100, 1)
+		p.ack(100)
+		p.ack(101)
+		p.markDone(99)
+
+		n, _ := p.watermark()
+		assert.Equal(t, uint64(100), n)
+
+		p.markDone(101)
+		n, _ = p.watermark()
+		assert.Equal(t, uint64(101), n)
+	})
+
+	t.Run("progress_tracker_goes_back_for_late_events", func(t *testing.T) {
+		p := newProgressTracker(100)
+		for n := uint64(100); n <= 103; n++ {
+			p.markDone(n)
+		}
+		// a reorg reverts 101 and 102 after the checkpoint passed them
+		p.add(101, 2)
+		p.add(102, 1)
+
+		n, _ := p.watermark()
+		assert.Equal(t, uint64(100), n)
+		n, ok := p.checkpoint(103)
+		assert.True(t, ok)
+		assert.Equal(t, uint64(100), n)
+
+		p.ack(101)
+		p.ack(101)
+		n, _ = p.watermark()
+		assert.Equal(t, uint64(101), n)
+
+		p.ack(102)
+		n, _ = p.watermark()
+		assert.Equal(t, uint64(103), n)
+		_, ok = p.checkpoint(103)
+		assert.False(t, ok)
+	})
+
+	t.Run("progress_tracker_keeps_the_saved_checkpoint_after_a_restart", func(t *testing.T) {
+		// the dual mode starts again from the depth before the saved checkpoint
+		p := newProgressTracker(90)
+		p.markDone(90)
+
+		_, ok := p.checkpoint(100)
+		assert.False(t, ok)
+		for n := uint64(91); n <= 101; n++ {
+			p.markDone(n)
+		}
+		n, ok := p.checkpoint(100)
+		assert.True(t, ok)
+		assert.Equal(t, uint64(101), n)
+	})
+
+	t.Run("progress_tracker_waits_for_the_filter_matcher", func(t *testing.T) {
+		p := newProgressTracker(100)
+		ctx := context.Background()
+		assert.True(t, p.waitFiltered(ctx, 100))
+
+		p.forwarded(100)
+		p.forwarded(100)
+		p.filtered(100)
+		waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		assert.False(t, p.waitFiltered(waitCtx, 100))
+
+		p.filtered(100)
+		assert.True(t, p.waitFiltered(ctx, 100))
+	})
+
+	t.Run("progress_tracker_nil_is_safe", func(t *testing.T) {
+		var p *progressTracker
+		p.add(1, 1)
+		p.markDone(1)
+		p.ack(1)
+		p.forwarded(1)
+		p.filtered(1)
+		_, ok := p.checkpoint(0)
+		assert.False(t, ok)
+		assert.True(t, p.waitFiltered(context.Background(), 1))
+
+		_, ok = p.watermark()
+		assert.False(t, ok)
+	})
+}
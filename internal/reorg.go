@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jmsilvadev/de-crypto/pkg/address"
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/jsonrpc"
+	"github.com/jmsilvadev/de-crypto/pkg/utils"
+)
+
+// if the chain keeps changing while we are rewinding we give up after some attempts
+// and accept the block, the next one will trigger the validation again anyway
+const maxReorgAttempts = 3
+
+// chainWindow keeps the last validated blocks by height
+type chainWindow struct {
+	size   int
+	blocks map[uint64]jsonrpc.Block
+}
+
+func newChainWindow(size int) *chainWindow {
+	if size <= 0 {
+		size = 1
+	}
+	return &chainWindow{size: size, blocks: make(map[uint64]jsonrpc.Block, size+1)}
+}
+
+func (w *chainWindow) get(n uint64) (jsonrpc.Block, bool) {
+	b, ok := w.blocks[n]
+	return b, ok
+}
+
+func (w *chainWindow) put(n uint64, b jsonrpc.Block) {
+	w.blocks[n] = b
+	if n >= uint64(w.size) {
+		for h := range w.blocks {
+			if h <= n-uint64(w.size) {
+				delete(w.blocks, h)
+			}
+		}
+	}
+}
+
+// reorgValidator sits between the block fetcher and the filter matcher. The fetcher workers
+// deliver blocks out of order so we buffer them and release in height order, checking every
+// block parentHash against the hash we have for the previous height. On a mismatch we walk back
+// until the fork point, send reverted events for the orphaned blocks and forward the canonical ones.
+func reorgValidator(ctx context.Context, cfg config.ReorgConfig, rpc jsonrpc.JsonRpcClient, addrIdx address.AddressIndex, in <-chan jsonrpc.Block, out chan<- jsonrpc.Block, eventsCh chan<- Event, progress *progressTracker) {
+	log.Println("Starting reorg validator")
+
+	maxPending := cfg.MaxPending
+	if maxPending <= 0 {
+		maxPending = config.DefaultReorgMaxPending
+	}
+
+	// we need to keep the blocks until they are confirmed
+	size := cfg.Window
+	if depth := int(cfg.ConfirmationDepth) + 1; depth > size {
+		size = depth
+	}
+	window := newChainWindow(size)
+	pending := make(map[uint64]jsonrpc.Block)
+	next := cfg.StartFrom
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case b, ok := <-in:
+			if !ok {
+				return
+			}
+			n, err := utils.ParseHexUint64(b.Number)
+			if err != nil {
+				log.Println("reorg:", err)
+				continue
+			}
+			if n < next {
+				continue
+			}
+			pending[n] = b
+
+			// releases every buffered block that is next in height
+			for {
+				blk, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				if !validateBlock(ctx, cfg, rpc, addrIdx, window, next, blk, out, eventsCh, progress) {
+					return
+				}
+				next++
+			}
+
+			// the fetcher never drops a height, so we wait for it even if it takes long
+			if len(pending) > maxPending && len(pending)%maxPending == 1 {
+				log.Printf("reorg: waiting for block %d, %d blocks buffered", next, len(pending))
+			}
+		}
+	}
+}
+
+// validateBlock checks the block against the window, handles a reorg if needed and forwards it.
+// It returns false only when the context is done.
+func validateBlock(ctx context.Context, cfg config.ReorgConfig, rpc jsonrpc.JsonRpcClient, addrIdx address.AddressIndex, window *chainWindow, n uint64, b jsonrpc.Block, out chan<- jsonrpc.Block, eventsCh chan<- Event, progress *progressTracker) bool {
+	for attempt := 0; attempt < maxReorgAttempts && n > 0; attempt++ {
+		parent, ok := window.get(n - 1)
+		if !ok || parent.Hash == b.ParentHash {
+			break
+		}
+
+		log.Printf("reorg: parent hash mismatch at block %d, rewinding", n)
+		orphaned, canonical, ok := rewind(ctx, cfg, rpc, addrIdx, window, n-1, b.ParentHash)
+		if !ok {
+			return false
+		}
+
+		// both are oldest first and end at the parent of this block
+		fork := n - uint64(len(canonical))
+		for i, o := range orphaned {
+			// the orphaned block may still be in the filter matcher, its events go first
+			if !progress.waitFiltered(ctx, fork+uint64(i)) {
+				return false
+			}
+			revertBlock(ctx, o, addrIdx, eventsCh, progress)
+		}
+		for i, c := range canonical {
+			cn := fork + uint64(i)
+			window.put(cn, c)
+			if !forwardBlock(ctx, out, progress, cn, c) {
+				return false
+			}
+			// replacements that are already deep enough must be confirmed now
+			if cfg.ConfirmationDepth > 0 && cn+cfg.ConfirmationDepth <= n-1 {
+				if !progress.waitFiltered(ctx, cn) {
+					return false
+				}
+				confirmBlock(ctx, c, addrIdx, eventsCh, progress)
+			}
+		}
+		if len(orphaned) > 0 {
+			log.Printf("reorg: replaced %d blocks before %d", len(orphaned), n)
+		}
+
+		// the block we got can be from the stale side, so lets get the canonical one
+		if parent, ok = window.get(n - 1); ok && parent.Hash != b.ParentHash {
+			blk, ok := fetchCanonical(ctx, cfg, rpc, addrIdx, n)
+			if !ok {
+				return false
+			}
+			b = blk
+		}
+	}
+
+	window.put(n, b)
+	if !forwardBlock(ctx, out, progress, n, b) {
+		return false
+	}
+
+	if cfg.ConfirmationDepth > 0 && n >= cfg.ConfirmationDepth {
+		if cb, ok := window.get(n - cfg.ConfirmationDepth); ok {
+			if !progress.waitFiltered(ctx, n-cfg.ConfirmationDepth) {
+				return false
+			}
+			confirmBlock(ctx, cb, addrIdx, eventsCh, progress)
+		}
+	}
+	return ctx.Err() == nil
+}
+
+// rewind walks back from height h while our stored hash differs from the expected one.
+// It returns the orphaned blocks and the canonical replacements, both oldest first.
+func rewind(ctx context.Context, cfg config.ReorgConfig, rpc jsonrpc.JsonRpcClient, addrIdx address.AddressIndex, window *chainWindow, h uint64, expectedHash string) ([]jsonrpc.Block, []jsonrpc.Block, bool) {
+	var orphaned, canonical []jsonrpc.Block
+	for {
+		stored, ok := window.get(h)
+		if !ok || stored.Hash == expectedHash {
+			break
+		}
+		blk, ok := fetchCanonical(ctx, cfg, rpc, addrIdx, h)
+		if !ok {
+			return nil, nil, false
+		}
+		// our block is still the canonical one, the child we got is the stale side
+		if blk.Hash == stored.Hash {
+			break
+		}
+		orphaned = append([]jsonrpc.Block{stored}, orphaned...)
+		canonical = append([]jsonrpc.Block{blk}, canonical...)
+		expectedHash = blk.ParentHash
+		if h == 0 {
+			break
+		}
+		h--
+	}
+	if _, ok := window.get(h); !ok && len(orphaned) > 0 {
+		log.Printf("reorg: fork point is deeper than the window of %d blocks", cfg.Window)
+	}
+	return orphaned, canonical, true
+}
+
+// fetchCanonical keeps trying until we get the block, we can't validate without it
+func fetchCanonical(ctx context.Context, cfg config.ReorgConfig, rpc jsonrpc.JsonRpcClient, addrIdx address.AddressIndex, n uint64) (jsonrpc.Block, bool) {
+	for {
+		reqCtx, cancel := context.WithTimeout(ctx, cfg.ReqTimeout)
+		blk, err := rpc.GetBlockByNumber(reqCtx, n)
+		if err == nil && blk != nil && blk.Hash != "" {
+			err = checkBlockNumber(blk, n)
+		}
+		if err == nil && blk != nil && blk.Hash != "" {
+			err = enrichBlock(reqCtx, cfg.Enrich, rpc, addrIdx, blk)
+			if err == nil {
+				cancel()
+				return *blk, true
+			}
+		}
+		cancel()
+		if err != nil {
+			log.Printf("reorg: fetching block %d: %v", n, err)
+		}
+		select {
+		case <-ctx.Done():
+			return jsonrpc.Block{}, false
+		case <-time.After(cfg.RetryDelay):
+		}
+	}
+}
+
+// forwardBlock sends the block to the filter matcher, the progress follows it until the
+// filter matcher sent its events
+func forwardBlock(ctx context.Context, out chan<- jsonrpc.Block, progress *progressTracker, n uint64, b jsonrpc.Block) bool {
+	progress.forwarded(n)
+	select {
+	case <-ctx.Done():
+		return false
+	case out <- b:
+		return true
+	}
+}
@@ -0,0 +1,457 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/jsonrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockRpcClient struct {
+	mu     sync.Mutex
+	head   uint64
+	tags   map[string]uint64
+	blocks map[uint64]jsonrpc.Block
+	logs   map[string][]jsonrpc.Log
+	traces map[uint64][]jsonrpc.InternalTransfer
+	// by block hash, when nil the node doesn't have eth_getBlockReceipts
+	receipts   map[string][]jsonrpc.Receipt
+	txReceipts []jsonrpc.Receipt
+	err        error
+	calls      int
+	// how many batch requests were made
+	batches int
+	// how many calls return block not found before serving the blocks
+	missing int
+}
+
+func (m *mockRpcClient) GetCurrentBlockNumber(ctx context.Context) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	return m.head, m.err
+}
+
+func (m *mockRpcClient) GetBlockNumberByTag(ctx context.Context, tag string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.err != nil {
+		return 0, m.err
+	}
+	n, ok := m.tags[tag]
+	if !ok {
+		return 0, fmt.Errorf("block tag %s not available", tag)
+	}
+	return n, nil
+}
+
+func (m *mockRpcClient) GetLogs(ctx context.Context, filter jsonrpc.LogFilter) ([]jsonrpc.Log, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.logs[filter.BlockHash], nil
+}
+
+func (m *mockRpcClient) GetInternalTransfers(ctx context.Context, n uint64, mode string) ([]jsonrpc.InternalTransfer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.traces[n], nil
+}
+
+func (m *mockRpcClient) GetBlockReceipts(ctx context.Context, hash string) ([]jsonrpc.Receipt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.receipts == nil {
+		return nil, &jsonrpc.Error{Code: -32601, Message: "the method eth_getBlockReceipts does not exist"}
+	}
+	return m.receipts[hash], nil
+}
+
+func (m *mockRpcClient) GetTransactionReceipts(ctx context.Context, txHashes []string) ([]*jsonrpc.Receipt, []error, error) {
+	receipts := make([]*jsonrpc.Receipt, len(txHashes))
+	errs := make([]error, len(txHashes))
+	for i, h := range txHashes {
+		receipts[i], errs[i] = m.GetTransactionReceipt(ctx, h)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches++
+	return receipts, errs, nil
+}
+
+func (m *mockRpcClient) GetTransactionReceipt(ctx context.Context, txHash string) (*jsonrpc.Receipt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, receipts := range m.txReceipts {
+		if receipts.TransactionHash == txHash {
+			r := receipts
+			return &r, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: receipt of %s", jsonrpc.ErrBlockNotFound, txHash)
+}
+
+func (m *mockRpcClient) GetBlockByNumber(ctx context.Context, n uint64) (*jsonrpc.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.missing > 0 {
+		m.missing--
+		return nil, fmt.Errorf("%w: %d", jsonrpc.ErrBlockNotFound, n)
+	}
+	b, ok := m.blocks[n]
+	if !ok {
+		return nil, fmt.Errorf("block %d not found", n)
+	}
+	return &b, nil
+}
+
+func (m *mockRpcClient) GetBlocksByNumber(ctx context.Context, ns []uint64) ([]*jsonrpc.Block, []error, error) {
+	m.mu.Lock()
+	m.batches++
+	err := m.err
+	m.mu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blocks := make([]*jsonrpc.Block, len(ns))
+	errs := make([]error, len(ns))
+	for i, n := range ns {
+		blocks[i], errs[i] = m.GetBlockByNumber(ctx, n)
+	}
+	return blocks, errs, nil
+}
+
+func testBlock(n uint64, hash, parent string, txs ...jsonrpc.Transaction) jsonrpc.Block {
+	return jsonrpc.Block{
+		Number:       fmt.Sprintf("0x%x", n),
+		Hash:         hash,
+		ParentHash:   parent,
+		Transactions: txs,
+	}
+}
+
+func testReorgConfig(start uint64) config.ReorgConfig {
+	return config.ReorgConfig{
+		Window:     10,
+		StartFrom:  start,
+		ReqTimeout: 50 * time.Millisecond,
+		RetryDelay: 5 * time.Millisecond,
+		MaxPending: 4,
+	}
+}
+
+func receiveBlocks(t *testing.T, out <-chan jsonrpc.Block, n int) []jsonrpc.Block {
+	t.Helper()
+	var blocks []jsonrpc.Block
+	for i := 0; i < n; i++ {
+		select {
+		case b := <-out:
+			blocks = append(blocks, b)
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d blocks, got %d", n, len(blocks))
+		}
+	}
+	return blocks
+}
+
+func TestChainWindow(t *testing.T) {
+	t.Run("chain_window_evicts_old_blocks", func(t *testing.T) {
+		w := newChainWindow(2)
+		w.put(10, testBlock(10, "0xa", "0x9"))
+		w.put(11, testBlock(11, "0xb", "0xa"))
+		w.put(12, testBlock(12, "0xc", "0xb"))
+
+		_, ok := w.get(10)
+		assert.False(t, ok)
+		b, ok := w.get(12)
+		assert.True(t, ok)
+		assert.Equal(t, "0xc", b.Hash)
+	})
+
+	t.Run("chain_window_with_zero_size", func(t *testing.T) {
+		w := newChainWindow(0)
+		w.put(1, testBlock(1, "0xa", "0x0"))
+		_, ok := w.get(1)
+		assert.True(t, ok)
+	})
+}
+
+func TestReorgValidator(t *testing.T) {
+	t.Run("reorg_validator_orders_blocks", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		in := make(chan jsonrpc.Block, 10)
+		out := make(chan jsonrpc.Block, 10)
+		eventsCh := make(chan Event, 10)
+
+		go reorgValidator(ctx, testReorgConfig(100), &mockRpcClient{}, newMockAddressIndex(), in, out, eventsCh, nil)
+
+		in <- testBlock(102, "0xc", "0xb")
+		in <- testBlock(100, "0xa", "0x9")
+		in <- testBlock(101, "0xb", "0xa")
+
+		blocks := receiveBlocks(t, out, 3)
+		assert.Equal(t, "0xa", blocks[0].Hash)
+		assert.Equal(t, "0xb", blocks[1].Hash)
+		assert.Equal(t, "0xc", blocks[2].Hash)
+		assert.Len(t, eventsCh, 0)
+	})
+
+	t.Run("reorg_validator_ignores_blocks_before_start", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		in := make(chan jsonrpc.Block, 10)
+		out := make(chan jsonrpc.Block, 10)
+
+		go reorgValidator(ctx, testReorgConfig(100), &mockRpcClient{}, newMockAddressIndex(), in, out, make(chan Event, 10), nil)
+
+		in <- testBlock(99, "0x9", "0x8")
+		in <- testBlock(100, "0xa", "0x9")
+
+		blocks := receiveBlocks(t, out, 1)
+		assert.Equal(t, "0xa", blocks[0].Hash)
+	})
+
+	t.Run("reorg_validator_rewinds_and_reverts", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		in := make(chan jsonrpc.Block, 10)
+		out := make(chan jsonrpc.Block, 10)
+		eventsCh := make(chan Event, 10)
+
+		to := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+		tx := jsonrpc.Transaction{Hash: "0xtx", From: "0x1234567890123456789012345678901234567890", To: &to, Value: "0x1"}
+
+		rpc := &mockRpcClient{blocks: map[uint64]jsonrpc.Block{
+			100: testBlock(100, "0xa", "0x9"),
+			101: testBlock(101, "0xb2", "0xa"),
+			102: testBlock(102, "0xc2", "0xb2"),
+		}}
+
+		go reorgValidator(ctx, testReorgConfig(100), rpc, newMockAddressIndex(), in, out, eventsCh, nil)
+
+		in <- testBlock(100, "0xa", "0x9")
+		in <- testBlock(101, "0xb", "0xa", tx)
+		in <- testBlock(102, "0xc2", "0xb2")
+
+		blocks := receiveBlocks(t, out, 4)
+		assert.Equal(t, "0xa", blocks[0].Hash)
+		assert.Equal(t, "0xb", blocks[1].Hash)
+		assert.Equal(t, "0xb2", blocks[2].Hash)
+		assert.Equal(t, "0xc2", blocks[3].Hash)
+
+		select {
+		case ev := <-eventsCh:
+			assert.Equal(t, EventStatusReverted, ev.Status)
+			assert.Equal(t, "vitalik", ev.UserID)
+			assert.Equal(t, "0xb", ev.BlockHash)
+			assert.Equal(t, uint64(101), ev.BlockNumber)
+		case <-time.After(time.Second):
+			t.Fatal("expected reverted event")
+		}
+	})
+
+	t.Run("reorg_validator_reverts_after_the_orphaned_block_is_filtered", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		in := make(chan jsonrpc.Block, 10)
+		out := make(chan jsonrpc.Block, 10)
+		eventsCh := make(chan Event, 10)
+		progress := newProgressTracker(100)
+
+		to := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+		tx := jsonrpc.Transaction{Hash: "0xtx", From: "0x1234567890123456789012345678901234567890", To: &to, Value: "0x1"}
+
+		rpc := &mockRpcClient{blocks: map[uint64]jsonrpc.Block{
+			100: testBlock(100, "0xa", "0x9"),
+			101: testBlock(101, "0xb2", "0xa"),
+			102: testBlock(102, "0xc2", "0xb2"),
+		}}
+
+		go reorgValidator(ctx, testReorgConfig(100), rpc, newMockAddressIndex(), in, out, eventsCh, progress)
+
+		in <- testBlock(100, "0xa", "0x9")
+		in <- testBlock(101, "0xb", "0xa", tx)
+		in <- testBlock(102, "0xc2", "0xb2")
+
+		// the orphaned block is still waiting for the filter matcher
+		blocks := receiveBlocks(t, out, 2)
+		time.Sleep(50 * time.Millisecond)
+		assert.Len(t, eventsCh, 0)
+
+		for _, b := range blocks {
+			processBlock(ctx, b, newMockAddressIndex(), eventsCh, "", progress)
+		}
+		receiveBlocks(t, out, 2)
+
+		var statuses []string
+		for i := 0; i < 2; i++ {
+			select {
+			case ev := <-eventsCh:
+				statuses = append(statuses, ev.Status)
+			case <-time.After(time.Second):
+				t.Fatal("expected the original and the reverted event")
+			}
+		}
+		assert.Equal(t, []string{"", EventStatusReverted}, statuses)
+	})
+
+	t.Run("reorg_validator_sends_confirmed_events", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		in := make(chan jsonrpc.Block, 10)
+		out := make(chan jsonrpc.Block, 10)
+		eventsCh := make(chan Event, 10)
+
+		to := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+		tx := jsonrpc.Transaction{Hash: "0xtx", From: "0x1234567890123456789012345678901234567890", To: &to, Value: "0x1"}
+
+		cfg := testReorgConfig(100)
+		cfg.Window = 1
+		cfg.ConfirmationDepth = 2
+
+		go reorgValidator(ctx, cfg, &mockRpcClient{}, newMockAddressIndex(), in, out, eventsCh, nil)
+
+		in <- testBlock(100, "0xa", "0x9", tx)
+		in <- testBlock(101, "0xb", "0xa")
+		receiveBlocks(t, out, 2)
+		assert.Len(t, eventsCh, 0)
+
+		in <- testBlock(102, "0xc", "0xb")
+		receiveBlocks(t, out, 1)
+
+		select {
+		case ev := <-eventsCh:
+			assert.Equal(t, EventStatusConfirmed, ev.Status)
+			assert.Equal(t, uint64(100), ev.BlockNumber)
+		case <-time.After(time.Second):
+			t.Fatal("expected confirmed event")
+		}
+	})
+
+	t.Run("reorg_validator_refetches_stale_block", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		in := make(chan jsonrpc.Block, 10)
+		out := make(chan jsonrpc.Block, 10)
+
+		rpc := &mockRpcClient{blocks: map[uint64]jsonrpc.Block{
+			100: testBlock(100, "0xa", "0x9"),
+			101: testBlock(101, "0xb", "0xa"),
+		}}
+
+		go reorgValidator(ctx, testReorgConfig(100), rpc, newMockAddressIndex(), in, out, make(chan Event, 10), nil)
+
+		in <- testBlock(100, "0xa", "0x9")
+		in <- testBlock(101, "0xb-stale", "0xa-stale")
+
+		blocks := receiveBlocks(t, out, 2)
+		assert.Equal(t, "0xa", blocks[0].Hash)
+		assert.Equal(t, "0xb", blocks[1].Hash)
+	})
+
+	t.Run("reorg_validator_waits_for_missing_height", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		in := make(chan jsonrpc.Block, 10)
+		out := make(chan jsonrpc.Block, 10)
+
+		go reorgValidator(ctx, testReorgConfig(100), &mockRpcClient{}, newMockAddressIndex(), in, out, make(chan Event, 10), nil)
+
+		for n := uint64(101); n <= 105; n++ {
+			in <- testBlock(n, fmt.Sprintf("0x%d", n), fmt.Sprintf("0x%d", n-1))
+		}
+
+		select {
+		case b := <-out:
+			t.Fatalf("expected no block before 100, got %s", b.Number)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		in <- testBlock(100, "0x100", "0x99")
+		blocks := receiveBlocks(t, out, 6)
+		assert.Equal(t, "0x100", blocks[0].Hash)
+		assert.Equal(t, "0x105", blocks[5].Hash)
+	})
+
+	t.Run("reorg_validator_invalid_block_number", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		in := make(chan jsonrpc.Block, 10)
+		out := make(chan jsonrpc.Block, 10)
+
+		go reorgValidator(ctx, testReorgConfig(100), &mockRpcClient{}, newMockAddressIndex(), in, out, make(chan Event, 10), nil)
+
+		in <- jsonrpc.Block{Number: "invalid"}
+		in <- testBlock(100, "0xa", "0x9")
+
+		blocks := receiveBlocks(t, out, 1)
+		assert.Equal(t, "0xa", blocks[0].Hash)
+	})
+
+	t.Run("reorg_validator_context_cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		in := make(chan jsonrpc.Block)
+		done := make(chan struct{})
+
+		go func() {
+			reorgValidator(ctx, testReorgConfig(0), &mockRpcClient{}, newMockAddressIndex(), in, make(chan jsonrpc.Block), make(chan Event), nil)
+			close(done)
+		}()
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("reorg validator did not stop")
+		}
+	})
+}
+
+func TestFetchCanonical(t *testing.T) {
+	t.Run("fetch_canonical_stops_on_context_cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+		rpc := &mockRpcClient{err: assert.AnError}
+
+		_, ok := fetchCanonical(ctx, testReorgConfig(0), rpc, newMockAddressIndex(), 100)
+		assert.False(t, ok)
+		assert.Greater(t, rpc.calls, 1)
+	})
+	t.Run("fetch_canonical_rejects_another_height", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+		// a lagging provider answers with the block before
+		rpc := &mockRpcClient{blocks: map[uint64]jsonrpc.Block{100: testBlock(99, "0x9", "0x8")}}
+
+		_, ok := fetchCanonical(ctx, testReorgConfig(0), rpc, newMockAddressIndex(), 100)
+		assert.False(t, ok)
+		assert.Greater(t, rpc.calls, 1)
+	})
+}
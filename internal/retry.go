@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+)
+
+const failingReportInterval = time.Minute
+
+type retryItem struct {
+	attempts int
+	due      time.Time
+	err      error
+}
+
+// retryQueue keeps the heights the workers failed to fetch and sends them again with backoff.
+// The heads monitor already moved on, so if we drop a height here it is gone forever.
+type retryQueue struct {
+	mu    sync.Mutex
+	cfg   config.BlockFetcherConfig
+	items map[uint64]*retryItem
+}
+
+func newRetryQueue(cfg config.BlockFetcherConfig) *retryQueue {
+	return &retryQueue{cfg: cfg, items: make(map[uint64]*retryItem)}
+}
+
+func (q *retryQueue) push(h uint64, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	it, ok := q.items[h]
+	if !ok {
+		it = &retryItem{}
+		q.items[h] = it
+	}
+	it.attempts++
+	it.err = err
+	it.due = time.Now().Add(backoffWithJitter(q.cfg, it.attempts-1))
+
+	if q.cfg.FailingThreshold > 0 && it.attempts >= q.cfg.FailingThreshold {
+		log.Printf("block %d is failing persistently (%d attempts), checkpoint is blocked: %v", h, it.attempts, err)
+	} else {
+		log.Printf("block %d failed, retrying in %s: %v", h, time.Until(it.due).Round(time.Millisecond), err)
+	}
+}
+
+// done removes the height from the queue after a successful fetch
+func (q *retryQueue) done(h uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.items, h)
+}
+
+// due returns the heights ready to be retried, lowest first
+func (q *retryQueue) due(now time.Time) []uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var heights []uint64
+	for h, it := range q.items {
+		if !it.due.After(now) {
+			heights = append(heights, h)
+			// it will be pushed again if it fails, so nobody sends it twice meanwhile
+			it.due = now.Add(q.cfg.RetryMaxDelay + q.cfg.ReqTimeout)
+		}
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights
+}
+
+// failing returns the heights over the failing threshold
+func (q *retryQueue) failing() []uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var heights []uint64
+	if q.cfg.FailingThreshold <= 0 {
+		return heights
+	}
+	for h, it := range q.items {
+		if it.attempts >= q.cfg.FailingThreshold {
+			heights = append(heights, h)
+		}
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights
+}
+
+func (q *retryQueue) run(ctx context.Context, out chan<- uint64) {
+	interval := q.cfg.RetryBaseDelay
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	reportTicker := time.NewTicker(failingReportInterval)
+	defer reportTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reportTicker.C:
+			if failing := q.failing(); len(failing) > 0 {
+				log.Printf("blocks failing persistently: %v", failing)
+			}
+		case now := <-ticker.C:
+			for _, h := range q.due(now) {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- h:
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRetryConfig() config.BlockFetcherConfig {
+	return config.BlockFetcherConfig{
+		Workers:          1,
+		ReqTimeout:       50 * time.Millisecond,
+		RetryBaseDelay:   5 * time.Millisecond,
+		RetryMaxDelay:    20 * time.Millisecond,
+		MaxAttempts:      1,
+		FailingThreshold: 2,
+	}
+}
+
+func TestRetryQueue(t *testing.T) {
+	t.Run("retry_queue_due_after_backoff", func(t *testing.T) {
+		q := newRetryQueue(testRetryConfig())
+		now := time.Now()
+		q.push(100, assert.AnError)
+
+		assert.Empty(t, q.due(now))
+		assert.Equal(t, []uint64{100}, q.due(now.Add(time.Second)))
+		// it is not sent twice while it is being retried
+		assert.Empty(t, q.due(now.Add(time.Second)))
+	})
+
+	t.Run("retry_queue_due_sorted", func(t *testing.T) {
+		q := newRetryQueue(testRetryConfig())
+		q.push(102, assert.AnError)
+		q.push(100, assert.AnError)
+		q.push(101, assert.AnError)
+
+		assert.Equal(t, []uint64{100, 101, 102}, q.due(time.Now().Add(time.Second)))
+	})
+
+	t.Run("retry_queue_done_removes_height", func(t *testing.T) {
+		q := newRetryQueue(testRetryConfig())
+		q.push(100, assert.AnError)
+		q.done(100)
+
+		assert.Empty(t, q.due(time.Now().Add(time.Second)))
+	})
+
+	t.Run("retry_queue_failing_heights", func(t *testing.T) {
+		q := newRetryQueue(testRetryConfig())
+		q.push(100, assert.AnError)
+		q.push(101, assert.AnError)
+		q.push(100, assert.AnError)
+
+		assert.Equal(t, []uint64{100}, q.failing())
+	})
+
+	t.Run("retry_queue_failing_without_threshold", func(t *testing.T) {
+		cfg := testRetryConfig()
+		cfg.FailingThreshold = 0
+		q := newRetryQueue(cfg)
+		q.push(100, assert.AnError)
+
+		assert.Empty(t, q.failing())
+	})
+
+	t.Run("retry_queue_run_sends_due_heights", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		q := newRetryQueue(testRetryConfig())
+		out := make(chan uint64, 1)
+		q.push(100, assert.AnError)
+
+		go q.run(ctx, out)
+
+		select {
+		case h := <-out:
+			assert.Equal(t, uint64(100), h)
+		case <-time.After(time.Second):
+			t.Fatal("expected height to be retried")
+		}
+	})
+}
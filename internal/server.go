@@ -2,7 +2,10 @@ package internal
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
@@ -11,8 +14,11 @@ import (
 	"github.com/jmsilvadev/de-crypto/pkg/address"
 	"github.com/jmsilvadev/de-crypto/pkg/checkpoint"
 	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/dlq"
 	"github.com/jmsilvadev/de-crypto/pkg/jsonrpc"
 	"github.com/jmsilvadev/de-crypto/pkg/kafka"
+	"github.com/jmsilvadev/de-crypto/pkg/schema"
+	"github.com/jmsilvadev/de-crypto/pkg/sink"
 )
 
 func Start() {
@@ -31,75 +37,170 @@ func Start() {
 	}
 
 	// To understand under 15 minutes
-	headsCh := make(chan uint64, config.DefaultHeadsChannelSize)          // chanell to get and buffer the current blocks ans send to the blocks fetcher
-	blocksCh := make(chan jsonrpc.Block, config.DefaultBlocksChannelSize) // channel do get the full blocks details and send to the filter matcher
-	eventsCh := make(chan Event, config.DefaultEventsChannelSize)         // channel to send the filtered blocks to sink
+	headsCh := make(chan uint64, config.DefaultHeadsChannelSize)           // chanell to get and buffer the current blocks ans send to the blocks fetcher
+	fetchedCh := make(chan jsonrpc.Block, config.DefaultBlocksChannelSize) // channel do get the full blocks details and send to the reorg validator
+	blocksCh := make(chan jsonrpc.Block, config.DefaultBlocksChannelSize)  // channel to get the validated blocks in order and send to the filter matcher
+	eventsCh := make(chan Event, config.DefaultEventsChannelSize)          // channel to send the filtered blocks to sink
+
+	depth := config.GetConfirmationDepth()
+	emitUnconfirmed := config.GetEmitUnconfirmed()
+
+	// in the dual mode the blocks after the checkpoint may have no confirmed events yet,
+	// so we start again from the depth to send them, the consumers will get the unconfirmed ones twice
+	startFrom := confirmedCheckpointFromDisk
+	if emitUnconfirmed && depth > 0 {
+		if startFrom > depth {
+			startFrom -= depth
+		} else {
+			startFrom = 0
+		}
+	}
+
+	// tracks which blocks were fully processed to move the checkpoint
+	progress := newProgressTracker(startFrom)
 
 	cfgHead := config.HeadMonitorConfig{
 		PollInterval:      config.DefaultPollingInterval,
-		StartFrom:         confirmedCheckpointFromDisk,
+		StartFrom:         startFrom,
 		Jitter:            config.DeaultJitterDeviation,
 		MaxEnqueuePerTick: config.DefaultMaxEnqueuePerTick,
+		ConfirmationDepth: depth,
+		EmitUnconfirmed:   emitUnconfirmed,
+		BlockTag:          config.GetHeadBlockTag(),
+		// the reorg validator buffers the blocks after a missing height, this is its bound
+		MaxAhead: uint64(config.DefaultReorgMaxPending),
 	}
 
-	jsonRPC := jsonrpc.NewEthereum(config.CliUrl, config.DefaultHttpClient)
+	jsonRPC, err := newProvidersClient(ctx, config.GetRpcUrls(), config.GetQuorum())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// when the providers are down the workers pause on the breaker instead of spinning on timeouts
+	jsonRPC = jsonrpc.NewCircuitBreaker(jsonRPC, config.DefaultBreakerThreshold, config.DefaultBreakerOpenTimeout)
+
+	// push mode when we have a websocket, the head monitor polls while the socket is down
+	var headSub jsonrpc.HeadSubscriber
+	if wsUrl := config.GetWSUrl(); wsUrl != "" {
+		headSub = jsonrpc.NewWSClient(wsUrl, config.DefaultWSReconnectDelay, config.DefaultWSMaxReconnectDelay)
+	}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		headMonitor(ctx, cfgHead, jsonRPC, headsCh)
+		headMonitor(ctx, cfgHead, jsonRPC, headSub, headsCh, progress)
 	}()
 
+	addressFile := config.GetAddressFile()
+	add, err := address.NewMemoryAddressIndexFromJSON(addressFile)
+	if err != nil {
+		panic(err)
+	}
+
+	cfgEnrich := config.EnrichConfig{
+		TokenTransfers: config.GetTokenTransfers(),
+		TraceMode:      config.GetTraceMode(),
+		Receipts:       config.GetReceipts(),
+		SkipFailedTxs:  config.GetSkipFailedTxs(),
+	}
+
 	cfgBlock := config.BlockFetcherConfig{
 		Workers:        config.DefaultWorkersQty,
 		ReqTimeout:     config.DefaultRequestTimeout,
 		RetryBaseDelay: config.DefaultPollingInterval,
 		RetryMaxDelay:  config.DefaultPollingInterval,
 		Jitter:         config.DeaultJitterDeviation,
+
+		MaxAttempts:      config.DefaultFetchMaxAttempts,
+		FailingThreshold: config.DefaultFailingThreshold,
+		BatchSize:        config.DefaultFetchBatchSize,
+		BatchThreshold:   config.DefaultBatchThreshold,
+		Enrich:           cfgEnrich,
 	}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		blockFetcher(ctx, cfgBlock, jsonRPC, headsCh, blocksCh)
+		blockFetcher(ctx, cfgBlock, jsonRPC, add, headsCh, fetchedCh)
 	}()
 
-	addressFile := config.GetAddressFile()
-	add, err := address.NewMemoryAddressIndexFromJSON(addressFile)
-	if err != nil {
-		panic(err)
+	cfgReorg := config.ReorgConfig{
+		Window:     config.DefaultReorgWindow,
+		StartFrom:  startFrom,
+		ReqTimeout: config.DefaultRequestTimeout,
+		RetryDelay: config.DefaultPollingInterval,
+		MaxPending: config.DefaultReorgMaxPending,
+		Enrich:     cfgEnrich,
+	}
+	if emitUnconfirmed {
+		cfgReorg.ConfirmationDepth = depth
 	}
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		reorgValidator(ctx, cfgReorg, jsonRPC, add, fetchedCh, blocksCh, eventsCh, progress)
+	}()
+
 	cfgFilter := config.FilterConfig{
-		Workers: 8,
+		Workers:         8,
+		EmitUnconfirmed: emitUnconfirmed && depth > 0,
 	}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		filterMatcher(ctx, cfgFilter, blocksCh, add, eventsCh)
+		filterMatcher(ctx, cfgFilter, blocksCh, add, eventsCh, progress)
 	}()
 
 	cfgSink := config.SinkConfig{
 		FlushInterval: config.DefaultFlushInterval,
 		BatchSize:     config.DefaultBatchSize,
+		MessageKey:    config.GetMessageKey(),
+		ChainID:       config.GetChainID(),
+	}
+	cfgSink.Encoding, cfgSink.SchemaID, err = sinkEncoding(ctx)
+	if err != nil {
+		panic(err)
+	}
+	cfgSink.CloudEvents, cfgSink.CloudEventsSource = config.GetCloudEvents(), config.GetCloudEventsSource()
+	if cfgSink.CloudEvents == config.CloudEventsBinary && config.GetSink() != "kafka" {
+		// the attributes go in the kafka headers, the other sinks have nowhere to put them
+		panic(errors.New("the CloudEvents binary mode needs the kafka sink, use the structured mode"))
 	}
 
-	cfgKafka := config.KafkaConfig{
-		Brokers: config.GetKafakBrokers(),
-		Topic:   config.GetKafakTopic(),
+	out, err := newSink(ctx)
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+	if err := out.Health(ctx); err != nil {
+		log.Printf("sink: not healthy, the events go to the dlq until it is: %v", err)
 	}
 
-	pub, err := kafka.NewPublisher(ctx, cfgKafka.Brokers, cfgKafka.Topic)
+	// the failed publishes are kept on disk and redelivered while the service runs
+	deadLetters, err := dlq.Open(config.GetDLQDir(), config.DefaultDLQSegmentSize)
 	if err != nil {
 		panic(err)
 	}
-	defer pub.Close()
+	defer deadLetters.Close()
+	if n := deadLetters.Len(); n > 0 {
+		log.Printf("dlq: %d messages pending redelivery", n)
+	}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		sinkProcessor(ctx, cfgSink, eventsCh, store, pub.Publish)
+		// on its own session, the flushes of the redelivery don't take the results of the sink processor
+		redelivery := sink.Session(out)
+		publish := func(r dlq.Record) error { return sink.Publish(ctx, redelivery, fromDeadLetter(r)) }
+		deadLetters.Run(ctx, publish, config.DefaultDLQRetryDelay, config.DefaultDLQMaxRetryDelay)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sinkProcessor(ctx, cfgSink, eventsCh, store, progress, deadLetters, out)
 	}()
 
 	sigCh := make(chan os.Signal, 1)
@@ -113,3 +214,113 @@ func Start() {
 
 	wg.Wait()
 }
+
+// sinkEncoding returns the encoding of the sink in SINK and, with a schema registry, the id
+// of the event schema. The kafka schemas are in the subject of the topic values.
+func sinkEncoding(ctx context.Context) (string, int, error) {
+	var encoding, subject string
+	switch config.GetSink() {
+	case "kafka":
+		encoding, subject = config.GetKafkaEncoding(), config.GetKafakTopic()+"-value"
+	case "webhook":
+		encoding = config.GetWebhookEncoding()
+		if encoding != config.EncodingJSON && config.GetWebhookBatch() {
+			return "", 0, errors.New("the webhook batches are json arrays, WEBHOOK_BATCH needs the json encoding")
+		}
+	default:
+		// json lines
+		return config.EncodingJSON, 0, nil
+	}
+
+	schemaType, s, ok := eventSchema(encoding)
+	cfgRegistry := config.GetSchemaRegistry()
+	if !ok || subject == "" || cfgRegistry.URL == "" {
+		return encoding, 0, nil
+	}
+
+	registry := schema.NewRegistry(cfgRegistry.URL, &http.Client{Timeout: config.DefaultRequestTimeout}, cfgRegistry.Username, cfgRegistry.Password)
+	register := registry.Lookup
+	if cfgRegistry.AutoRegister {
+		register = registry.Register
+	}
+	id, err := register(ctx, subject, schemaType, s)
+	if err != nil {
+		return "", 0, err
+	}
+	log.Printf("schema: %s %s has id %d", subject, encoding, id)
+	return encoding, id, nil
+}
+
+// newSink creates the sink set in SINK, kafka by default
+func newSink(ctx context.Context) (sink.Sink, error) {
+	switch config.GetSink() {
+	case "stdout":
+		return sink.NewStdout(), nil
+	case "file":
+		return sink.NewFileSink(config.GetSinkFile())
+	case "webhook":
+		return sink.NewWebhookSink(&http.Client{Timeout: config.DefaultRequestTimeout}, config.WebhookConfig{
+			URLs:           config.GetWebhookUrls(),
+			Secret:         config.GetWebhookSecret(),
+			Batch:          config.GetWebhookBatch(),
+			Concurrency:    config.GetWebhookConcurrency(),
+			MaxAttempts:    config.DefaultWebhookMaxAttempts,
+			RetryBaseDelay: config.DefaultWebhookRetryBaseDelay,
+			RetryMaxDelay:  config.DefaultWebhookRetryMaxDelay,
+			ParkDir:        config.DefaultWebhookParkDir,
+		})
+	}
+
+	cfgKafka := config.KafkaConfig{
+		Brokers:           config.GetKafakBrokers(),
+		Topic:             config.GetKafakTopic(),
+		Partitions:        config.GetKafkaPartitions(),
+		ReplicationFactor: config.GetKafkaReplicationFactor(),
+		Retention:         config.GetKafkaRetention(),
+		CleanupPolicy:     config.GetKafkaCleanupPolicy(),
+		TLS:               config.GetKafkaTLS(),
+		SASL:              config.GetKafkaSASL(),
+		Async:             config.GetKafkaAsync(),
+		Compression:       config.GetKafkaCompression(),
+	}
+	return kafka.NewPublisher(ctx, cfgKafka)
+}
+
+// newProvidersClient creates the client of the providers in RPC_URLS, one provider is used
+// as it is and more of them go behind the multi provider client
+func newProvidersClient(ctx context.Context, urls []string, quorum int) (jsonrpc.JsonRpcClient, error) {
+	if quorum > 1 && quorum > len(urls) {
+		return nil, fmt.Errorf("QUORUM %d is bigger than the %d providers in RPC_URLS", quorum, len(urls))
+	}
+	if len(urls) == 0 {
+		urls = []string{config.CliUrl}
+	}
+	if len(urls) == 1 {
+		return newRpcClient(urls[0]), nil
+	}
+
+	providers := make([]jsonrpc.Provider, len(urls))
+	for i, u := range urls {
+		providers[i] = jsonrpc.Provider{Name: u, Client: newRpcClient(u)}
+	}
+	multi := jsonrpc.NewMultiClient(providers, config.DefaultProviderMaxLag)
+	go multi.Run(ctx, config.DefaultProviderCheckInterval, config.DefaultRequestTimeout)
+
+	// the blocks are only trusted when enough providers agree on them
+	if quorum > 1 {
+		return jsonrpc.NewQuorumClient(multi, providers, quorum, config.DefaultQuorumQuarantine), nil
+	}
+	return multi, nil
+}
+
+// newRpcClient creates the client for one provider, behind its own rate limiter
+func newRpcClient(url string) jsonrpc.JsonRpcClient {
+	var client jsonrpc.JsonRpcClient = jsonrpc.NewEthereum(url, config.DefaultHttpClient)
+
+	rps, cus := config.GetRpcRequestsPerSecond(), config.GetRpcComputeUnitsPerSecond()
+	if rps > 0 || cus > 0 {
+		limiter := jsonrpc.NewRateLimiter(rps, cus, config.GetRpcMethodCosts(), config.DefaultRpcMethodCost)
+		client = jsonrpc.NewLimitedClient(client, limiter)
+	}
+	return client
+}
@@ -1,8 +1,12 @@
 package internal
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 
 	"github.com/jmsilvadev/de-crypto/pkg/address"
@@ -42,6 +46,38 @@ func TestStart_Integration(t *testing.T) {
 	})
 }
 
+func TestNewProvidersClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("new_providers_client_with_one_url", func(t *testing.T) {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+		}))
+		defer srv.Close()
+
+		client, err := newProvidersClient(ctx, []string{srv.URL}, 0)
+		assert.NoError(t, err)
+		head, err := client.GetCurrentBlockNumber(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(16), head)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("new_providers_client_with_more_urls", func(t *testing.T) {
+		client, err := newProvidersClient(ctx, []string{"http://a", "http://b"}, 2)
+		assert.NoError(t, err)
+		assert.IsType(t, &jsonrpc.QuorumClient{}, client)
+	})
+
+	t.Run("new_providers_client_quorum_bigger_than_the_providers", func(t *testing.T) {
+		_, err := newProvidersClient(ctx, []string{"http://a"}, 2)
+		assert.Error(t, err)
+	})
+}
+
 func TestStart_Configuration(t *testing.T) {
 	t.Run("start_uses_default_configuration", func(t *testing.T) {
 
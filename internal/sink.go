@@ -2,15 +2,31 @@ package internal
 
 import (
 	"context"
-	"encoding/json"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jmsilvadev/de-crypto/pkg/checkpoint"
 	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/dlq"
+	"github.com/jmsilvadev/de-crypto/pkg/sink"
 )
 
-func sinkProcessor(ctx context.Context, cfg config.SinkConfig, eventsCh <-chan Event, store *checkpoint.CheckpointStore, publisher func([]byte) error) {
+type pendingMessage struct {
+	block uint64
+	msg   sink.Message
+}
+
+// on shutdown the context is done, we still give the last batch some time to go out
+const shutdownFlushTimeout = 5 * time.Second
+
+// how many published batches can wait for the flush
+const maxInflightBatches = 4
+
+// sinkProcessor publishes the events in batches, the messages that fail to publish go to the
+// dead letter queue so they are redelivered later instead of lost
+func sinkProcessor(ctx context.Context, cfg config.SinkConfig, eventsCh <-chan Event, store *checkpoint.CheckpointStore, progress *progressTracker, deadLetters *dlq.Queue, out sink.Sink) {
 	log.Println("Starting sink processor")
 
 	if cfg.FlushInterval <= 0 {
@@ -28,90 +44,210 @@ func sinkProcessor(ctx context.Context, cfg config.SinkConfig, eventsCh <-chan E
 	defer checkpointTicker.Stop()
 
 	var lastSaved uint64
-	var pendingCheckpoint *uint64
-	var maxSeen uint64
 
 	if store != nil {
 		if n, err := store.Load(); err != nil {
 			log.Println(err)
 		} else {
 			lastSaved = n
-			maxSeen = n
 		}
 	}
 
 	// using literals here to reuse the state...
-	batch := make([][]byte, 0, cfg.BatchSize)
+	batch := make([]pendingMessage, 0, cfg.BatchSize)
+
+	// published and waiting for the flush, an async sink may still be sending them
+	inflight := make([]pendingMessage, 0, cfg.BatchSize)
+
+	// settle acks the block of the messages that were delivered or are safe in the dlq, so
+	// the checkpoint never moves over an event we could still lose. It returns the messages
+	// we have to send again.
+	settle := func(msgs []pendingMessage, errs []error) []pendingMessage {
+		var kept []pendingMessage
+		for i, m := range msgs {
+			if errs[i] != nil {
+				if deadLetters == nil {
+					kept = append(kept, m)
+					continue
+				}
+				if err := deadLetters.Append(deadLetter(m.msg, errs[i])); err != nil {
+					// nowhere to keep it, we try again on the next flush
+					log.Println("dlq:", err)
+					kept = append(kept, m)
+					continue
+				}
+			}
+			progress.ack(m.block)
+		}
+		return kept
+	}
 
-	sendEvents := func() {
+	// publish hands the batch to the sink without waiting for the flush, so with an async
+	// sink we keep filling the next batch while this one is sent
+	publish := func(ctx context.Context) {
 		if len(batch) == 0 {
 			return
 		}
-		for _, msg := range batch {
-			if err := publisher(msg); err != nil {
-				// so if we have an error we will continue and log
-				// we can create an improvement to add a dead letter or so...
-				log.Println("publish:", err)
+		msgs := make([]sink.Message, len(batch))
+		for i, m := range batch {
+			msgs[i] = m.msg
+		}
+		err := out.PublishBatch(ctx, msgs)
+		if err != nil {
+			log.Println("publish:", err)
+		}
+
+		errs := sink.Errors(err, len(batch))
+		var failed []pendingMessage
+		var failedErrs []error
+		for i, m := range batch {
+			if errs[i] != nil {
+				failed = append(failed, m)
+				failedErrs = append(failedErrs, errs[i])
+				continue
 			}
+			inflight = append(inflight, m)
+		}
+		batch = append(batch[:0], settle(failed, failedErrs)...)
+	}
+
+	// nothing is delivered until it is flushed
+	sendEvents := func(ctx context.Context) {
+		publish(ctx)
+		if len(inflight) == 0 {
+			return
 		}
-		batch = batch[:0]
+		err := out.Flush(ctx)
+		if err != nil {
+			log.Println("flush:", err)
+		}
+		kept := settle(inflight, sink.Errors(err, len(inflight)))
+		inflight = inflight[:0]
+		batch = append(batch, kept...)
+	}
+
+	flushOnShutdown := func() {
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownFlushTimeout)
+		defer cancel()
+		sendEvents(shutdownCtx)
 	}
 
-	// same here
+	// same here, the blocks arrive out of order so we only save the highest contiguous
+	// height that was fully processed, blocks without events included
 	saveCheckpointIfNeeded := func() {
-		if store == nil || pendingCheckpoint == nil {
+		if store == nil {
 			return
 		}
-		confirmed := *pendingCheckpoint
-		if confirmed > lastSaved {
-			if err := store.Save(confirmed); err != nil {
-				log.Println(err)
-			} else {
-				lastSaved = confirmed
-			}
+		confirmed, ok := progress.checkpoint(lastSaved)
+		if !ok {
+			return
+		}
+		if err := store.Save(confirmed); err != nil {
+			log.Println(err)
+		} else {
+			lastSaved = confirmed
 		}
-		pendingCheckpoint = nil
 	}
 
 	//same hre
 	writeEvent := func(ev Event) {
-		b, err := json.Marshal(ev)
+		if ev.ID == "" {
+			ev.ID = ev.eventID()
+		}
+		msg, err := eventMessage(cfg, ev)
 		if err != nil {
+			// it will never be sent, we don't hold the checkpoint for it
 			log.Println(err)
+			progress.ack(ev.BlockNumber)
 			return
 		}
-		batch = append(batch, b)
-
-		if ev.BlockNumber > maxSeen {
-			maxSeen = ev.BlockNumber
-			if maxSeen > lastSaved {
-				pc := maxSeen
-				pendingCheckpoint = &pc
-			}
-		}
+		batch = append(batch, pendingMessage{block: ev.BlockNumber, msg: msg})
 
 		if len(batch) >= cfg.BatchSize {
-			sendEvents()
+			publish(ctx)
+		}
+		// don't let the unflushed messages pile up
+		if len(inflight) >= maxInflightBatches*cfg.BatchSize {
+			sendEvents(ctx)
 		}
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			sendEvents()
+			flushOnShutdown()
 			saveCheckpointIfNeeded()
 			return
 		case ev, ok := <-eventsCh:
 			if !ok {
-				sendEvents()
+				flushOnShutdown()
 				saveCheckpointIfNeeded()
 				return
 			}
 			writeEvent(ev)
 		case <-flushTicker.C:
-			sendEvents()
+			sendEvents(ctx)
 		case <-checkpointTicker.C:
 			saveCheckpointIfNeeded()
 		}
 	}
 }
+
+// eventMessage encodes the event, in the CloudEvents envelope when it is enabled
+func eventMessage(cfg config.SinkConfig, ev Event) (sink.Message, error) {
+	b, err := encodeEvent(cfg, ev)
+	if err != nil {
+		return sink.Message{}, err
+	}
+	msg := sink.Message{Key: messageKey(cfg.MessageKey, ev), Value: b, Headers: messageHeaders(cfg, ev)}
+
+	switch cfg.CloudEvents {
+	case config.CloudEventsStructured:
+		if msg.Value, err = newCloudEvent(cfg, ev).structured(b); err != nil {
+			return sink.Message{}, err
+		}
+		msg.Headers["content-type"] = cloudEventsContentType
+	case config.CloudEventsBinary:
+		for name, v := range newCloudEvent(cfg, ev).binaryHeaders() {
+			msg.Headers[name] = v
+		}
+	}
+	return msg, nil
+}
+
+// messageKey is the partition key, the messages with the same key keep their order
+func messageKey(keyBy string, ev Event) []byte {
+	switch keyBy {
+	case config.MessageKeyAddress:
+		return []byte(ev.userAddress())
+	case config.MessageKeyTxHash:
+		return []byte(strings.ToLower(ev.TxHash))
+	case config.MessageKeyEvent:
+		// without the status, the events of a transfer keep their order
+		id, _, _ := strings.Cut(ev.ID, ":")
+		return []byte(id)
+	}
+	return []byte(ev.UserID)
+}
+
+// messageHeaders let the consumers route the events without parsing the body
+func messageHeaders(cfg config.SinkConfig, ev Event) map[string]string {
+	headers := map[string]string{
+		"content-type":   contentType(cfg.Encoding),
+		"event-id":       ev.ID,
+		"event-type":     ev.Type,
+		"schema-version": EventSchemaVersion,
+	}
+	if cfg.ChainID > 0 {
+		headers["chain-id"] = strconv.FormatUint(cfg.ChainID, 10)
+	}
+	return headers
+}
+
+func deadLetter(msg sink.Message, err error) dlq.Record {
+	return dlq.Record{Key: msg.Key, Message: msg.Value, Headers: msg.Headers, Error: err.Error()}
+}
+
+func fromDeadLetter(r dlq.Record) sink.Message {
+	return sink.Message{Key: r.Key, Value: r.Message, Headers: r.Headers}
+}
@@ -2,12 +2,78 @@ package internal
 
 import (
 	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/jmsilvadev/de-crypto/pkg/checkpoint"
 	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/dlq"
+	"github.com/jmsilvadev/de-crypto/pkg/jsonrpc"
+	"github.com/jmsilvadev/de-crypto/pkg/sink"
+	"github.com/stretchr/testify/assert"
 )
 
+// funcSink publishes every message with the function
+type funcSink func([]byte) error
+
+func (f funcSink) PublishBatch(ctx context.Context, msgs []sink.Message) error {
+	errs := make(sink.BatchError, len(msgs))
+	failed := false
+	for i, m := range msgs {
+		errs[i] = f(m.Value)
+		failed = failed || errs[i] != nil
+	}
+	if failed {
+		return errs
+	}
+	return nil
+}
+
+func (f funcSink) Flush(ctx context.Context) error  { return nil }
+func (f funcSink) Close() error                     { return nil }
+func (f funcSink) Health(ctx context.Context) error { return nil }
+
+// asyncSink only reports the results on Flush, like the kafka publisher in async mode
+type asyncSink struct {
+	mu      sync.Mutex
+	pending [][]byte
+	fail    func([]byte) error
+	flushes int
+}
+
+func (s *asyncSink) PublishBatch(ctx context.Context, msgs []sink.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range msgs {
+		s.pending = append(s.pending, m.Value)
+	}
+	return nil
+}
+
+func (s *asyncSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	errs := make(sink.BatchError, len(s.pending))
+	failed := false
+	for i, m := range s.pending {
+		errs[i] = s.fail(m)
+		failed = failed || errs[i] != nil
+	}
+	s.pending = nil
+	if failed {
+		return errs
+	}
+	return nil
+}
+
+func (s *asyncSink) Close() error                     { return nil }
+func (s *asyncSink) Health(ctx context.Context) error { return nil }
+
 func TestSinkProcessor(t *testing.T) {
 	t.Run("sink_processor_processes_events", func(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
@@ -17,7 +83,7 @@ func TestSinkProcessor(t *testing.T) {
 			BatchSize:     5,
 			FlushInterval: 100 * time.Millisecond,
 		}
-		go sinkProcessor(ctx, cfg, eventsCh, nil, func(data []byte) error { return nil })
+		go sinkProcessor(ctx, cfg, eventsCh, nil, nil, nil, funcSink(func(data []byte) error { return nil }))
 		event := Event{
 			BlockNumber: 12345,
 			TxHash:      "0xabc123",
@@ -36,7 +102,7 @@ func TestSinkProcessor(t *testing.T) {
 			BatchSize:     5,
 			FlushInterval: 100 * time.Millisecond,
 		}
-		go sinkProcessor(ctx, cfg, eventsCh, nil, func(data []byte) error { return nil })
+		go sinkProcessor(ctx, cfg, eventsCh, nil, nil, nil, funcSink(func(data []byte) error { return nil }))
 		event := Event{
 			BlockNumber: 12345,
 			TxHash:      "0xabc123",
@@ -55,9 +121,9 @@ func TestSinkProcessor(t *testing.T) {
 			BatchSize:     5,
 			FlushInterval: 100 * time.Millisecond,
 		}
-		go sinkProcessor(ctx, cfg, eventsCh, nil, func(data []byte) error {
+		go sinkProcessor(ctx, cfg, eventsCh, nil, nil, nil, funcSink(func(data []byte) error {
 			return nil
-		})
+		}))
 		event := Event{
 			BlockNumber: 12345,
 			TxHash:      "0xabc123",
@@ -76,7 +142,7 @@ func TestSinkProcessor(t *testing.T) {
 			BatchSize:     5,
 			FlushInterval: 100 * time.Millisecond,
 		}
-		go sinkProcessor(ctx, cfg, eventsCh, nil, func(data []byte) error { return nil })
+		go sinkProcessor(ctx, cfg, eventsCh, nil, nil, nil, funcSink(func(data []byte) error { return nil }))
 		event := Event{
 			BlockNumber: 10000,
 			TxHash:      "0xabc123",
@@ -95,7 +161,7 @@ func TestSinkProcessor(t *testing.T) {
 			BatchSize:     5,
 			FlushInterval: 100 * time.Millisecond,
 		}
-		go sinkProcessor(ctx, cfg, eventsCh, nil, func(data []byte) error { return nil })
+		go sinkProcessor(ctx, cfg, eventsCh, nil, nil, nil, funcSink(func(data []byte) error { return nil }))
 		event := Event{
 			BlockNumber: 12345,
 			TxHash:      "0xabc123",
@@ -114,7 +180,7 @@ func TestSinkProcessor(t *testing.T) {
 			BatchSize:     10,
 			FlushInterval: 100 * time.Millisecond,
 		}
-		go sinkProcessor(ctx, cfg, eventsCh, nil, func(data []byte) error { return nil })
+		go sinkProcessor(ctx, cfg, eventsCh, nil, nil, nil, funcSink(func(data []byte) error { return nil }))
 		event := Event{
 			BlockNumber: 12345,
 			TxHash:      "0xabc123",
@@ -125,4 +191,283 @@ func TestSinkProcessor(t *testing.T) {
 		eventsCh <- event
 		<-ctx.Done()
 	})
+	t.Run("sink_processor_saves_contiguous_watermark", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 700*time.Millisecond)
+		defer cancel()
+		eventsCh := make(chan Event, 10)
+		cfg := config.SinkConfig{
+			BatchSize:     5,
+			FlushInterval: 100 * time.Millisecond,
+		}
+		store := checkpoint.NewCheckpointStore(filepath.Join(t.TempDir(), "checkpoint"))
+		progress := newProgressTracker(100)
+		progress.markDone(100)
+		progress.add(101, 1)
+		progress.markDone(101)
+		progress.add(103, 1)
+		progress.markDone(103)
+
+		done := make(chan struct{})
+		go func() {
+			sinkProcessor(ctx, cfg, eventsCh, store, progress, nil, funcSink(func(data []byte) error { return nil }))
+			close(done)
+		}()
+		eventsCh <- Event{BlockNumber: 103, UserID: "user1"}
+		eventsCh <- Event{BlockNumber: 101, UserID: "user1"}
+		<-done
+
+		n, err := store.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(101), n)
+	})
+	t.Run("sink_processor_moves_the_checkpoint_back_for_a_reorg", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 700*time.Millisecond)
+		defer cancel()
+		store := checkpoint.NewCheckpointStore(filepath.Join(t.TempDir(), "checkpoint"))
+		assert.NoError(t, store.Save(103))
+		progress := newProgressTracker(100)
+		for n := uint64(100); n <= 103; n++ {
+			progress.markDone(n)
+		}
+		// the reverted event of 102 is not published yet
+		progress.add(102, 1)
+
+		cfg := config.SinkConfig{BatchSize: 5, FlushInterval: 50 * time.Millisecond}
+		sinkProcessor(ctx, cfg, make(chan Event), store, progress, nil, funcSink(func(data []byte) error { return nil }))
+
+		n, err := store.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(101), n)
+	})
+	t.Run("sink_processor_sends_failed_publishes_to_dlq", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		eventsCh := make(chan Event, 10)
+		cfg := config.SinkConfig{
+			BatchSize:     5,
+			FlushInterval: 50 * time.Millisecond,
+		}
+		deadLetters, err := dlq.Open(t.TempDir(), config.DefaultDLQSegmentSize)
+		assert.NoError(t, err)
+		defer deadLetters.Close()
+
+		done := make(chan struct{})
+		go func() {
+			sinkProcessor(ctx, cfg, eventsCh, nil, nil, deadLetters, funcSink(func(data []byte) error { return errors.New("broker down") }))
+			close(done)
+		}()
+		eventsCh <- Event{BlockNumber: 100, TxHash: "0xabc123", UserID: "user1"}
+		<-done
+
+		records, err := deadLetters.Pending(0)
+		assert.NoError(t, err)
+		assert.Len(t, records, 1)
+		assert.Equal(t, "broker down", records[0].Error)
+		assert.Contains(t, string(records[0].Message), "0xabc123")
+		assert.Equal(t, "user1", string(records[0].Key))
+		assert.Equal(t, EventSchemaVersion, records[0].Headers["schema-version"])
+		assert.NotEmpty(t, records[0].Headers["event-id"])
+		assert.Contains(t, string(records[0].Message), `"id":"`+records[0].Headers["event-id"]+`"`)
+	})
+	t.Run("sink_processor_checkpoints_only_published_events", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 700*time.Millisecond)
+		defer cancel()
+		eventsCh := make(chan Event, 10)
+		cfg := config.SinkConfig{
+			BatchSize:     5,
+			FlushInterval: 50 * time.Millisecond,
+		}
+		store := checkpoint.NewCheckpointStore(filepath.Join(t.TempDir(), "checkpoint"))
+		progress := newProgressTracker(100)
+		progress.markDone(100)
+		progress.add(101, 1)
+		progress.markDone(101)
+
+		// the broker is down and there is no dlq, the event can't be acked
+		done := make(chan struct{})
+		go func() {
+			sinkProcessor(ctx, cfg, eventsCh, store, progress, nil, funcSink(func(data []byte) error { return errors.New("broker down") }))
+			close(done)
+		}()
+		eventsCh <- Event{BlockNumber: 101, UserID: "user1"}
+		<-done
+
+		n, err := store.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(100), n)
+	})
+	t.Run("sink_processor_retries_unpublished_events", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 700*time.Millisecond)
+		defer cancel()
+		eventsCh := make(chan Event, 10)
+		cfg := config.SinkConfig{
+			BatchSize:     5,
+			FlushInterval: 50 * time.Millisecond,
+		}
+		store := checkpoint.NewCheckpointStore(filepath.Join(t.TempDir(), "checkpoint"))
+		progress := newProgressTracker(100)
+		progress.markDone(100)
+		progress.add(101, 1)
+		progress.markDone(101)
+
+		var published [][]byte
+		calls := 0
+		done := make(chan struct{})
+		go func() {
+			sinkProcessor(ctx, cfg, eventsCh, store, progress, nil, funcSink(func(data []byte) error {
+				calls++
+				if calls == 1 {
+					return errors.New("broker down")
+				}
+				published = append(published, data)
+				return nil
+			}))
+			close(done)
+		}()
+		eventsCh <- Event{BlockNumber: 101, UserID: "user1"}
+		<-done
+
+		assert.Len(t, published, 1)
+		n, err := store.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(101), n)
+	})
+	t.Run("sink_processor_settles_async_publishes_on_flush", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		eventsCh := make(chan Event, 10)
+		cfg := config.SinkConfig{
+			BatchSize:     2,
+			FlushInterval: 50 * time.Millisecond,
+		}
+		deadLetters, err := dlq.Open(t.TempDir(), config.DefaultDLQSegmentSize)
+		assert.NoError(t, err)
+		defer deadLetters.Close()
+		progress := newProgressTracker(100)
+		progress.add(100, 3)
+		progress.markDone(100)
+
+		out := &asyncSink{fail: func(m []byte) error {
+			if strings.Contains(string(m), "0xbad") {
+				return errors.New("broker down")
+			}
+			return nil
+		}}
+		done := make(chan struct{})
+		go func() {
+			sinkProcessor(ctx, cfg, eventsCh, nil, progress, deadLetters, out)
+			close(done)
+		}()
+		eventsCh <- Event{BlockNumber: 100, TxHash: "0xabc", UserID: "user1"}
+		eventsCh <- Event{BlockNumber: 100, TxHash: "0xbad", UserID: "user1"}
+		eventsCh <- Event{BlockNumber: 100, TxHash: "0xdef", UserID: "user1"}
+		<-done
+
+		// the failed message is only known on flush, it still goes to the dlq
+		records, err := deadLetters.Pending(0)
+		assert.NoError(t, err)
+		assert.Len(t, records, 1)
+		assert.Contains(t, string(records[0].Message), "0xbad")
+		n, ok := progress.watermark()
+		assert.True(t, ok)
+		assert.Equal(t, uint64(100), n)
+		assert.GreaterOrEqual(t, out.flushes, 1)
+	})
+}
+
+func TestMessageKey(t *testing.T) {
+	ev := Event{
+		ID:        "id1",
+		Type:      "native",
+		UserID:    "user1",
+		From:      "0xAAA",
+		To:        "0xBBB",
+		TxHash:    "0xABC",
+		Direction: DirectionIn,
+	}
+
+	t.Run("message_key_by_user", func(t *testing.T) {
+		assert.Equal(t, "user1", string(messageKey(config.MessageKeyUser, ev)))
+		assert.Equal(t, "user1", string(messageKey("", ev)))
+	})
+	t.Run("message_key_by_address", func(t *testing.T) {
+		assert.Equal(t, "0xbbb", string(messageKey(config.MessageKeyAddress, ev)))
+		out := ev
+		out.Direction = DirectionOut
+		assert.Equal(t, "0xaaa", string(messageKey(config.MessageKeyAddress, out)))
+	})
+	t.Run("message_key_by_tx", func(t *testing.T) {
+		assert.Equal(t, "0xabc", string(messageKey(config.MessageKeyTxHash, ev)))
+	})
+	t.Run("message_key_by_event", func(t *testing.T) {
+		assert.Equal(t, "id1", string(messageKey(config.MessageKeyEvent, ev)))
+		confirmed := ev
+		confirmed.ID = "id1:confirmed"
+		assert.Equal(t, "id1", string(messageKey(config.MessageKeyEvent, confirmed)))
+	})
+	t.Run("message_headers", func(t *testing.T) {
+		headers := messageHeaders(config.SinkConfig{ChainID: 137}, ev)
+		assert.Equal(t, map[string]string{
+			"content-type":   "application/json",
+			"event-id":       "id1",
+			"event-type":     "native",
+			"chain-id":       "137",
+			"schema-version": EventSchemaVersion,
+		}, headers)
+	})
+}
+
+func TestEventID(t *testing.T) {
+	ev := Event{
+		Type:      EventTypeERC20,
+		UserID:    "user1",
+		TxHash:    "0xABC",
+		LogIndex:  "0x1",
+		Direction: DirectionIn,
+	}
+
+	t.Run("event_id_is_deterministic", func(t *testing.T) {
+		assert.Len(t, ev.eventID(), 32)
+		same := ev
+		same.TxHash = "0xabc"
+		same.AmountWei = "0x1"
+		assert.Equal(t, ev.eventID(), same.eventID())
+	})
+	t.Run("event_id_has_the_status", func(t *testing.T) {
+		confirmed := ev
+		confirmed.Status = EventStatusConfirmed
+		assert.Equal(t, ev.eventID()+":confirmed", confirmed.eventID())
+	})
+	t.Run("event_id_changes_with_the_transfer", func(t *testing.T) {
+		for _, change := range []func(e *Event){
+			func(e *Event) { e.LogIndex = "0x2" },
+			func(e *Event) { e.UserID = "user2" },
+			func(e *Event) { e.Direction = DirectionOut },
+			func(e *Event) { e.Type, e.LogIndex, e.TracePath = EventTypeNative, "", "0.1" },
+			func(e *Event) { e.BlockHash = "0xother" },
+		} {
+			other := ev
+			change(&other)
+			assert.NotEqual(t, ev.eventID(), other.eventID())
+		}
+	})
+	t.Run("event_id_of_a_transfer_included_again_after_a_reorg", func(t *testing.T) {
+		to := "0xd8da6bf26964af9d7eed9e03e53415d37aa96045"
+		tx := jsonrpc.Transaction{Hash: "0xtx1", From: "0x1234567890123456789012345678901234567890", To: &to, Value: "0x1"}
+		orphaned := jsonrpc.Block{Number: "0x64", Hash: "0xaaa", Transactions: []jsonrpc.Transaction{tx}}
+		canonical := jsonrpc.Block{Number: "0x64", Hash: "0xbbb", Transactions: []jsonrpc.Transaction{tx}}
+
+		original := matchBlock(orphaned, newMockAddressIndex())[0]
+		reverted := original
+		reverted.Status = EventStatusReverted
+		included := matchBlock(canonical, newMockAddressIndex())[0]
+
+		// a consumer dropping the ids it has seen must still credit the transfer again
+		seen := map[string]bool{}
+		for _, e := range []Event{original, reverted, included} {
+			id := e.eventID()
+			assert.False(t, seen[id], "duplicate id %s", id)
+			seen[id] = true
+		}
+	})
 }
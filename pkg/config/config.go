@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,6 +17,13 @@ var (
 	DefaultRpcUrl          = "https://ethereum-rpc.publicnode.com"
 	DefaultCheckpointStore = "./data/checkpoint"
 	DefaultAddressFile     = "./data/address.json"
+	DefaultDLQDir          = "./data/dlq"
+	DefaultSink            = "kafka"
+	DefaultSinkFile        = "./data/events.jsonl"
+	DefaultWebhookParkDir  = "./data/webhook"
+	DefaultMessageKey      = MessageKeyUser
+	DefaultChainID         = uint64(1)
+	DefaultEncoding        = EncodingJSON
 
 	DefaultHeadsChannelSize  = 64
 	DefaultBlocksChannelSize = 64
@@ -25,13 +33,64 @@ var (
 	DefaultBatchSize         = 50
 	DeaultJitterDeviation    = 0.2
 	DefaultMaxEnqueuePerTick = 64
+	DefaultReorgWindow       = 10
+	DefaultReorgMaxPending   = 256
+	DefaultFetchMaxAttempts  = 3
+	DefaultFailingThreshold  = 10
+	DefaultFetchBatchSize    = 16
+	DefaultBatchThreshold    = 32
+	DefaultConfirmationDepth = uint64(0)
+	DefaultHeadBlockTag      = "latest"
 
 	DefaultPollingInterval = 1 * time.Second
 	DefaultRequestTimeout  = 10 * time.Second
 	DefaultFlushInterval   = 200 * time.Millisecond
 
+	DefaultProviderMaxLag        = uint64(5)
+	DefaultProviderCheckInterval = 5 * time.Second
+	DefaultQuorumQuarantine      = 10 * time.Minute
+
+	// consecutive failures to open the circuit and how long until we probe the provider again
+	DefaultBreakerThreshold   = 5
+	DefaultBreakerOpenTimeout = 15 * time.Second
+
+	// per provider, the compute units are disabled by default
+	DefaultRpcRequestsPerSecond     = 25.0
+	DefaultRpcComputeUnitsPerSecond = 0.0
+	DefaultRpcMethodCost            = 20
+	// the cost of the methods we use, close to what the big providers charge
+	DefaultRpcMethodCosts = map[string]int{
+		"eth_blockNumber":           10,
+		"eth_getBlockByNumber":      16,
+		"eth_getLogs":               75,
+		"eth_getBlockReceipts":      500,
+		"eth_getTransactionReceipt": 15,
+		"debug_traceBlockByNumber":  500,
+		"trace_block":               500,
+	}
+
+	// the failed publishes are redelivered with backoff, 16MB segment files
+	DefaultDLQSegmentSize   = int64(16 << 20)
+	DefaultDLQRetryDelay    = 5 * time.Second
+	DefaultDLQMaxRetryDelay = 5 * time.Minute
+
+	// per endpoint, the deliveries that fail all the attempts are parked on disk
+	DefaultWebhookConcurrency    = 4
+	DefaultWebhookMaxAttempts    = 5
+	DefaultWebhookRetryBaseDelay = 500 * time.Millisecond
+	DefaultWebhookRetryMaxDelay  = 30 * time.Second
+
+	DefaultWSReconnectDelay    = 1 * time.Second
+	DefaultWSMaxReconnectDelay = 30 * time.Second
+
 	DefauftKafkaTopic   = "de-crypto-events"
 	DefauftKafkaBrokers = []string{"localhost:9092"}
+
+	// only used when we create the topic, the retention and the cleanup policy
+	// keep the broker defaults when they are not set
+	DefaultKafkaPartitions        = 1
+	DefaultKafkaReplicationFactor = 1
+	DefaultKafkaCompression       = CompressionNone
 )
 
 type HeadMonitorConfig struct {
@@ -41,6 +100,27 @@ type HeadMonitorConfig struct {
 	// cool thing, I had problems with the buffer blocking the io so I figure it out,
 	// we will ignore when the queue is full
 	MaxEnqueuePerTick int
+	// only blocks with at least this amount of blocks on top of them are processed
+	ConfirmationDepth uint64
+	// dual mode, blocks are processed at inclusion with unconfirmed events and
+	// a confirmed event is sent again after ConfirmationDepth blocks
+	EmitUnconfirmed bool
+	// latest, safe or finalized, the block of the tag is used as the upper bound
+	BlockTag string
+	// how many heights past the first incomplete one we send, 0 has no limit
+	MaxAhead uint64
+}
+
+// EnrichConfig says what we fetch besides the block itself
+type EnrichConfig struct {
+	// ERC-20 Transfer logs with eth_getLogs
+	TokenTransfers bool
+	// internal transfers with the trace apis, debug or parity, empty disables it
+	TraceMode string
+	// transaction receipts with eth_getBlockReceipts, for the status and the fee
+	Receipts bool
+	// drops the transactions that failed, needs the receipts
+	SkipFailedTxs bool
 }
 
 type BlockFetcherConfig struct {
@@ -49,20 +129,145 @@ type BlockFetcherConfig struct {
 	RetryBaseDelay time.Duration
 	RetryMaxDelay  time.Duration
 	Jitter         float64
+	// attempts in the worker before the height goes to the retry queue
+	MaxAttempts int
+	// after this amount of failures the height is reported as failing persistently
+	FailingThreshold int
+	// when at least BatchThreshold heights are waiting the workers get up to BatchSize
+	// blocks in one request, a BatchSize of 0 or 1 disables the batches
+	BatchSize      int
+	BatchThreshold int
+	Enrich         EnrichConfig
+}
+
+type ReorgConfig struct {
+	// how many recent blocks we keep to validate the parent hashes
+	Window     int
+	StartFrom  uint64
+	ReqTimeout time.Duration
+	RetryDelay time.Duration
+	// after this amount of buffered blocks we warn that a missing height is holding the pipeline
+	MaxPending int
+	// when set we send the confirmed events for the block that reached this depth
+	ConfirmationDepth uint64
+	// the canonical blocks we refetch must have the same data the fetcher gets
+	Enrich EnrichConfig
 }
 
 type FilterConfig struct {
 	Workers int
+	// mark the events as unconfirmed, used in the dual mode
+	EmitUnconfirmed bool
 }
 
+// what the messages are keyed by, the messages with the same key keep their order
+const (
+	MessageKeyUser    = "user"
+	MessageKeyAddress = "address"
+	MessageKeyTxHash  = "tx"
+	// no order between the events, they spread over all the partitions
+	MessageKeyEvent = "event"
+)
+
+// how the events are encoded, protobuf and avro follow the schemas of the events
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+	EncodingAvro     = "avro"
+)
+
+// the CloudEvents modes, the envelope in the body or the attributes in the kafka headers
+const (
+	CloudEventsStructured = "structured"
+	CloudEventsBinary     = "binary"
+)
+
 type SinkConfig struct {
 	FlushInterval time.Duration
 	BatchSize     int
+	MessageKey    string
+	ChainID       uint64
+	Encoding      string
+	// the id of the schema in the registry, 0 sends the messages without the wire format prefix
+	SchemaID int
+	// empty sends the events without the CloudEvents envelope
+	CloudEvents       string
+	CloudEventsSource string
+}
+
+type SchemaRegistryConfig struct {
+	URL      string
+	Username string
+	Password string
+	// when false the schema must be registered already, we only look up its id
+	AutoRegister bool
 }
 
+type WebhookConfig struct {
+	URLs []string
+	// the bodies are signed with HMAC-SHA256 when there is a secret
+	Secret string
+	// send the events of a batch in one request, as a json array
+	Batch          bool
+	Concurrency    int
+	MaxAttempts    int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	ParkDir        string
+}
+
+// the cleanup policies of a topic
+const (
+	CleanupPolicyDelete        = "delete"
+	CleanupPolicyCompact       = "compact"
+	CleanupPolicyCompactDelete = "compact,delete"
+)
+
+// the compression codecs of the kafka batches
+const (
+	CompressionNone   = "none"
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+	CompressionLz4    = "lz4"
+	CompressionZstd   = "zstd"
+)
+
+// the SASL mechanisms, empty disables SASL
+const (
+	SASLPlain       = "plain"
+	SASLScramSHA256 = "scram-sha-256"
+	SASLScramSHA512 = "scram-sha-512"
+)
+
 type KafkaConfig struct {
 	Brokers []string
 	Topic   string
+	// the topic is created with these settings, an existing topic must match the ones that
+	// are set, 0 or empty is not checked
+	Partitions        int
+	ReplicationFactor int
+	Retention         time.Duration
+	CleanupPolicy     string
+	TLS               KafkaTLSConfig
+	SASL              KafkaSASLConfig
+	// the writer doesn't wait for the brokers, the results come on Flush
+	Async       bool
+	Compression string
+}
+
+type KafkaTLSConfig struct {
+	Enabled bool
+	// the CA of the brokers, the system pool is used when empty
+	CAFile string
+	// the client certificate, for mTLS
+	CertFile string
+	KeyFile  string
+}
+
+type KafkaSASLConfig struct {
+	Mechanism string
+	Username  string
+	Password  string
 }
 
 func GetAddressFile() string {
@@ -93,6 +298,383 @@ func getProviderURL() string {
 	return DefaultRpcUrl
 }
 
+func GetDLQDir() string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	dir := os.Getenv("DLQ_DIR")
+	if dir != "" {
+		return dir
+	}
+
+	return DefaultDLQDir
+}
+
+// GetRpcUrls returns the providers for the multi provider client, comma separated in RPC_URLS
+func GetRpcUrls() []string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	var urls []string
+	for _, u := range strings.Split(os.Getenv("RPC_URLS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) > 0 {
+		return urls
+	}
+
+	return []string{CliUrl}
+}
+
+// GetQuorum returns how many providers must agree on a block, 0 disables the quorum mode
+func GetQuorum() int {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	quorum := os.Getenv("QUORUM")
+	if quorum != "" {
+		n, err := strconv.Atoi(quorum)
+		if err == nil && n >= 0 {
+			return n
+		}
+		log.Printf("invalid QUORUM %q using fallback", quorum)
+	}
+
+	return 0
+}
+
+func GetRpcRequestsPerSecond() float64 {
+	return getRate("RPC_RPS", DefaultRpcRequestsPerSecond)
+}
+
+func GetRpcComputeUnitsPerSecond() float64 {
+	return getRate("RPC_CU_PER_SECOND", DefaultRpcComputeUnitsPerSecond)
+}
+
+// 0 disables the limit
+func getRate(env string, fallback float64) float64 {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	rate := os.Getenv(env)
+	if rate != "" {
+		f, err := strconv.ParseFloat(rate, 64)
+		if err == nil && f >= 0 {
+			return f
+		}
+		log.Printf("invalid %s %q using fallback", env, rate)
+	}
+
+	return fallback
+}
+
+// GetRpcMethodCosts returns the compute units of the methods, RPC_METHOD_COSTS overrides
+// the defaults with a list like eth_getLogs=75,trace_block=300
+func GetRpcMethodCosts() map[string]int {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	costs := make(map[string]int, len(DefaultRpcMethodCosts))
+	for m, c := range DefaultRpcMethodCosts {
+		costs[m] = c
+	}
+
+	for _, kv := range strings.Split(os.Getenv("RPC_METHOD_COSTS"), ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		method, cost, ok := strings.Cut(kv, "=")
+		c, err := strconv.Atoi(strings.TrimSpace(cost))
+		if !ok || err != nil || c < 0 {
+			log.Printf("invalid RPC_METHOD_COSTS entry %q ignored", kv)
+			continue
+		}
+		costs[strings.TrimSpace(method)] = c
+	}
+
+	return costs
+}
+
+func GetConfirmationDepth() uint64 {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	depth := os.Getenv("CONFIRMATION_DEPTH")
+	if depth != "" {
+		n, err := strconv.ParseUint(depth, 10, 64)
+		if err == nil {
+			return n
+		}
+		log.Printf("invalid CONFIRMATION_DEPTH %q using fallback", depth)
+	}
+
+	return DefaultConfirmationDepth
+}
+
+func GetEmitUnconfirmed() bool {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	emit := os.Getenv("EMIT_UNCONFIRMED")
+	if emit != "" {
+		b, err := strconv.ParseBool(emit)
+		if err == nil {
+			return b
+		}
+		log.Printf("invalid EMIT_UNCONFIRMED %q using fallback", emit)
+	}
+
+	return false
+}
+
+func GetHeadBlockTag() string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	tag := strings.ToLower(os.Getenv("HEAD_BLOCK_TAG"))
+	switch tag {
+	case "latest", "safe", "finalized":
+		return tag
+	case "":
+	default:
+		log.Printf("invalid HEAD_BLOCK_TAG %q using fallback", tag)
+	}
+
+	return DefaultHeadBlockTag
+}
+
+// GetWSUrl returns the websocket url for the newHeads subscription, without it we only poll
+func GetWSUrl() string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	return os.Getenv("WS_URL")
+}
+
+func GetTokenTransfers() bool {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	enabled := os.Getenv("TOKEN_TRANSFERS")
+	if enabled != "" {
+		b, err := strconv.ParseBool(enabled)
+		if err == nil {
+			return b
+		}
+		log.Printf("invalid TOKEN_TRANSFERS %q using fallback", enabled)
+	}
+
+	return false
+}
+
+func GetTraceMode() string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	mode := strings.ToLower(os.Getenv("TRACE_MODE"))
+	switch mode {
+	case "debug", "parity":
+		return mode
+	case "":
+	default:
+		log.Printf("invalid TRACE_MODE %q using fallback", mode)
+	}
+
+	return ""
+}
+
+func GetReceipts() bool {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	enabled := os.Getenv("RECEIPTS")
+	if enabled != "" {
+		b, err := strconv.ParseBool(enabled)
+		if err == nil {
+			return b
+		}
+		log.Printf("invalid RECEIPTS %q using fallback", enabled)
+	}
+
+	return false
+}
+
+func GetSkipFailedTxs() bool {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	enabled := os.Getenv("SKIP_FAILED_TXS")
+	if enabled != "" {
+		b, err := strconv.ParseBool(enabled)
+		if err == nil {
+			return b
+		}
+		log.Printf("invalid SKIP_FAILED_TXS %q using fallback", enabled)
+	}
+
+	return false
+}
+
+// GetSink returns where the events go: kafka, stdout, file (json lines in SINK_FILE) or webhook
+func GetSink() string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	sink := strings.ToLower(os.Getenv("SINK"))
+	switch sink {
+	case "kafka", "stdout", "file", "webhook":
+		return sink
+	case "":
+	default:
+		log.Printf("invalid SINK %q using fallback", sink)
+	}
+
+	return DefaultSink
+}
+
+func GetSinkFile() string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	path := os.Getenv("SINK_FILE")
+	if path != "" {
+		return path
+	}
+
+	return DefaultSinkFile
+}
+
+// GetMessageKey returns what the messages are keyed by: user, address, tx or event
+func GetMessageKey() string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	key := strings.ToLower(os.Getenv("MESSAGE_KEY"))
+	switch key {
+	case MessageKeyUser, MessageKeyAddress, MessageKeyTxHash, MessageKeyEvent:
+		return key
+	case "":
+	default:
+		log.Printf("invalid MESSAGE_KEY %q using fallback", key)
+	}
+
+	return DefaultMessageKey
+}
+
+func GetChainID() uint64 {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	chainID := os.Getenv("CHAIN_ID")
+	if chainID != "" {
+		n, err := strconv.ParseUint(chainID, 10, 64)
+		if err == nil && n > 0 {
+			return n
+		}
+		log.Printf("invalid CHAIN_ID %q using fallback", chainID)
+	}
+
+	return DefaultChainID
+}
+
+// GetWebhookUrls returns the endpoints of the webhook sink, comma separated in WEBHOOK_URLS
+func GetWebhookUrls() []string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	var urls []string
+	for _, u := range strings.Split(os.Getenv("WEBHOOK_URLS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+func GetWebhookSecret() string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	return os.Getenv("WEBHOOK_SECRET")
+}
+
+func GetWebhookBatch() bool {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	batch := os.Getenv("WEBHOOK_BATCH")
+	if batch != "" {
+		b, err := strconv.ParseBool(batch)
+		if err == nil {
+			return b
+		}
+		log.Printf("invalid WEBHOOK_BATCH %q using fallback", batch)
+	}
+
+	return false
+}
+
+// GetWebhookConcurrency returns how many requests can be in flight to each endpoint
+func GetWebhookConcurrency() int {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	concurrency := os.Getenv("WEBHOOK_CONCURRENCY")
+	if concurrency != "" {
+		n, err := strconv.Atoi(concurrency)
+		if err == nil && n > 0 {
+			return n
+		}
+		log.Printf("invalid WEBHOOK_CONCURRENCY %q using fallback", concurrency)
+	}
+
+	return DefaultWebhookConcurrency
+}
+
 func GetKafakTopic() string {
 	err := godotenv.Load()
 	if err != nil {
@@ -120,3 +702,258 @@ func GetKafakBrokers() []string {
 
 	return DefauftKafkaBrokers
 }
+
+// GetKafkaPartitions returns the partitions of the topic, 0 when it is not set: a new topic
+// gets DefaultKafkaPartitions and an existing one is not checked
+func GetKafkaPartitions() int {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	partitions := os.Getenv("KAFKA_PARTITIONS")
+	if partitions != "" {
+		n, err := strconv.Atoi(partitions)
+		if err == nil && n > 0 {
+			return n
+		}
+		log.Printf("invalid KAFKA_PARTITIONS %q using fallback", partitions)
+	}
+
+	return 0
+}
+
+// GetKafkaReplicationFactor works like GetKafkaPartitions, DefaultKafkaReplicationFactor
+// is only for a new topic
+func GetKafkaReplicationFactor() int {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	replication := os.Getenv("KAFKA_REPLICATION_FACTOR")
+	if replication != "" {
+		n, err := strconv.Atoi(replication)
+		if err == nil && n > 0 {
+			return n
+		}
+		log.Printf("invalid KAFKA_REPLICATION_FACTOR %q using fallback", replication)
+	}
+
+	return 0
+}
+
+// GetKafkaRetention returns how long the topic keeps the events, like 168h, 0 keeps
+// the broker default
+func GetKafkaRetention() time.Duration {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	retention := os.Getenv("KAFKA_RETENTION")
+	if retention != "" {
+		d, err := time.ParseDuration(retention)
+		if err == nil && d > 0 {
+			return d
+		}
+		log.Printf("invalid KAFKA_RETENTION %q using fallback", retention)
+	}
+
+	return 0
+}
+
+// GetKafkaCleanupPolicy returns delete, compact or both, empty keeps the broker default
+func GetKafkaCleanupPolicy() string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	policy := strings.ReplaceAll(strings.ToLower(os.Getenv("KAFKA_CLEANUP_POLICY")), " ", "")
+	switch policy {
+	case "":
+	case CleanupPolicyDelete, CleanupPolicyCompact, CleanupPolicyCompactDelete:
+		return policy
+	case "delete,compact":
+		return CleanupPolicyCompactDelete
+	default:
+		log.Printf("invalid KAFKA_CLEANUP_POLICY %q using fallback", policy)
+	}
+
+	return ""
+}
+
+// GetKafkaTLS returns the TLS settings of the brokers, setting any of the files enables it
+func GetKafkaTLS() KafkaTLSConfig {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	cfg := KafkaTLSConfig{
+		CAFile:   os.Getenv("KAFKA_TLS_CA_FILE"),
+		CertFile: os.Getenv("KAFKA_TLS_CERT_FILE"),
+		KeyFile:  os.Getenv("KAFKA_TLS_KEY_FILE"),
+	}
+	cfg.Enabled = cfg.CAFile != "" || cfg.CertFile != ""
+
+	enabled := os.Getenv("KAFKA_TLS")
+	if enabled != "" {
+		b, err := strconv.ParseBool(enabled)
+		if err == nil {
+			cfg.Enabled = cfg.Enabled || b
+		} else {
+			log.Printf("invalid KAFKA_TLS %q using fallback", enabled)
+		}
+	}
+
+	return cfg
+}
+
+// GetKafkaSASL returns the SASL credentials, the mechanism is plain, scram-sha-256 or scram-sha-512
+func GetKafkaSASL() KafkaSASLConfig {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	cfg := KafkaSASLConfig{
+		Username: os.Getenv("KAFKA_SASL_USERNAME"),
+		Password: os.Getenv("KAFKA_SASL_PASSWORD"),
+	}
+
+	mechanism := strings.ToLower(os.Getenv("KAFKA_SASL_MECHANISM"))
+	switch mechanism {
+	case "":
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+		cfg.Mechanism = mechanism
+	default:
+		log.Printf("invalid KAFKA_SASL_MECHANISM %q using fallback", mechanism)
+	}
+
+	return cfg
+}
+
+// GetKafkaAsync says if the publisher sends the batches without waiting for the brokers
+func GetKafkaAsync() bool {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	async := os.Getenv("KAFKA_ASYNC")
+	if async != "" {
+		b, err := strconv.ParseBool(async)
+		if err == nil {
+			return b
+		}
+		log.Printf("invalid KAFKA_ASYNC %q using fallback", async)
+	}
+
+	return false
+}
+
+// GetKafkaCompression returns the codec of the batches: none, gzip, snappy, lz4 or zstd
+func GetKafkaCompression() string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	compression := strings.ToLower(os.Getenv("KAFKA_COMPRESSION"))
+	switch compression {
+	case "":
+	case CompressionNone, CompressionGzip, CompressionSnappy, CompressionLz4, CompressionZstd:
+		return compression
+	default:
+		log.Printf("invalid KAFKA_COMPRESSION %q using fallback", compression)
+	}
+
+	return DefaultKafkaCompression
+}
+
+// GetKafkaEncoding returns how the kafka messages are encoded: json, protobuf or avro
+func GetKafkaEncoding() string {
+	return getEncoding("KAFKA_ENCODING")
+}
+
+// GetWebhookEncoding returns how the webhook bodies are encoded: json, protobuf or avro
+func GetWebhookEncoding() string {
+	return getEncoding("WEBHOOK_ENCODING")
+}
+
+func getEncoding(env string) string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	encoding := strings.ToLower(os.Getenv(env))
+	switch encoding {
+	case "":
+	case EncodingJSON, EncodingProtobuf, EncodingAvro:
+		return encoding
+	default:
+		log.Printf("invalid %s %q using fallback", env, encoding)
+	}
+
+	return DefaultEncoding
+}
+
+// GetSchemaRegistry returns the schema registry, without SCHEMA_REGISTRY_URL the schemas are
+// not registered and the messages have no schema id
+func GetSchemaRegistry() SchemaRegistryConfig {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	cfg := SchemaRegistryConfig{
+		URL:          os.Getenv("SCHEMA_REGISTRY_URL"),
+		Username:     os.Getenv("SCHEMA_REGISTRY_USERNAME"),
+		Password:     os.Getenv("SCHEMA_REGISTRY_PASSWORD"),
+		AutoRegister: true,
+	}
+
+	autoRegister := os.Getenv("SCHEMA_REGISTRY_AUTO_REGISTER")
+	if autoRegister != "" {
+		b, err := strconv.ParseBool(autoRegister)
+		if err == nil {
+			cfg.AutoRegister = b
+		} else {
+			log.Printf("invalid SCHEMA_REGISTRY_AUTO_REGISTER %q using fallback", autoRegister)
+		}
+	}
+
+	return cfg
+}
+
+// GetCloudEvents returns the CloudEvents mode, structured or binary, empty when disabled
+func GetCloudEvents() string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	mode := strings.ToLower(os.Getenv("CLOUDEVENTS"))
+	switch mode {
+	case "":
+	case CloudEventsStructured, CloudEventsBinary:
+		return mode
+	default:
+		log.Printf("invalid CLOUDEVENTS %q using fallback", mode)
+	}
+
+	return ""
+}
+
+// GetCloudEventsSource returns the source of the CloudEvents, empty uses the chain id
+func GetCloudEventsSource() string {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf(".env not found using fallbacks")
+	}
+
+	return os.Getenv("CLOUDEVENTS_SOURCE")
+}
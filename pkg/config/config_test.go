@@ -43,6 +43,9 @@ func TestConfigConstants(t *testing.T) {
 	t.Run("verify_default_address_file", func(t *testing.T) {
 		assert.Equal(t, "./data/address.json", DefaultAddressFile)
 	})
+	t.Run("verify_default_dlq_dir", func(t *testing.T) {
+		assert.Equal(t, "./data/dlq", DefaultDLQDir)
+	})
 	t.Run("verify_default_heads_channel_size", func(t *testing.T) {
 		assert.Equal(t, 64, DefaultHeadsChannelSize)
 	})
@@ -64,6 +67,18 @@ func TestConfigConstants(t *testing.T) {
 	t.Run("verify_default_max_enqueue_per_tick", func(t *testing.T) {
 		assert.Equal(t, 64, DefaultMaxEnqueuePerTick)
 	})
+	t.Run("verify_default_reorg_window", func(t *testing.T) {
+		assert.Equal(t, 10, DefaultReorgWindow)
+	})
+	t.Run("verify_default_reorg_max_pending", func(t *testing.T) {
+		assert.Equal(t, 256, DefaultReorgMaxPending)
+	})
+	t.Run("verify_default_fetch_max_attempts", func(t *testing.T) {
+		assert.Equal(t, 3, DefaultFetchMaxAttempts)
+	})
+	t.Run("verify_default_failing_threshold", func(t *testing.T) {
+		assert.Equal(t, 10, DefaultFailingThreshold)
+	})
 	t.Run("verify_default_polling_interval", func(t *testing.T) {
 		assert.Equal(t, 1*time.Second, DefaultPollingInterval)
 	})
@@ -101,6 +116,346 @@ func TestGetAddressFile(t *testing.T) {
 	})
 }
 
+func TestGetDLQDir(t *testing.T) {
+	t.Run("get_dlq_dir_with_env_variable", func(t *testing.T) {
+		os.Setenv("DLQ_DIR", "/custom/dlq")
+		defer os.Unsetenv("DLQ_DIR")
+		assert.Equal(t, "/custom/dlq", GetDLQDir())
+	})
+	t.Run("get_dlq_dir_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("DLQ_DIR")
+		assert.Equal(t, DefaultDLQDir, GetDLQDir())
+	})
+}
+
+func TestGetConfirmationDepth(t *testing.T) {
+	t.Run("get_confirmation_depth_with_env_variable", func(t *testing.T) {
+		os.Setenv("CONFIRMATION_DEPTH", "12")
+		defer os.Unsetenv("CONFIRMATION_DEPTH")
+		assert.Equal(t, uint64(12), GetConfirmationDepth())
+	})
+	t.Run("get_confirmation_depth_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("CONFIRMATION_DEPTH")
+		assert.Equal(t, DefaultConfirmationDepth, GetConfirmationDepth())
+	})
+	t.Run("get_confirmation_depth_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("CONFIRMATION_DEPTH", "-1")
+		defer os.Unsetenv("CONFIRMATION_DEPTH")
+		assert.Equal(t, DefaultConfirmationDepth, GetConfirmationDepth())
+	})
+}
+
+func TestGetEmitUnconfirmed(t *testing.T) {
+	t.Run("get_emit_unconfirmed_with_env_variable", func(t *testing.T) {
+		os.Setenv("EMIT_UNCONFIRMED", "true")
+		defer os.Unsetenv("EMIT_UNCONFIRMED")
+		assert.True(t, GetEmitUnconfirmed())
+	})
+	t.Run("get_emit_unconfirmed_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("EMIT_UNCONFIRMED")
+		assert.False(t, GetEmitUnconfirmed())
+	})
+	t.Run("get_emit_unconfirmed_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("EMIT_UNCONFIRMED", "maybe")
+		defer os.Unsetenv("EMIT_UNCONFIRMED")
+		assert.False(t, GetEmitUnconfirmed())
+	})
+}
+
+func TestGetHeadBlockTag(t *testing.T) {
+	t.Run("get_head_block_tag_with_env_variable", func(t *testing.T) {
+		os.Setenv("HEAD_BLOCK_TAG", "Finalized")
+		defer os.Unsetenv("HEAD_BLOCK_TAG")
+		assert.Equal(t, "finalized", GetHeadBlockTag())
+	})
+	t.Run("get_head_block_tag_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("HEAD_BLOCK_TAG")
+		assert.Equal(t, DefaultHeadBlockTag, GetHeadBlockTag())
+	})
+	t.Run("get_head_block_tag_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("HEAD_BLOCK_TAG", "pending")
+		defer os.Unsetenv("HEAD_BLOCK_TAG")
+		assert.Equal(t, DefaultHeadBlockTag, GetHeadBlockTag())
+	})
+}
+
+func TestGetSink(t *testing.T) {
+	t.Run("get_sink_with_env_variable", func(t *testing.T) {
+		os.Setenv("SINK", "Stdout")
+		defer os.Unsetenv("SINK")
+		assert.Equal(t, "stdout", GetSink())
+	})
+	t.Run("get_sink_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("SINK")
+		assert.Equal(t, DefaultSink, GetSink())
+	})
+	t.Run("get_sink_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("SINK", "rabbitmq")
+		defer os.Unsetenv("SINK")
+		assert.Equal(t, DefaultSink, GetSink())
+	})
+}
+
+func TestGetSinkFile(t *testing.T) {
+	t.Run("get_sink_file_with_env_variable", func(t *testing.T) {
+		os.Setenv("SINK_FILE", "/tmp/events.jsonl")
+		defer os.Unsetenv("SINK_FILE")
+		assert.Equal(t, "/tmp/events.jsonl", GetSinkFile())
+	})
+	t.Run("get_sink_file_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("SINK_FILE")
+		assert.Equal(t, DefaultSinkFile, GetSinkFile())
+	})
+}
+
+func TestGetMessageKey(t *testing.T) {
+	t.Run("get_message_key_with_env_variable", func(t *testing.T) {
+		os.Setenv("MESSAGE_KEY", "TX")
+		defer os.Unsetenv("MESSAGE_KEY")
+		assert.Equal(t, MessageKeyTxHash, GetMessageKey())
+		os.Setenv("MESSAGE_KEY", "event")
+		assert.Equal(t, MessageKeyEvent, GetMessageKey())
+	})
+	t.Run("get_message_key_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("MESSAGE_KEY")
+		assert.Equal(t, MessageKeyUser, GetMessageKey())
+	})
+	t.Run("get_message_key_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("MESSAGE_KEY", "block")
+		defer os.Unsetenv("MESSAGE_KEY")
+		assert.Equal(t, DefaultMessageKey, GetMessageKey())
+	})
+}
+
+func TestGetChainID(t *testing.T) {
+	t.Run("get_chain_id_with_env_variable", func(t *testing.T) {
+		os.Setenv("CHAIN_ID", "11155111")
+		defer os.Unsetenv("CHAIN_ID")
+		assert.Equal(t, uint64(11155111), GetChainID())
+	})
+	t.Run("get_chain_id_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("CHAIN_ID")
+		assert.Equal(t, DefaultChainID, GetChainID())
+	})
+	t.Run("get_chain_id_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("CHAIN_ID", "mainnet")
+		defer os.Unsetenv("CHAIN_ID")
+		assert.Equal(t, DefaultChainID, GetChainID())
+	})
+}
+
+func TestGetWebhookUrls(t *testing.T) {
+	t.Run("get_webhook_urls_with_env_variable", func(t *testing.T) {
+		os.Setenv("WEBHOOK_URLS", "https://a.com/hook, https://b.com/hook,")
+		defer os.Unsetenv("WEBHOOK_URLS")
+		assert.Equal(t, []string{"https://a.com/hook", "https://b.com/hook"}, GetWebhookUrls())
+	})
+	t.Run("get_webhook_urls_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("WEBHOOK_URLS")
+		assert.Empty(t, GetWebhookUrls())
+	})
+}
+
+func TestGetWebhookSecret(t *testing.T) {
+	t.Run("get_webhook_secret_with_env_variable", func(t *testing.T) {
+		os.Setenv("WEBHOOK_SECRET", "s3cr3t")
+		defer os.Unsetenv("WEBHOOK_SECRET")
+		assert.Equal(t, "s3cr3t", GetWebhookSecret())
+	})
+	t.Run("get_webhook_secret_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("WEBHOOK_SECRET")
+		assert.Empty(t, GetWebhookSecret())
+	})
+}
+
+func TestGetWebhookBatch(t *testing.T) {
+	t.Run("get_webhook_batch_with_env_variable", func(t *testing.T) {
+		os.Setenv("WEBHOOK_BATCH", "true")
+		defer os.Unsetenv("WEBHOOK_BATCH")
+		assert.True(t, GetWebhookBatch())
+	})
+	t.Run("get_webhook_batch_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("WEBHOOK_BATCH")
+		assert.False(t, GetWebhookBatch())
+	})
+	t.Run("get_webhook_batch_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("WEBHOOK_BATCH", "maybe")
+		defer os.Unsetenv("WEBHOOK_BATCH")
+		assert.False(t, GetWebhookBatch())
+	})
+}
+
+func TestGetWebhookConcurrency(t *testing.T) {
+	t.Run("get_webhook_concurrency_with_env_variable", func(t *testing.T) {
+		os.Setenv("WEBHOOK_CONCURRENCY", "16")
+		defer os.Unsetenv("WEBHOOK_CONCURRENCY")
+		assert.Equal(t, 16, GetWebhookConcurrency())
+	})
+	t.Run("get_webhook_concurrency_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("WEBHOOK_CONCURRENCY")
+		assert.Equal(t, DefaultWebhookConcurrency, GetWebhookConcurrency())
+	})
+	t.Run("get_webhook_concurrency_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("WEBHOOK_CONCURRENCY", "0")
+		defer os.Unsetenv("WEBHOOK_CONCURRENCY")
+		assert.Equal(t, DefaultWebhookConcurrency, GetWebhookConcurrency())
+	})
+}
+
+func TestGetRpcUrls(t *testing.T) {
+	t.Run("get_rpc_urls_with_env_variable", func(t *testing.T) {
+		os.Setenv("RPC_URLS", "https://a.com, https://b.com,,")
+		defer os.Unsetenv("RPC_URLS")
+		assert.Equal(t, []string{"https://a.com", "https://b.com"}, GetRpcUrls())
+	})
+	t.Run("get_rpc_urls_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("RPC_URLS")
+		assert.Equal(t, []string{CliUrl}, GetRpcUrls())
+	})
+}
+
+func TestGetQuorum(t *testing.T) {
+	t.Run("get_quorum_with_env_variable", func(t *testing.T) {
+		os.Setenv("QUORUM", "2")
+		defer os.Unsetenv("QUORUM")
+		assert.Equal(t, 2, GetQuorum())
+	})
+	t.Run("get_quorum_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("QUORUM")
+		assert.Equal(t, 0, GetQuorum())
+	})
+	t.Run("get_quorum_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("QUORUM", "-1")
+		defer os.Unsetenv("QUORUM")
+		assert.Equal(t, 0, GetQuorum())
+	})
+}
+
+func TestGetRpcRequestsPerSecond(t *testing.T) {
+	t.Run("get_rpc_requests_per_second_with_env_variable", func(t *testing.T) {
+		os.Setenv("RPC_RPS", "12.5")
+		defer os.Unsetenv("RPC_RPS")
+		assert.Equal(t, 12.5, GetRpcRequestsPerSecond())
+	})
+	t.Run("get_rpc_requests_per_second_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("RPC_RPS")
+		assert.Equal(t, DefaultRpcRequestsPerSecond, GetRpcRequestsPerSecond())
+	})
+	t.Run("get_rpc_requests_per_second_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("RPC_RPS", "fast")
+		defer os.Unsetenv("RPC_RPS")
+		assert.Equal(t, DefaultRpcRequestsPerSecond, GetRpcRequestsPerSecond())
+	})
+}
+
+func TestGetRpcComputeUnitsPerSecond(t *testing.T) {
+	t.Run("get_rpc_compute_units_per_second_with_env_variable", func(t *testing.T) {
+		os.Setenv("RPC_CU_PER_SECOND", "330")
+		defer os.Unsetenv("RPC_CU_PER_SECOND")
+		assert.Equal(t, 330.0, GetRpcComputeUnitsPerSecond())
+	})
+	t.Run("get_rpc_compute_units_per_second_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("RPC_CU_PER_SECOND")
+		assert.Equal(t, 0.0, GetRpcComputeUnitsPerSecond())
+	})
+}
+
+func TestGetRpcMethodCosts(t *testing.T) {
+	t.Run("get_rpc_method_costs_with_env_variable", func(t *testing.T) {
+		os.Setenv("RPC_METHOD_COSTS", "eth_getLogs=60, eth_call=26,invalid")
+		defer os.Unsetenv("RPC_METHOD_COSTS")
+		costs := GetRpcMethodCosts()
+		assert.Equal(t, 60, costs["eth_getLogs"])
+		assert.Equal(t, 26, costs["eth_call"])
+		assert.Equal(t, DefaultRpcMethodCosts["eth_blockNumber"], costs["eth_blockNumber"])
+		assert.Equal(t, 75, DefaultRpcMethodCosts["eth_getLogs"])
+	})
+	t.Run("get_rpc_method_costs_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("RPC_METHOD_COSTS")
+		assert.Equal(t, DefaultRpcMethodCosts, GetRpcMethodCosts())
+	})
+}
+
+func TestGetWSUrl(t *testing.T) {
+	t.Run("get_ws_url_with_env_variable", func(t *testing.T) {
+		os.Setenv("WS_URL", "wss://test-rpc.com")
+		defer os.Unsetenv("WS_URL")
+		assert.Equal(t, "wss://test-rpc.com", GetWSUrl())
+	})
+	t.Run("get_ws_url_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("WS_URL")
+		assert.Equal(t, "", GetWSUrl())
+	})
+}
+
+func TestGetTokenTransfers(t *testing.T) {
+	t.Run("get_token_transfers_with_env_variable", func(t *testing.T) {
+		os.Setenv("TOKEN_TRANSFERS", "1")
+		defer os.Unsetenv("TOKEN_TRANSFERS")
+		assert.True(t, GetTokenTransfers())
+	})
+	t.Run("get_token_transfers_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("TOKEN_TRANSFERS")
+		assert.False(t, GetTokenTransfers())
+	})
+	t.Run("get_token_transfers_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("TOKEN_TRANSFERS", "yes please")
+		defer os.Unsetenv("TOKEN_TRANSFERS")
+		assert.False(t, GetTokenTransfers())
+	})
+}
+
+func TestGetTraceMode(t *testing.T) {
+	t.Run("get_trace_mode_with_env_variable", func(t *testing.T) {
+		os.Setenv("TRACE_MODE", "Parity")
+		defer os.Unsetenv("TRACE_MODE")
+		assert.Equal(t, "parity", GetTraceMode())
+	})
+	t.Run("get_trace_mode_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("TRACE_MODE")
+		assert.Equal(t, "", GetTraceMode())
+	})
+	t.Run("get_trace_mode_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("TRACE_MODE", "trace_filter")
+		defer os.Unsetenv("TRACE_MODE")
+		assert.Equal(t, "", GetTraceMode())
+	})
+}
+
+func TestGetReceipts(t *testing.T) {
+	t.Run("get_receipts_with_env_variable", func(t *testing.T) {
+		os.Setenv("RECEIPTS", "true")
+		defer os.Unsetenv("RECEIPTS")
+		assert.True(t, GetReceipts())
+	})
+	t.Run("get_receipts_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("RECEIPTS")
+		assert.False(t, GetReceipts())
+	})
+	t.Run("get_receipts_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("RECEIPTS", "maybe")
+		defer os.Unsetenv("RECEIPTS")
+		assert.False(t, GetReceipts())
+	})
+}
+
+func TestGetSkipFailedTxs(t *testing.T) {
+	t.Run("get_skip_failed_txs_with_env_variable", func(t *testing.T) {
+		os.Setenv("SKIP_FAILED_TXS", "true")
+		defer os.Unsetenv("SKIP_FAILED_TXS")
+		assert.True(t, GetSkipFailedTxs())
+	})
+	t.Run("get_skip_failed_txs_without_env_variable", func(t *testing.T) {
+		os.Unsetenv("SKIP_FAILED_TXS")
+		assert.False(t, GetSkipFailedTxs())
+	})
+	t.Run("get_skip_failed_txs_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("SKIP_FAILED_TXS", "maybe")
+		defer os.Unsetenv("SKIP_FAILED_TXS")
+		assert.False(t, GetSkipFailedTxs())
+	})
+}
+
 func TestGetKafakTopic(t *testing.T) {
 	t.Run("get_kafka_topic_with_env_variable", func(t *testing.T) {
 		os.Setenv("KAFKA_TOPIC", "custom-topic")
@@ -152,3 +507,147 @@ func TestGetKafakBrokers(t *testing.T) {
 		assert.Equal(t, []string{" broker1:9092 ", " broker2:9092 "}, brokers)
 	})
 }
+
+func TestGetKafkaTopicSettings(t *testing.T) {
+	t.Run("get_kafka_topic_settings_with_env_variables", func(t *testing.T) {
+		os.Setenv("KAFKA_PARTITIONS", "12")
+		os.Setenv("KAFKA_REPLICATION_FACTOR", "3")
+		os.Setenv("KAFKA_RETENTION", "168h")
+		os.Setenv("KAFKA_CLEANUP_POLICY", "delete, compact")
+		defer os.Unsetenv("KAFKA_PARTITIONS")
+		defer os.Unsetenv("KAFKA_REPLICATION_FACTOR")
+		defer os.Unsetenv("KAFKA_RETENTION")
+		defer os.Unsetenv("KAFKA_CLEANUP_POLICY")
+		assert.Equal(t, 12, GetKafkaPartitions())
+		assert.Equal(t, 3, GetKafkaReplicationFactor())
+		assert.Equal(t, 168*time.Hour, GetKafkaRetention())
+		assert.Equal(t, CleanupPolicyCompactDelete, GetKafkaCleanupPolicy())
+	})
+	t.Run("get_kafka_topic_settings_without_env_variables", func(t *testing.T) {
+		assert.Equal(t, 0, GetKafkaPartitions())
+		assert.Equal(t, 0, GetKafkaReplicationFactor())
+		assert.Equal(t, time.Duration(0), GetKafkaRetention())
+		assert.Equal(t, "", GetKafkaCleanupPolicy())
+	})
+	t.Run("get_kafka_topic_settings_with_invalid_env_variables", func(t *testing.T) {
+		os.Setenv("KAFKA_PARTITIONS", "0")
+		os.Setenv("KAFKA_RETENTION", "a week")
+		os.Setenv("KAFKA_CLEANUP_POLICY", "archive")
+		defer os.Unsetenv("KAFKA_PARTITIONS")
+		defer os.Unsetenv("KAFKA_RETENTION")
+		defer os.Unsetenv("KAFKA_CLEANUP_POLICY")
+		assert.Equal(t, 0, GetKafkaPartitions())
+		assert.Equal(t, time.Duration(0), GetKafkaRetention())
+		assert.Equal(t, "", GetKafkaCleanupPolicy())
+	})
+}
+
+func TestGetKafkaSecurity(t *testing.T) {
+	t.Run("get_kafka_tls_with_ca_file", func(t *testing.T) {
+		os.Setenv("KAFKA_TLS_CA_FILE", "/etc/kafka/ca.pem")
+		defer os.Unsetenv("KAFKA_TLS_CA_FILE")
+		assert.Equal(t, KafkaTLSConfig{Enabled: true, CAFile: "/etc/kafka/ca.pem"}, GetKafkaTLS())
+	})
+	t.Run("get_kafka_tls_with_system_roots", func(t *testing.T) {
+		os.Setenv("KAFKA_TLS", "true")
+		defer os.Unsetenv("KAFKA_TLS")
+		assert.Equal(t, KafkaTLSConfig{Enabled: true}, GetKafkaTLS())
+	})
+	t.Run("get_kafka_tls_without_env_variables", func(t *testing.T) {
+		assert.False(t, GetKafkaTLS().Enabled)
+	})
+	t.Run("get_kafka_sasl_with_env_variables", func(t *testing.T) {
+		os.Setenv("KAFKA_SASL_MECHANISM", "SCRAM-SHA-512")
+		os.Setenv("KAFKA_SASL_USERNAME", "de-crypto")
+		os.Setenv("KAFKA_SASL_PASSWORD", "secret")
+		defer os.Unsetenv("KAFKA_SASL_MECHANISM")
+		defer os.Unsetenv("KAFKA_SASL_USERNAME")
+		defer os.Unsetenv("KAFKA_SASL_PASSWORD")
+		assert.Equal(t, KafkaSASLConfig{Mechanism: SASLScramSHA512, Username: "de-crypto", Password: "secret"}, GetKafkaSASL())
+	})
+	t.Run("get_kafka_sasl_with_invalid_mechanism", func(t *testing.T) {
+		os.Setenv("KAFKA_SASL_MECHANISM", "gssapi")
+		defer os.Unsetenv("KAFKA_SASL_MECHANISM")
+		assert.Equal(t, "", GetKafkaSASL().Mechanism)
+	})
+}
+
+func TestGetKafkaProducer(t *testing.T) {
+	t.Run("get_kafka_producer_with_env_variables", func(t *testing.T) {
+		os.Setenv("KAFKA_ASYNC", "true")
+		os.Setenv("KAFKA_COMPRESSION", "ZSTD")
+		defer os.Unsetenv("KAFKA_ASYNC")
+		defer os.Unsetenv("KAFKA_COMPRESSION")
+		assert.True(t, GetKafkaAsync())
+		assert.Equal(t, CompressionZstd, GetKafkaCompression())
+	})
+	t.Run("get_kafka_producer_without_env_variables", func(t *testing.T) {
+		assert.False(t, GetKafkaAsync())
+		assert.Equal(t, DefaultKafkaCompression, GetKafkaCompression())
+	})
+	t.Run("get_kafka_producer_with_invalid_env_variables", func(t *testing.T) {
+		os.Setenv("KAFKA_ASYNC", "maybe")
+		os.Setenv("KAFKA_COMPRESSION", "brotli")
+		defer os.Unsetenv("KAFKA_ASYNC")
+		defer os.Unsetenv("KAFKA_COMPRESSION")
+		assert.False(t, GetKafkaAsync())
+		assert.Equal(t, DefaultKafkaCompression, GetKafkaCompression())
+	})
+}
+
+func TestGetEncoding(t *testing.T) {
+	t.Run("get_encoding_with_env_variables", func(t *testing.T) {
+		os.Setenv("KAFKA_ENCODING", "Avro")
+		os.Setenv("WEBHOOK_ENCODING", "protobuf")
+		defer os.Unsetenv("KAFKA_ENCODING")
+		defer os.Unsetenv("WEBHOOK_ENCODING")
+		assert.Equal(t, EncodingAvro, GetKafkaEncoding())
+		assert.Equal(t, EncodingProtobuf, GetWebhookEncoding())
+	})
+	t.Run("get_encoding_without_env_variables", func(t *testing.T) {
+		assert.Equal(t, DefaultEncoding, GetKafkaEncoding())
+		assert.Equal(t, DefaultEncoding, GetWebhookEncoding())
+	})
+	t.Run("get_encoding_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("KAFKA_ENCODING", "xml")
+		defer os.Unsetenv("KAFKA_ENCODING")
+		assert.Equal(t, DefaultEncoding, GetKafkaEncoding())
+	})
+}
+
+func TestGetSchemaRegistry(t *testing.T) {
+	t.Run("get_schema_registry_with_env_variables", func(t *testing.T) {
+		os.Setenv("SCHEMA_REGISTRY_URL", "http://localhost:8081")
+		os.Setenv("SCHEMA_REGISTRY_USERNAME", "key")
+		os.Setenv("SCHEMA_REGISTRY_PASSWORD", "secret")
+		os.Setenv("SCHEMA_REGISTRY_AUTO_REGISTER", "false")
+		defer os.Unsetenv("SCHEMA_REGISTRY_URL")
+		defer os.Unsetenv("SCHEMA_REGISTRY_USERNAME")
+		defer os.Unsetenv("SCHEMA_REGISTRY_PASSWORD")
+		defer os.Unsetenv("SCHEMA_REGISTRY_AUTO_REGISTER")
+		assert.Equal(t, SchemaRegistryConfig{URL: "http://localhost:8081", Username: "key", Password: "secret"}, GetSchemaRegistry())
+	})
+	t.Run("get_schema_registry_without_env_variables", func(t *testing.T) {
+		assert.Equal(t, SchemaRegistryConfig{AutoRegister: true}, GetSchemaRegistry())
+	})
+}
+
+func TestGetCloudEvents(t *testing.T) {
+	t.Run("get_cloud_events_with_env_variables", func(t *testing.T) {
+		os.Setenv("CLOUDEVENTS", "Binary")
+		os.Setenv("CLOUDEVENTS_SOURCE", "//mainnet.example.com/eip155/1")
+		defer os.Unsetenv("CLOUDEVENTS")
+		defer os.Unsetenv("CLOUDEVENTS_SOURCE")
+		assert.Equal(t, CloudEventsBinary, GetCloudEvents())
+		assert.Equal(t, "//mainnet.example.com/eip155/1", GetCloudEventsSource())
+	})
+	t.Run("get_cloud_events_without_env_variables", func(t *testing.T) {
+		assert.Equal(t, "", GetCloudEvents())
+		assert.Equal(t, "", GetCloudEventsSource())
+	})
+	t.Run("get_cloud_events_with_invalid_env_variable", func(t *testing.T) {
+		os.Setenv("CLOUDEVENTS", "batch")
+		defer os.Unsetenv("CLOUDEVENTS")
+		assert.Equal(t, "", GetCloudEvents())
+	})
+}
@@ -0,0 +1,437 @@
+package dlq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segmentExt = ".log"
+	cursorFile = "cursor"
+	// the replay saves the cursor after this many records
+	replayBatch = 256
+)
+
+// Record is a message that failed to publish, with the reason
+type Record struct {
+	ID       uint64            `json:"id"`
+	FailedAt time.Time         `json:"failed_at"`
+	Error    string            `json:"error"`
+	Key      []byte            `json:"key,omitempty"`
+	Message  []byte            `json:"message"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+type cursor struct {
+	Delivered uint64 `json:"delivered"`
+}
+
+// segment is a file of records, named by the id of its first record
+type segment struct {
+	first uint64
+	path  string
+}
+
+// Queue is an append only dead letter queue on disk. The records go to segment files and a
+// cursor file keeps the last redelivered id, the segments behind the cursor are deleted.
+// The records are redelivered in order, so the cursor is enough to know what is pending.
+type Queue struct {
+	dir            string
+	maxSegmentSize int64
+
+	mu        sync.Mutex
+	segments  []segment
+	nextID    uint64
+	delivered uint64
+	f         *os.File
+	size      int64
+
+	// only one replay at a time, otherwise the same record goes out twice
+	replayMu sync.Mutex
+}
+
+func Open(dir string, maxSegmentSize int64) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &Queue{dir: dir, maxSegmentSize: maxSegmentSize}
+
+	data, err := os.ReadFile(filepath.Join(dir, cursorFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var c cursor
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("dlq: invalid cursor: %w", err)
+		}
+		q.delivered = c.Delivered
+	}
+
+	if err := q.loadSegments(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *Queue) loadSegments() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		q.segments = append(q.segments, segment{first: first, path: filepath.Join(q.dir, name)})
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i].first < q.segments[j].first })
+
+	q.nextID = q.delivered + 1
+	if len(q.segments) == 0 {
+		return nil
+	}
+
+	// a crash while appending can leave half a line at the end, we cut it so the
+	// next record starts on a new line
+	last := q.segments[len(q.segments)-1]
+	records, validSize, err := readSegment(last.path, 0)
+	if err != nil {
+		return err
+	}
+	if err := os.Truncate(last.path, validSize); err != nil {
+		return err
+	}
+	if n := len(records); n > 0 && records[n-1].ID >= q.nextID {
+		q.nextID = records[n-1].ID + 1
+	} else if last.first > q.nextID {
+		q.nextID = last.first
+	}
+	return nil
+}
+
+// readSegment returns the records of the file from offset and where the valid part ends
+func readSegment(path string, offset int64) ([]Record, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var records []Record
+	size := offset
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		var r Record
+		if err := json.Unmarshal(data[:i], &r); err != nil {
+			break
+		}
+		records = append(records, r)
+		size += int64(i + 1)
+		data = data[i+1:]
+	}
+	return records, size, nil
+}
+
+// Append stores the record, the id and the time are set here
+func (q *Queue) Append(r Record) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.f == nil || q.size >= q.maxSegmentSize {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+
+	r.ID, r.FailedAt = q.nextID, time.Now().UTC()
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if _, err := q.f.Write(line); err != nil {
+		return err
+	}
+	// the messages here are the ones we couldn't deliver, we don't want to lose them on a crash
+	if err := q.f.Sync(); err != nil {
+		return err
+	}
+	q.size += int64(len(line))
+	q.nextID++
+	return nil
+}
+
+// rotate opens the segment for the next record, it reuses the last one while it has room
+func (q *Queue) rotate() error {
+	if q.f != nil {
+		if err := q.f.Close(); err != nil {
+			return err
+		}
+		q.f = nil
+	}
+
+	if n := len(q.segments); n > 0 && q.size == 0 {
+		last := q.segments[n-1]
+		if info, err := os.Stat(last.path); err == nil && info.Size() < q.maxSegmentSize {
+			f, err := os.OpenFile(last.path, os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			q.f, q.size = f, info.Size()
+			return nil
+		}
+	}
+
+	s := segment{first: q.nextID, path: filepath.Join(q.dir, fmt.Sprintf("%020d%s", q.nextID, segmentExt))}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	q.segments = append(q.segments, s)
+	q.f, q.size = f, 0
+	return nil
+}
+
+// Len returns the number of records waiting for redelivery
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int(q.nextID - 1 - q.delivered)
+}
+
+// Pending returns the records waiting for redelivery, oldest first, up to limit (0 is all)
+func (q *Queue) Pending(limit int) ([]Record, error) {
+	q.mu.Lock()
+	segments := append([]segment(nil), q.segments...)
+	delivered := q.delivered
+	q.mu.Unlock()
+
+	var pending []Record
+	for _, s := range segments {
+		records, _, err := readSegment(s.path, 0)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// purged while we were reading
+				continue
+			}
+			return nil, err
+		}
+		for _, r := range records {
+			if r.ID <= delivered {
+				continue
+			}
+			pending = append(pending, r)
+			if limit > 0 && len(pending) >= limit {
+				return pending, nil
+			}
+		}
+	}
+	return pending, nil
+}
+
+// Ack marks the records up to id as delivered and deletes the segments behind it
+func (q *Queue) Ack(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if id <= q.delivered {
+		return nil
+	}
+	if err := q.saveCursor(id); err != nil {
+		return err
+	}
+	q.delivered = id
+
+	for len(q.segments) > 0 {
+		s := q.segments[0]
+		// the segment ends where the next one starts, the last one ends at the next id
+		end := q.nextID
+		if len(q.segments) > 1 {
+			end = q.segments[1].first
+		}
+		if end > q.delivered+1 {
+			break
+		}
+		if len(q.segments) == 1 && q.f != nil {
+			if err := q.f.Close(); err != nil {
+				return err
+			}
+			q.f, q.size = nil, 0
+		}
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		q.segments = q.segments[1:]
+	}
+	return nil
+}
+
+// same as the checkpoint, write the tmp and rename so we never have half a cursor
+func (q *Queue) saveCursor(delivered uint64) error {
+	data, err := json.Marshal(&cursor{Delivered: delivered})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(q.dir, cursorFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Replay publishes the pending records in order and stops on the first error,
+// it returns how many were delivered. Every segment is read once, we keep where we are
+// in it to get the records appended while we replay, and the cursor is saved per batch.
+func (q *Queue) Replay(publish func(Record) error) (int, error) {
+	q.replayMu.Lock()
+	defer q.replayMu.Unlock()
+
+	delivered := 0
+	var first uint64
+	var offset int64
+	for {
+		q.mu.Lock()
+		segments := append([]segment(nil), q.segments...)
+		acked := q.delivered
+		q.mu.Unlock()
+
+		// the segment we are reading, or the next one when it was deleted by the ack
+		i := sort.Search(len(segments), func(i int) bool { return segments[i].first >= first })
+		if i == len(segments) {
+			return delivered, nil
+		}
+		if segments[i].first != first {
+			first, offset = segments[i].first, 0
+		}
+
+		records, end, err := readSegment(segments[i].path, offset)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				first, offset = first+1, 0
+				continue
+			}
+			return delivered, err
+		}
+		if len(records) == 0 {
+			if i == len(segments)-1 {
+				return delivered, nil
+			}
+			first, offset = segments[i+1].first, 0
+			continue
+		}
+		offset = end
+
+		var last uint64
+		batch := 0
+		for _, r := range records {
+			if r.ID <= acked {
+				continue
+			}
+			if err := publish(r); err != nil {
+				if last > 0 {
+					if ackErr := q.Ack(last); ackErr != nil {
+						return delivered, ackErr
+					}
+				}
+				return delivered, err
+			}
+			last = r.ID
+			delivered++
+			if batch++; batch == replayBatch {
+				if err := q.Ack(last); err != nil {
+					return delivered, err
+				}
+				batch = 0
+			}
+		}
+		if last > 0 {
+			if err := q.Ack(last); err != nil {
+				return delivered, err
+			}
+		}
+	}
+}
+
+// Purge drops all the pending records, it returns how many were dropped
+func (q *Queue) Purge() (int, error) {
+	q.replayMu.Lock()
+	defer q.replayMu.Unlock()
+
+	n := q.Len()
+	if n == 0 {
+		return 0, nil
+	}
+	q.mu.Lock()
+	last := q.nextID - 1
+	q.mu.Unlock()
+	return n, q.Ack(last)
+}
+
+// Run redelivers the pending records until the context is done. After a failure it waits
+// doubling the delay up to maxDelay, so we don't hammer a broker that is down.
+func (q *Queue) Run(ctx context.Context, publish func(Record) error, baseDelay, maxDelay time.Duration) {
+	delay := baseDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		n, err := q.Replay(publish)
+		if n > 0 {
+			log.Printf("dlq: redelivered %d messages, %d pending", n, q.Len())
+		}
+		if err != nil {
+			delay *= 2
+			if delay > maxDelay {
+				delay = maxDelay
+			}
+			log.Printf("dlq: redelivery failed, retrying in %s: %v", delay, err)
+			continue
+		}
+		delay = baseDelay
+	}
+}
+
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.f == nil {
+		return nil
+	}
+	err := q.f.Close()
+	q.f = nil
+	return err
+}
@@ -0,0 +1,218 @@
+package dlq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errBroker = errors.New("broker down")
+
+func TestQueue(t *testing.T) {
+	t.Run("queue_appends_and_lists_pending", func(t *testing.T) {
+		q, err := Open(t.TempDir(), 1<<20)
+		assert.NoError(t, err)
+		defer q.Close()
+
+		assert.NoError(t, q.Append(Record{Message: []byte(`{"a":1}`), Error: errBroker.Error()}))
+		assert.NoError(t, q.Append(Record{Key: []byte("user1"), Message: []byte(`{"a":2}`), Headers: map[string]string{"event-type": "native"}}))
+		assert.Equal(t, 2, q.Len())
+
+		records, err := q.Pending(0)
+		assert.NoError(t, err)
+		assert.Len(t, records, 2)
+		assert.Equal(t, uint64(1), records[0].ID)
+		assert.Equal(t, `{"a":1}`, string(records[0].Message))
+		assert.Equal(t, "broker down", records[0].Error)
+		assert.False(t, records[0].FailedAt.IsZero())
+		assert.Equal(t, "user1", string(records[1].Key))
+		assert.Equal(t, map[string]string{"event-type": "native"}, records[1].Headers)
+
+		records, err = q.Pending(1)
+		assert.NoError(t, err)
+		assert.Len(t, records, 1)
+	})
+
+	t.Run("queue_survives_a_restart", func(t *testing.T) {
+		dir := t.TempDir()
+		q, err := Open(dir, 1<<20)
+		assert.NoError(t, err)
+		assert.NoError(t, q.Append(Record{Message: []byte("m1"), Error: errBroker.Error()}))
+		assert.NoError(t, q.Append(Record{Message: []byte("m2"), Error: errBroker.Error()}))
+		assert.NoError(t, q.Ack(1))
+		assert.NoError(t, q.Close())
+
+		q, err = Open(dir, 1<<20)
+		assert.NoError(t, err)
+		defer q.Close()
+		assert.Equal(t, 1, q.Len())
+
+		assert.NoError(t, q.Append(Record{Message: []byte("m3"), Error: errBroker.Error()}))
+		records, err := q.Pending(0)
+		assert.NoError(t, err)
+		assert.Len(t, records, 2)
+		assert.Equal(t, uint64(2), records[0].ID)
+		assert.Equal(t, uint64(3), records[1].ID)
+	})
+
+	t.Run("queue_cuts_a_half_written_record", func(t *testing.T) {
+		dir := t.TempDir()
+		q, err := Open(dir, 1<<20)
+		assert.NoError(t, err)
+		assert.NoError(t, q.Append(Record{Message: []byte("m1"), Error: errBroker.Error()}))
+		assert.NoError(t, q.Close())
+
+		f, err := os.OpenFile(filepath.Join(dir, "00000000000000000001.log"), os.O_WRONLY|os.O_APPEND, 0644)
+		assert.NoError(t, err)
+		_, err = f.WriteString(`{"id":2,"mess`)
+		assert.NoError(t, err)
+		f.Close()
+
+		q, err = Open(dir, 1<<20)
+		assert.NoError(t, err)
+		defer q.Close()
+		assert.NoError(t, q.Append(Record{Message: []byte("m2"), Error: errBroker.Error()}))
+
+		records, err := q.Pending(0)
+		assert.NoError(t, err)
+		assert.Len(t, records, 2)
+		assert.Equal(t, "m2", string(records[1].Message))
+	})
+
+	t.Run("queue_rotates_and_deletes_delivered_segments", func(t *testing.T) {
+		dir := t.TempDir()
+		q, err := Open(dir, 10)
+		assert.NoError(t, err)
+		defer q.Close()
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, q.Append(Record{Message: []byte("message"), Error: errBroker.Error()}))
+		}
+		segments, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+		assert.Len(t, segments, 3)
+
+		assert.NoError(t, q.Ack(2))
+		segments, _ = filepath.Glob(filepath.Join(dir, "*.log"))
+		assert.Len(t, segments, 1)
+		assert.Equal(t, 1, q.Len())
+	})
+
+	t.Run("queue_replay_stops_on_error", func(t *testing.T) {
+		q, err := Open(t.TempDir(), 1<<20)
+		assert.NoError(t, err)
+		defer q.Close()
+		for _, m := range []string{"m1", "m2", "m3"} {
+			assert.NoError(t, q.Append(Record{Message: []byte(m), Error: errBroker.Error()}))
+		}
+
+		var sent []string
+		n, err := q.Replay(func(r Record) error {
+			if string(r.Message) == "m2" {
+				return errBroker
+			}
+			sent = append(sent, string(r.Message))
+			return nil
+		})
+		assert.ErrorIs(t, err, errBroker)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, 2, q.Len())
+
+		n, err = q.Replay(func(r Record) error {
+			sent = append(sent, string(r.Message))
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, []string{"m1", "m2", "m3"}, sent)
+		assert.Equal(t, 0, q.Len())
+	})
+
+	t.Run("queue_replay_across_segments_and_appends", func(t *testing.T) {
+		dir := t.TempDir()
+		q, err := Open(dir, 1<<10)
+		assert.NoError(t, err)
+		for i := 0; i < 600; i++ {
+			assert.NoError(t, q.Append(Record{Message: []byte(fmt.Sprint(i)), Error: errBroker.Error()}))
+		}
+
+		var sent []uint64
+		n, err := q.Replay(func(r Record) error {
+			// a failed publish while we replay goes to the end of the queue
+			if r.ID == 1 {
+				assert.NoError(t, q.Append(Record{Message: []byte("late"), Error: errBroker.Error()}))
+			}
+			sent = append(sent, r.ID)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 601, n)
+		for i, id := range sent {
+			assert.Equal(t, uint64(i+1), id)
+		}
+		assert.Equal(t, 0, q.Len())
+		assert.NoError(t, q.Close())
+
+		q, err = Open(dir, 1<<10)
+		assert.NoError(t, err)
+		defer q.Close()
+		assert.Equal(t, 0, q.Len())
+	})
+
+	t.Run("queue_purge", func(t *testing.T) {
+		dir := t.TempDir()
+		q, err := Open(dir, 1<<20)
+		assert.NoError(t, err)
+		assert.NoError(t, q.Append(Record{Message: []byte("m1"), Error: errBroker.Error()}))
+		assert.NoError(t, q.Append(Record{Message: []byte("m2"), Error: errBroker.Error()}))
+
+		n, err := q.Purge()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, 0, q.Len())
+		assert.NoError(t, q.Close())
+
+		// the ids keep going after a purge
+		q, err = Open(dir, 1<<20)
+		assert.NoError(t, err)
+		defer q.Close()
+		assert.Equal(t, 0, q.Len())
+		assert.NoError(t, q.Append(Record{Message: []byte("m3"), Error: errBroker.Error()}))
+		records, err := q.Pending(0)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(3), records[0].ID)
+	})
+
+	t.Run("queue_run_redelivers_with_backoff", func(t *testing.T) {
+		q, err := Open(t.TempDir(), 1<<20)
+		assert.NoError(t, err)
+		defer q.Close()
+		assert.NoError(t, q.Append(Record{Message: []byte("m1"), Error: errBroker.Error()}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		attempts := make(chan struct{}, 10)
+		delivered := make(chan struct{})
+		go q.Run(ctx, func(r Record) error {
+			attempts <- struct{}{}
+			if len(attempts) < 3 {
+				return errBroker
+			}
+			close(delivered)
+			return nil
+		}, 5*time.Millisecond, 20*time.Millisecond)
+
+		select {
+		case <-delivered:
+		case <-ctx.Done():
+			t.Fatal("message not redelivered")
+		}
+		assert.Eventually(t, func() bool { return q.Len() == 0 }, time.Second, 5*time.Millisecond)
+	})
+}
@@ -0,0 +1,154 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type rpcReq struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+	ID      int    `json:"id"`
+}
+
+// GetBlocksByNumber gets all the blocks in one http request, the blocks and the errors are in
+// the order of the numbers and a failed element doesn't fail the others. The error returned
+// is for the whole request.
+func (e *Ethereum) GetBlocksByNumber(ctx context.Context, blockNumbers []uint64) ([]*Block, []error, error) {
+	reqs := make([]rpcReq, len(blockNumbers))
+	for i, n := range blockNumbers {
+		reqs[i] = rpcReq{Method: "eth_getBlockByNumber", Params: []any{fmt.Sprintf("0x%x", n), true}}
+	}
+
+	results, errs, err := e.callBatch(ctx, reqs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blocks := make([]*Block, len(blockNumbers))
+	for i, result := range results {
+		if errs[i] != nil {
+			continue
+		}
+		if isNull(result) {
+			errs[i] = fmt.Errorf("%w: 0x%x", ErrBlockNotFound, blockNumbers[i])
+			continue
+		}
+		var block Block
+		if err := json.Unmarshal(result, &block); err != nil {
+			errs[i] = fmt.Errorf("%w: unexpected result type for eth_getBlockByNumber: %v", ErrMalformedResponse, err)
+			continue
+		}
+		blocks[i] = &block
+	}
+
+	return blocks, errs, nil
+}
+
+// GetTransactionReceipts is the same for the receipts
+func (e *Ethereum) GetTransactionReceipts(ctx context.Context, txHashes []string) ([]*Receipt, []error, error) {
+	reqs := make([]rpcReq, len(txHashes))
+	for i, h := range txHashes {
+		reqs[i] = rpcReq{Method: "eth_getTransactionReceipt", Params: []any{h}}
+	}
+
+	results, errs, err := e.callBatch(ctx, reqs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	receipts := make([]*Receipt, len(txHashes))
+	for i, result := range results {
+		if errs[i] != nil {
+			continue
+		}
+		if isNull(result) {
+			errs[i] = fmt.Errorf("%w: receipt of %s", ErrBlockNotFound, txHashes[i])
+			continue
+		}
+		var receipt Receipt
+		if err := json.Unmarshal(result, &receipt); err != nil {
+			errs[i] = fmt.Errorf("%w: unexpected result type for eth_getTransactionReceipt: %v", ErrMalformedResponse, err)
+			continue
+		}
+		receipts[i] = &receipt
+	}
+
+	return receipts, errs, nil
+}
+
+// callBatch sends the requests as a json-rpc batch. The responses can come in any order, so we
+// correlate them by id and return the results in the order of the requests.
+func (e *Ethereum) callBatch(ctx context.Context, reqs []rpcReq) ([]json.RawMessage, []error, error) {
+	for i := range reqs {
+		reqs[i].JSONRPC = "2.0"
+		reqs[i].ID = i + 1
+	}
+	payload, err := json.Marshal(reqs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cliUrl, bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	// the body of a 429 says nothing useful, the header says how long to wait
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, nil, newRateLimitError(resp.Header)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var batch []rpcResp
+	if err := json.Unmarshal(body, &batch); err != nil {
+		if statusErr := statusError(resp.StatusCode); statusErr != nil {
+			return nil, nil, statusErr
+		}
+		// providers without batch support (or over the batch limit) answer with a single error
+		var single rpcResp
+		if json.Unmarshal(body, &single) == nil && single.Error != nil {
+			return nil, nil, single.Error
+		}
+		return nil, nil, fmt.Errorf("%w: %v", ErrMalformedResponse, err)
+	}
+
+	results := make([]json.RawMessage, len(reqs))
+	errs := make([]error, len(reqs))
+	seen := make([]bool, len(reqs))
+	for _, r := range batch {
+		i := r.ID - 1
+		if i < 0 || i >= len(reqs) || seen[i] {
+			continue
+		}
+		seen[i] = true
+		if r.Error != nil {
+			errs[i] = r.Error
+			continue
+		}
+		results[i] = r.Result
+	}
+	for i := range reqs {
+		if !seen[i] {
+			errs[i] = fmt.Errorf("%w: no response for %s id %d", ErrMalformedResponse, reqs[i].Method, reqs[i].ID)
+		}
+	}
+
+	return results, errs, nil
+}
@@ -0,0 +1,101 @@
+package jsonrpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEthereum_GetBlocksByNumber(t *testing.T) {
+	t.Run("get_blocks_by_number_correlates_by_id", func(t *testing.T) {
+		client := &recordHTTPClient{response: `[
+			{"jsonrpc":"2.0","result":{"number":"0x65","hash":"0xb"},"id":2},
+			{"jsonrpc":"2.0","result":{"number":"0x64","hash":"0xa"},"id":1}
+		]`}
+		ethereum := NewEthereum("https://test-rpc.com", client)
+
+		blocks, errs, err := ethereum.GetBlocksByNumber(context.Background(), []uint64{100, 101})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []error{nil, nil}, errs)
+		assert.Equal(t, "0xa", blocks[0].Hash)
+		assert.Equal(t, "0xb", blocks[1].Hash)
+		assert.Contains(t, client.body, `{"jsonrpc":"2.0","method":"eth_getBlockByNumber","params":["0x64",true],"id":1}`)
+		assert.Contains(t, client.body, `{"jsonrpc":"2.0","method":"eth_getBlockByNumber","params":["0x65",true],"id":2}`)
+	})
+
+	t.Run("get_blocks_by_number_partial_errors", func(t *testing.T) {
+		client := &recordHTTPClient{response: `[
+			{"jsonrpc":"2.0","result":{"number":"0x64","hash":"0xa"},"id":1},
+			{"jsonrpc":"2.0","result":null,"id":2},
+			{"jsonrpc":"2.0","error":{"code":-32005,"message":"limit exceeded"},"id":3},
+			{"jsonrpc":"2.0","result":"0x1","id":4}
+		]`}
+		ethereum := NewEthereum("https://test-rpc.com", client)
+
+		blocks, errs, err := ethereum.GetBlocksByNumber(context.Background(), []uint64{100, 101, 102, 103, 104})
+
+		assert.NoError(t, err)
+		assert.NotNil(t, blocks[0])
+		assert.NoError(t, errs[0])
+		assert.ErrorIs(t, errs[1], ErrBlockNotFound)
+		assert.ErrorIs(t, errs[2], ErrRateLimited)
+		assert.ErrorIs(t, errs[3], ErrMalformedResponse)
+		// no response for the last one
+		assert.ErrorIs(t, errs[4], ErrMalformedResponse)
+		assert.Nil(t, blocks[4])
+	})
+
+	t.Run("get_blocks_by_number_batch_not_supported", func(t *testing.T) {
+		client := &recordHTTPClient{response: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"batch requests are not supported"},"id":null}`}
+		ethereum := NewEthereum("https://test-rpc.com", client)
+
+		_, _, err := ethereum.GetBlocksByNumber(context.Background(), []uint64{100, 101})
+
+		var rpcErr *Error
+		assert.ErrorAs(t, err, &rpcErr)
+		assert.Equal(t, -32600, rpcErr.Code)
+	})
+
+	t.Run("get_blocks_by_number_http_status", func(t *testing.T) {
+		client := &mockHTTPClient{response: &http.Response{
+			StatusCode: 429,
+			Body:       io.NopCloser(strings.NewReader("Too Many Requests")),
+		}}
+		ethereum := NewEthereum("https://test-rpc.com", client)
+
+		_, _, err := ethereum.GetBlocksByNumber(context.Background(), []uint64{100})
+
+		assert.ErrorIs(t, err, ErrRateLimited)
+	})
+
+	t.Run("get_blocks_by_number_http_error", func(t *testing.T) {
+		ethereum := NewEthereum("https://test-rpc.com", &mockHTTPClient{err: assert.AnError})
+
+		_, _, err := ethereum.GetBlocksByNumber(context.Background(), []uint64{100})
+
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
+
+func TestEthereum_GetTransactionReceipts(t *testing.T) {
+	t.Run("get_transaction_receipts_success", func(t *testing.T) {
+		client := &recordHTTPClient{response: `[
+			{"jsonrpc":"2.0","result":{"transactionHash":"0xtx1","status":"0x1"},"id":1},
+			{"jsonrpc":"2.0","result":null,"id":2}
+		]`}
+		ethereum := NewEthereum("https://test-rpc.com", client)
+
+		receipts, errs, err := ethereum.GetTransactionReceipts(context.Background(), []string{"0xtx1", "0xtx2"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "0xtx1", receipts[0].TransactionHash)
+		assert.NoError(t, errs[0])
+		assert.ErrorIs(t, errs[1], ErrBlockNotFound)
+		assert.Contains(t, client.body, `"method":"eth_getTransactionReceipt","params":["0xtx2"],"id":2`)
+	})
+}
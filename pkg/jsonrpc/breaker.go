@@ -0,0 +1,266 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// CircuitBreaker stops sending requests after threshold consecutive failures. While open
+// every call fails with ErrCircuitOpen, after openTimeout one probe request goes through
+// (half-open) and closes the circuit when it succeeds or opens it again when it fails.
+type CircuitBreaker struct {
+	client      JsonRpcClient
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	// closed and replaced on every state change, so the waiters wake up
+	changed chan struct{}
+}
+
+var _ JsonRpcClient = &CircuitBreaker{}
+
+func NewCircuitBreaker(client JsonRpcClient, threshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		client:      client,
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		changed:     make(chan struct{}),
+	}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// WaitReady blocks while the circuit is open, so the callers can pause instead of spinning on errors
+func (b *CircuitBreaker) WaitReady(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		state, changed := b.state, b.changed
+		wait := time.Duration(-1)
+		switch {
+		case state == BreakerOpen:
+			wait = time.Until(b.openedAt.Add(b.openTimeout))
+		case state == BreakerHalfOpen && b.probing:
+			// someone is probing, we wait for the result
+			wait = b.openTimeout
+		}
+		b.mu.Unlock()
+
+		if wait < 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-time.After(wait):
+			if state == BreakerOpen {
+				return nil
+			}
+		}
+	}
+}
+
+func (b *CircuitBreaker) GetCurrentBlockNumber(ctx context.Context) (uint64, error) {
+	var n uint64
+	err := b.do(func() error {
+		var err error
+		n, err = b.client.GetCurrentBlockNumber(ctx)
+		return err
+	})
+	return n, err
+}
+
+func (b *CircuitBreaker) GetBlockByNumber(ctx context.Context, n uint64) (*Block, error) {
+	var block *Block
+	err := b.do(func() error {
+		var err error
+		block, err = b.client.GetBlockByNumber(ctx, n)
+		return err
+	})
+	return block, err
+}
+
+func (b *CircuitBreaker) GetBlocksByNumber(ctx context.Context, ns []uint64) ([]*Block, []error, error) {
+	var blocks []*Block
+	var errs []error
+	err := b.do(func() error {
+		var err error
+		blocks, errs, err = b.client.GetBlocksByNumber(ctx, ns)
+		return err
+	})
+	return blocks, errs, err
+}
+
+func (b *CircuitBreaker) GetBlockNumberByTag(ctx context.Context, tag string) (uint64, error) {
+	var n uint64
+	err := b.do(func() error {
+		var err error
+		n, err = b.client.GetBlockNumberByTag(ctx, tag)
+		return err
+	})
+	return n, err
+}
+
+func (b *CircuitBreaker) GetLogs(ctx context.Context, filter LogFilter) ([]Log, error) {
+	var logs []Log
+	err := b.do(func() error {
+		var err error
+		logs, err = b.client.GetLogs(ctx, filter)
+		return err
+	})
+	return logs, err
+}
+
+func (b *CircuitBreaker) GetInternalTransfers(ctx context.Context, n uint64, mode string) ([]InternalTransfer, error) {
+	var transfers []InternalTransfer
+	err := b.do(func() error {
+		var err error
+		transfers, err = b.client.GetInternalTransfers(ctx, n, mode)
+		return err
+	})
+	return transfers, err
+}
+
+func (b *CircuitBreaker) GetBlockReceipts(ctx context.Context, blockHash string) ([]Receipt, error) {
+	var receipts []Receipt
+	err := b.do(func() error {
+		var err error
+		receipts, err = b.client.GetBlockReceipts(ctx, blockHash)
+		return err
+	})
+	return receipts, err
+}
+
+func (b *CircuitBreaker) GetTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	var receipt *Receipt
+	err := b.do(func() error {
+		var err error
+		receipt, err = b.client.GetTransactionReceipt(ctx, txHash)
+		return err
+	})
+	return receipt, err
+}
+
+func (b *CircuitBreaker) GetTransactionReceipts(ctx context.Context, txHashes []string) ([]*Receipt, []error, error) {
+	var receipts []*Receipt
+	var errs []error
+	err := b.do(func() error {
+		var err error
+		receipts, errs, err = b.client.GetTransactionReceipts(ctx, txHashes)
+		return err
+	})
+	return receipts, errs, err
+}
+
+func (b *CircuitBreaker) do(fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.report(err)
+	return err
+}
+
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) report(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := breakerFailure(err)
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing = false
+		if failed {
+			b.open()
+		} else if err == nil || !errors.Is(err, context.Canceled) {
+			b.failures = 0
+			b.setState(BreakerClosed)
+		}
+	case BreakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	log.Printf("circuit breaker: open after %d consecutive failures, probing again in %s", b.failures, b.openTimeout)
+	b.openedAt = time.Now()
+	b.setState(BreakerOpen)
+}
+
+func (b *CircuitBreaker) setState(s BreakerState) {
+	if s == BreakerClosed && b.state != BreakerClosed {
+		log.Println("circuit breaker: closed")
+	}
+	b.state = s
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// breakerFailure says if the error means the provider is not working, an answer saying the
+// block is not there yet or an invalid request is still a working provider
+func breakerFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return errors.Is(err, ErrServer) || errors.Is(err, ErrRateLimited)
+	}
+	return !errors.Is(err, ErrBlockNotFound) && !errors.Is(err, ErrMethodNotFound) && !errors.Is(err, ErrQuorumNotReached)
+}
@@ -0,0 +1,141 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (f *fakeProvider) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *fakeProvider) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("circuit_breaker_opens_after_consecutive_failures", func(t *testing.T) {
+		p := &fakeProvider{name: "a", err: ErrServer}
+		b := NewCircuitBreaker(p, 3, time.Minute)
+
+		for i := 0; i < 3; i++ {
+			_, err := b.GetCurrentBlockNumber(ctx)
+			assert.ErrorIs(t, err, ErrServer)
+		}
+		assert.Equal(t, BreakerOpen, b.State())
+
+		// short circuited, the provider doesn't get the request
+		_, err := b.GetBlockByNumber(ctx, 100)
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		assert.Equal(t, 3, p.callCount())
+	})
+
+	t.Run("circuit_breaker_success_resets_the_failures", func(t *testing.T) {
+		p := &fakeProvider{name: "a", err: ErrServer}
+		b := NewCircuitBreaker(p, 3, time.Minute)
+
+		_, _ = b.GetCurrentBlockNumber(ctx)
+		_, _ = b.GetCurrentBlockNumber(ctx)
+		p.setErr(nil)
+		_, _ = b.GetCurrentBlockNumber(ctx)
+		p.setErr(ErrServer)
+		_, _ = b.GetCurrentBlockNumber(ctx)
+		_, _ = b.GetCurrentBlockNumber(ctx)
+
+		assert.Equal(t, BreakerClosed, b.State())
+	})
+
+	t.Run("circuit_breaker_ignores_block_not_found", func(t *testing.T) {
+		p := &fakeProvider{name: "a", err: fmt.Errorf("%w: 0x64", ErrBlockNotFound)}
+		b := NewCircuitBreaker(p, 2, time.Minute)
+
+		for i := 0; i < 5; i++ {
+			_, _ = b.GetBlockByNumber(ctx, 100)
+		}
+		assert.Equal(t, BreakerClosed, b.State())
+	})
+
+	t.Run("circuit_breaker_half_open_probe_closes", func(t *testing.T) {
+		p := &fakeProvider{name: "a", err: ErrServer, head: 10}
+		b := NewCircuitBreaker(p, 1, 20*time.Millisecond)
+
+		_, _ = b.GetCurrentBlockNumber(ctx)
+		assert.Equal(t, BreakerOpen, b.State())
+
+		p.setErr(nil)
+		assert.NoError(t, b.WaitReady(ctx))
+		head, err := b.GetCurrentBlockNumber(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(10), head)
+		assert.Equal(t, BreakerClosed, b.State())
+	})
+
+	t.Run("circuit_breaker_half_open_probe_fails", func(t *testing.T) {
+		p := &fakeProvider{name: "a", err: ErrServer}
+		b := NewCircuitBreaker(p, 1, 20*time.Millisecond)
+
+		_, _ = b.GetCurrentBlockNumber(ctx)
+		time.Sleep(30 * time.Millisecond)
+
+		_, err := b.GetCurrentBlockNumber(ctx)
+		assert.ErrorIs(t, err, ErrServer)
+		assert.Equal(t, BreakerOpen, b.State())
+		assert.Equal(t, 2, p.callCount())
+	})
+
+	t.Run("circuit_breaker_one_probe_at_a_time", func(t *testing.T) {
+		p := &fakeProvider{name: "a", err: ErrServer, delay: 50 * time.Millisecond}
+		b := NewCircuitBreaker(p, 1, 10*time.Millisecond)
+
+		_, _ = b.GetCurrentBlockNumber(ctx)
+		time.Sleep(20 * time.Millisecond)
+
+		p.setErr(nil)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = b.GetCurrentBlockNumber(ctx)
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Equal(t, BreakerHalfOpen, b.State())
+		_, err := b.GetCurrentBlockNumber(ctx)
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+
+		// the waiters wake up with the probe result
+		assert.NoError(t, b.WaitReady(ctx))
+		assert.Equal(t, BreakerClosed, b.State())
+		<-done
+	})
+
+	t.Run("circuit_breaker_wait_respects_context", func(t *testing.T) {
+		p := &fakeProvider{name: "a", err: ErrServer}
+		b := NewCircuitBreaker(p, 1, time.Minute)
+		_, _ = b.GetCurrentBlockNumber(ctx)
+
+		waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, b.WaitReady(waitCtx), context.DeadlineExceeded)
+	})
+}
+
+func TestBreakerFailure(t *testing.T) {
+	assert.False(t, breakerFailure(nil))
+	assert.False(t, breakerFailure(context.Canceled))
+	assert.False(t, breakerFailure(&Error{Code: -32602, Message: "invalid params"}))
+	assert.False(t, breakerFailure(&Error{Code: -32601, Message: "method not found"}))
+	assert.False(t, breakerFailure(fmt.Errorf("%w: 0x1", ErrBlockNotFound)))
+	assert.True(t, breakerFailure(&Error{Code: -32603, Message: "internal error"}))
+	assert.True(t, breakerFailure(context.DeadlineExceeded))
+	assert.True(t, breakerFailure(fmt.Errorf("%w: http status 502", ErrServer)))
+}
@@ -34,6 +34,13 @@ type Block struct {
 	Timestamp        string        `json:"timestamp"`
 	Transactions     []Transaction `json:"transactions"`
 	Uncles           []string      `json:"uncles"`
+
+	// not part of the block response, filled by the fetcher with eth_getLogs
+	Logs []Log `json:"-"`
+	// not part of the block response, filled by the fetcher with the trace apis
+	InternalTransfers []InternalTransfer `json:"-"`
+	// not part of the block response, filled by the fetcher, by lower case transaction hash
+	Receipts map[string]Receipt `json:"-"`
 }
 
 type Transaction struct {
@@ -49,3 +56,33 @@ type Transaction struct {
 	GasPrice         string  `json:"gasPrice"`
 	Input            string  `json:"input"`
 }
+
+type Log struct {
+	Address          string   `json:"address"`
+	Topics           []string `json:"topics"`
+	Data             string   `json:"data"`
+	BlockNumber      string   `json:"blockNumber"`
+	BlockHash        string   `json:"blockHash"`
+	TransactionHash  string   `json:"transactionHash"`
+	TransactionIndex string   `json:"transactionIndex"`
+	LogIndex         string   `json:"logIndex"`
+	Removed          bool     `json:"removed"`
+}
+
+type LogFilter struct {
+	BlockHash string     `json:"blockHash,omitempty"`
+	FromBlock string     `json:"fromBlock,omitempty"`
+	ToBlock   string     `json:"toBlock,omitempty"`
+	Address   []string   `json:"address,omitempty"`
+	Topics    [][]string `json:"topics,omitempty"`
+}
+
+type Receipt struct {
+	TransactionHash   string  `json:"transactionHash"`
+	BlockHash         string  `json:"blockHash"`
+	BlockNumber       string  `json:"blockNumber"`
+	Status            string  `json:"status"`
+	GasUsed           string  `json:"gasUsed"`
+	EffectiveGasPrice string  `json:"effectiveGasPrice"`
+	ContractAddress   *string `json:"contractAddress"`
+}
@@ -0,0 +1,88 @@
+package jsonrpc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBlockNotFound     = errors.New("jsonrpc: block not found")
+	ErrRateLimited       = errors.New("jsonrpc: rate limited")
+	ErrServer            = errors.New("jsonrpc: server error")
+	ErrMalformedResponse = errors.New("jsonrpc: malformed response")
+	ErrMethodNotFound    = errors.New("jsonrpc: method not found")
+	ErrQuorumNotReached  = errors.New("jsonrpc: quorum not reached")
+	ErrCircuitOpen       = errors.New("jsonrpc: circuit open")
+)
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// Is maps the rpc error codes to our typed errors, so callers can use errors.Is
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		// -32005 is the limit exceeded code (EIP-1474), some providers also use 429
+		return e.Code == -32005 || e.Code == 429 || strings.Contains(strings.ToLower(e.Message), "rate limit")
+	case ErrBlockNotFound:
+		msg := strings.ToLower(e.Message)
+		return strings.Contains(msg, "header not found") || strings.Contains(msg, "unknown block") || strings.Contains(msg, "block not found")
+	case ErrMethodNotFound:
+		// providers that don't have the method send -32601 or a message saying so
+		msg := strings.ToLower(e.Message)
+		return e.Code == -32601 || strings.Contains(msg, "method not found") || strings.Contains(msg, "not supported")
+	case ErrServer:
+		// internal error and the implementation defined server errors
+		return e.Code == -32603 || (e.Code <= -32000 && e.Code >= -32099 && e.Code != -32005)
+	}
+	return false
+}
+
+// statusError classifies the http status codes we get before the json body
+func statusError(code int) error {
+	switch {
+	case code == 429:
+		return fmt.Errorf("%w: http status %d", ErrRateLimited, code)
+	case code >= 500:
+		return fmt.Errorf("%w: http status %d", ErrServer, code)
+	}
+	return nil
+}
+
+// RateLimitError is a 429 from the provider, RetryAfter is zero when it didn't say how long to wait
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%v: http status 429, retry after %s", ErrRateLimited, e.RetryAfter)
+	}
+	return fmt.Sprintf("%v: http status 429", ErrRateLimited)
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// newRateLimitError reads the Retry-After header, in seconds or as a http date
+func newRateLimitError(h http.Header) *RateLimitError {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return &RateLimitError{}
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return &RateLimitError{RetryAfter: time.Duration(secs) * time.Second}
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return &RateLimitError{RetryAfter: d}
+		}
+	}
+	return &RateLimitError{}
+}
@@ -0,0 +1,80 @@
+package jsonrpc
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError_Is(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    *Error
+		target error
+		is     bool
+	}{
+		{"limit_exceeded_code", &Error{Code: -32005, Message: "limit exceeded"}, ErrRateLimited, true},
+		{"too_many_requests_code", &Error{Code: 429, Message: "Too Many Requests"}, ErrRateLimited, true},
+		{"rate_limit_message", &Error{Code: -32000, Message: "Rate limit reached"}, ErrRateLimited, true},
+		{"header_not_found", &Error{Code: -32000, Message: "header not found"}, ErrBlockNotFound, true},
+		{"unknown_block", &Error{Code: -39001, Message: "Unknown block"}, ErrBlockNotFound, true},
+		{"internal_error", &Error{Code: -32603, Message: "internal error"}, ErrServer, true},
+		{"server_error", &Error{Code: -32000, Message: "execution timeout"}, ErrServer, true},
+		{"limit_exceeded_is_not_server_error", &Error{Code: -32005, Message: "limit exceeded"}, ErrServer, false},
+		{"invalid_params", &Error{Code: -32602, Message: "invalid params"}, ErrServer, false},
+		{"method_not_found", &Error{Code: -32601, Message: "method not found"}, ErrBlockNotFound, false},
+		{"method_not_found_code", &Error{Code: -32601, Message: "the method eth_getBlockReceipts does not exist/is not available"}, ErrMethodNotFound, true},
+		{"method_not_supported_message", &Error{Code: -32000, Message: "Method not supported"}, ErrMethodNotFound, true},
+		{"invalid_params_is_not_method_not_found", &Error{Code: -32602, Message: "invalid params"}, ErrMethodNotFound, false},
+		{"other_target", &Error{Code: -32000, Message: "header not found"}, ErrMalformedResponse, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.is, errors.Is(tc.err, tc.target))
+		})
+	}
+}
+
+func TestError_Error(t *testing.T) {
+	t.Run("error_message", func(t *testing.T) {
+		err := &Error{Code: -32601, Message: "Method not found"}
+		assert.Equal(t, "rpc error -32601: Method not found", err.Error())
+	})
+}
+
+func TestStatusError(t *testing.T) {
+	t.Run("status_error_too_many_requests", func(t *testing.T) {
+		assert.ErrorIs(t, statusError(429), ErrRateLimited)
+	})
+	t.Run("status_error_bad_gateway", func(t *testing.T) {
+		assert.ErrorIs(t, statusError(502), ErrServer)
+	})
+	t.Run("status_error_ok", func(t *testing.T) {
+		assert.NoError(t, statusError(200))
+	})
+}
+
+func TestNewRateLimitError(t *testing.T) {
+	t.Run("rate_limit_error_retry_after_seconds", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("Retry-After", "3")
+		err := newRateLimitError(h)
+		assert.Equal(t, 3*time.Second, err.RetryAfter)
+		assert.ErrorIs(t, err, ErrRateLimited)
+	})
+	t.Run("rate_limit_error_retry_after_date", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		err := newRateLimitError(h)
+		assert.InDelta(t, time.Minute, err.RetryAfter, float64(2*time.Second))
+	})
+	t.Run("rate_limit_error_without_retry_after", func(t *testing.T) {
+		err := newRateLimitError(http.Header{})
+		assert.Zero(t, err.RetryAfter)
+		assert.ErrorIs(t, err, ErrRateLimited)
+	})
+}
@@ -29,40 +29,83 @@ func NewEthereum(cliUrl string, httpClient HTTPClient) *Ethereum {
 }
 
 func (e *Ethereum) GetCurrentBlockNumber(ctx context.Context) (uint64, error) {
-	payload := `{"jsonrpc":"2.0","method":"eth_blockNumber","params":[],"id":1}`
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cliUrl, strings.NewReader(payload))
+	result, err := e.call(ctx, `{"jsonrpc":"2.0","method":"eth_blockNumber","params":[],"id":1}`)
 	if err != nil {
 		return 0, err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := e.httpClient.Do(req)
+	var block string
+	if err := json.Unmarshal(result, &block); err != nil {
+		return 0, fmt.Errorf("%w: unexpected result type for eth_blockNumber: %v", ErrMalformedResponse, err)
+	}
+
+	return utils.ParseHexUint64(block)
+}
+
+func (e *Ethereum) GetBlockByNumber(ctx context.Context, blockNumber uint64) (*Block, error) {
+	payload := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_getBlockByNumber","params":["0x%x", true],"id":1}`, blockNumber)
+	result, err := e.call(ctx, payload)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var result rpcResp
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	// the node can be behind its own eth_blockNumber, in this case the result is null
+	if isNull(result) {
+		return nil, fmt.Errorf("%w: 0x%x", ErrBlockNotFound, blockNumber)
+	}
+
+	var block Block
+	if err := json.Unmarshal(result, &block); err != nil {
+		return nil, fmt.Errorf("%w: unexpected result type for eth_getBlockByNumber: %v", ErrMalformedResponse, err)
+	}
+
+	return &block, nil
+}
+
+// GetBlockNumberByTag returns the number of the block for the tag (latest, safe or finalized),
+// we don't need the transactions here so we ask only for the hashes
+func (e *Ethereum) GetBlockNumberByTag(ctx context.Context, tag string) (uint64, error) {
+	payload := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_getBlockByNumber","params":[%q, false],"id":1}`, tag)
+	result, err := e.call(ctx, payload)
+	if err != nil {
 		return 0, err
 	}
 
-	if result.Error != nil {
-		return 0, fmt.Errorf("rpc error %d: %s", result.Error.Code, result.Error.Message)
+	if isNull(result) {
+		return 0, fmt.Errorf("%w: block tag %s not available", ErrBlockNotFound, tag)
 	}
 
-	var block string
-	if err := json.Unmarshal(result.Result, &block); err != nil {
-		return 0, fmt.Errorf("unexpected result type for eth_blockNumber: %w", err)
+	var header struct {
+		Number string `json:"number"`
+	}
+	if err := json.Unmarshal(result, &header); err != nil {
+		return 0, fmt.Errorf("%w: unexpected result type for eth_getBlockByNumber: %v", ErrMalformedResponse, err)
 	}
 
-	return utils.ParseHexUint64(block)
+	return utils.ParseHexUint64(header.Number)
 }
 
-func (e *Ethereum) GetBlockByNumber(ctx context.Context, blockNumber uint64) (*Block, error) {
-	payload := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_getBlockByNumber","params":["0x%x", true],"id":1}`, blockNumber)
+func (e *Ethereum) GetLogs(ctx context.Context, filter LogFilter) ([]Log, error) {
+	params, err := json.Marshal(filter)
+	if err != nil {
+		return nil, err
+	}
 
+	payload := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_getLogs","params":[%s],"id":1}`, params)
+	result, err := e.call(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []Log
+	if err := json.Unmarshal(result, &logs); err != nil {
+		return nil, fmt.Errorf("%w: unexpected result type for eth_getLogs: %v", ErrMalformedResponse, err)
+	}
+
+	return logs, nil
+}
+
+func (e *Ethereum) call(ctx context.Context, payload string) (json.RawMessage, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cliUrl, strings.NewReader(payload))
 	if err != nil {
 		return nil, err
@@ -75,19 +118,27 @@ func (e *Ethereum) GetBlockByNumber(ctx context.Context, blockNumber uint64) (*B
 	}
 	defer resp.Body.Close()
 
+	// the body of a 429 says nothing useful, the header says how long to wait
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, newRateLimitError(resp.Header)
+	}
+
 	var result rpcResp
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+		// providers send html or plain text on 429/5xx, the status says more than the body
+		if statusErr := statusError(resp.StatusCode); statusErr != nil {
+			return nil, statusErr
+		}
+		return nil, fmt.Errorf("%w: %v", ErrMalformedResponse, err)
 	}
 
 	if result.Error != nil {
-		return nil, fmt.Errorf("rpc error %d: %s", result.Error.Code, result.Error.Message)
+		return nil, result.Error
 	}
 
-	var block Block
-	if err := json.Unmarshal(result.Result, &block); err != nil {
-		return nil, fmt.Errorf("unexpected result type for eth_getBlockByNumber: %w", err)
-	}
+	return result.Result, nil
+}
 
-	return &block, nil
+func isNull(result json.RawMessage) bool {
+	return len(result) == 0 || string(result) == "null"
 }
@@ -194,3 +194,187 @@ func TestEthereum_GetBlockByNumber(t *testing.T) {
 		assert.Equal(t, "0xtx1", block.Transactions[0].Hash)
 	})
 }
+
+func TestEthereum_GetBlockNumberByTag(t *testing.T) {
+	t.Run("get_block_number_by_tag_success", func(t *testing.T) {
+		responseBody := `{"jsonrpc":"2.0","result":{"number":"0x1a2b","hash":"0xabc","transactions":["0xtx1"]},"id":1}`
+		mockResponse := &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(responseBody)),
+			Header:     make(http.Header),
+		}
+
+		mockClient := &mockHTTPClient{response: mockResponse}
+		ethereum := &Ethereum{
+			cliUrl:     "https://test-rpc.com",
+			httpClient: mockClient,
+		}
+
+		ctx := context.Background()
+		blockNumber, err := ethereum.GetBlockNumberByTag(ctx, BlockTagFinalized)
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(6699), blockNumber)
+	})
+
+	t.Run("get_block_number_by_tag_null_result", func(t *testing.T) {
+		responseBody := `{"jsonrpc":"2.0","result":null,"id":1}`
+		mockResponse := &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(responseBody)),
+			Header:     make(http.Header),
+		}
+
+		mockClient := &mockHTTPClient{response: mockResponse}
+		ethereum := &Ethereum{
+			cliUrl:     "https://test-rpc.com",
+			httpClient: mockClient,
+		}
+
+		ctx := context.Background()
+		blockNumber, err := ethereum.GetBlockNumberByTag(ctx, BlockTagSafe)
+
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+		assert.Contains(t, err.Error(), "block tag safe not available")
+		assert.Equal(t, uint64(0), blockNumber)
+	})
+
+	t.Run("get_block_number_by_tag_rpc_error", func(t *testing.T) {
+		responseBody := `{"jsonrpc":"2.0","error":{"code":-39001,"message":"Unknown block"},"id":1}`
+		mockResponse := &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(responseBody)),
+			Header:     make(http.Header),
+		}
+
+		mockClient := &mockHTTPClient{response: mockResponse}
+		ethereum := &Ethereum{
+			cliUrl:     "https://test-rpc.com",
+			httpClient: mockClient,
+		}
+
+		ctx := context.Background()
+		_, err := ethereum.GetBlockNumberByTag(ctx, BlockTagFinalized)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "rpc error -39001")
+	})
+}
+
+func TestEthereum_TypedErrors(t *testing.T) {
+	newEthereum := func(status int, body string) *Ethereum {
+		mockResponse := &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     make(http.Header),
+		}
+		return &Ethereum{
+			cliUrl:     "https://test-rpc.com",
+			httpClient: &mockHTTPClient{response: mockResponse},
+		}
+	}
+
+	t.Run("get_block_by_number_null_result", func(t *testing.T) {
+		ethereum := newEthereum(200, `{"jsonrpc":"2.0","result":null,"id":1}`)
+
+		block, err := ethereum.GetBlockByNumber(context.Background(), 6699)
+
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+		assert.Nil(t, block)
+	})
+
+	t.Run("get_block_by_number_malformed_result", func(t *testing.T) {
+		ethereum := newEthereum(200, `{"jsonrpc":"2.0","result":"0x1","id":1}`)
+
+		block, err := ethereum.GetBlockByNumber(context.Background(), 6699)
+
+		assert.ErrorIs(t, err, ErrMalformedResponse)
+		assert.Nil(t, block)
+	})
+
+	t.Run("get_block_by_number_rate_limited_status", func(t *testing.T) {
+		ethereum := newEthereum(429, `Too Many Requests`)
+
+		_, err := ethereum.GetBlockByNumber(context.Background(), 6699)
+
+		assert.ErrorIs(t, err, ErrRateLimited)
+	})
+
+	t.Run("get_block_by_number_bad_gateway_status", func(t *testing.T) {
+		ethereum := newEthereum(502, `<html>Bad Gateway</html>`)
+
+		_, err := ethereum.GetBlockByNumber(context.Background(), 6699)
+
+		assert.ErrorIs(t, err, ErrServer)
+	})
+
+	t.Run("get_block_by_number_rate_limited_rpc_error", func(t *testing.T) {
+		ethereum := newEthereum(200, `{"jsonrpc":"2.0","error":{"code":-32005,"message":"limit exceeded"},"id":1}`)
+
+		_, err := ethereum.GetBlockByNumber(context.Background(), 6699)
+
+		assert.ErrorIs(t, err, ErrRateLimited)
+		var rpcErr *Error
+		assert.ErrorAs(t, err, &rpcErr)
+		assert.Equal(t, -32005, rpcErr.Code)
+	})
+
+	t.Run("get_current_block_number_malformed_body", func(t *testing.T) {
+		ethereum := newEthereum(200, `invalid json`)
+
+		_, err := ethereum.GetCurrentBlockNumber(context.Background())
+
+		assert.ErrorIs(t, err, ErrMalformedResponse)
+	})
+}
+
+type recordHTTPClient struct {
+	body     string
+	response string
+}
+
+func (r *recordHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.body = string(b)
+	return &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(strings.NewReader(r.response)),
+		Header:     make(http.Header),
+	}, nil
+}
+
+func TestEthereum_GetLogs(t *testing.T) {
+	t.Run("get_logs_success", func(t *testing.T) {
+		client := &recordHTTPClient{response: `{"jsonrpc":"2.0","result":[{"address":"0xtoken","topics":["0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"],"data":"0x01","transactionHash":"0xtx1","logIndex":"0x0"}],"id":1}`}
+		ethereum := NewEthereum("https://test-rpc.com", client)
+
+		logs, err := ethereum.GetLogs(context.Background(), LogFilter{BlockHash: "0xabc", Topics: [][]string{{TransferTopic}}})
+
+		assert.NoError(t, err)
+		assert.Len(t, logs, 1)
+		assert.Equal(t, "0xtx1", logs[0].TransactionHash)
+		assert.Contains(t, client.body, `"method":"eth_getLogs"`)
+		assert.Contains(t, client.body, `"blockHash":"0xabc"`)
+		assert.NotContains(t, client.body, `fromBlock`)
+	})
+
+	t.Run("get_logs_malformed_result", func(t *testing.T) {
+		client := &recordHTTPClient{response: `{"jsonrpc":"2.0","result":"0x1","id":1}`}
+		ethereum := NewEthereum("https://test-rpc.com", client)
+
+		_, err := ethereum.GetLogs(context.Background(), LogFilter{BlockHash: "0xabc"})
+
+		assert.ErrorIs(t, err, ErrMalformedResponse)
+	})
+
+	t.Run("get_logs_http_error", func(t *testing.T) {
+		ethereum := NewEthereum("https://test-rpc.com", &mockHTTPClient{err: assert.AnError})
+
+		_, err := ethereum.GetLogs(context.Background(), LogFilter{BlockHash: "0xabc"})
+
+		assert.Error(t, err)
+	})
+}
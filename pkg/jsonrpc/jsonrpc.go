@@ -4,7 +4,20 @@ import (
 	"context"
 )
 
+const (
+	BlockTagLatest    = "latest"
+	BlockTagSafe      = "safe"
+	BlockTagFinalized = "finalized"
+)
+
 type JsonRpcClient interface {
 	GetCurrentBlockNumber(context.Context) (uint64, error)
 	GetBlockByNumber(context.Context, uint64) (*Block, error)
+	GetBlocksByNumber(context.Context, []uint64) ([]*Block, []error, error)
+	GetBlockNumberByTag(context.Context, string) (uint64, error)
+	GetLogs(context.Context, LogFilter) ([]Log, error)
+	GetInternalTransfers(context.Context, uint64, string) ([]InternalTransfer, error)
+	GetBlockReceipts(context.Context, string) ([]Receipt, error)
+	GetTransactionReceipt(context.Context, string) (*Receipt, error)
+	GetTransactionReceipts(context.Context, []string) ([]*Receipt, []error, error)
 }
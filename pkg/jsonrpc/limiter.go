@@ -0,0 +1,295 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// on a rate limit the rate is cut in half, and every success gives back a bit of it
+	limiterDecrease  = 0.5
+	limiterIncrease  = 0.01
+	limiterMinFactor = 0.05
+)
+
+// tokenBucket refills rate tokens per second up to one second of burst
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+}
+
+func (b *tokenBucket) refill(elapsed time.Duration) {
+	b.tokens += b.rate * elapsed.Seconds()
+	if burst := b.burst(); b.tokens > burst {
+		b.tokens = burst
+	}
+}
+
+func (b *tokenBucket) burst() float64 {
+	if b.rate < 1 {
+		return 1
+	}
+	return b.rate
+}
+
+// wait returns how long until there are n tokens, a request bigger than the burst
+// goes when the bucket is full and leaves it in debt
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if n > b.burst() {
+		n = b.burst()
+	}
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// RateLimiter limits the requests per second and the compute units per second (the quota unit
+// of the providers, every method has a cost). It is adaptive: a rate limit response halves
+// both rates and pauses for the Retry-After, then the successes slowly ramp them back up.
+type RateLimiter struct {
+	mu sync.Mutex
+	// zero means no limit
+	maxRequests     float64
+	maxComputeUnits float64
+	costs           map[string]int
+	defaultCost     int
+
+	factor      float64
+	requests    tokenBucket
+	units       tokenBucket
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func NewRateLimiter(requestsPerSecond, computeUnitsPerSecond float64, costs map[string]int, defaultCost int) *RateLimiter {
+	l := &RateLimiter{
+		maxRequests:     requestsPerSecond,
+		maxComputeUnits: computeUnitsPerSecond,
+		costs:           costs,
+		defaultCost:     defaultCost,
+		factor:          1,
+		last:            time.Now(),
+	}
+	l.requests = tokenBucket{rate: requestsPerSecond, tokens: requestsPerSecond}
+	l.units = tokenBucket{rate: computeUnitsPerSecond, tokens: computeUnitsPerSecond}
+	return l
+}
+
+// Wait blocks until n requests of the method can be sent
+func (l *RateLimiter) Wait(ctx context.Context, method string, n int) error {
+	for {
+		delay := l.reserve(method, n)
+		if delay == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (l *RateLimiter) reserve(method string, n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	elapsed := now.Sub(l.last)
+	l.last = now
+	l.requests.refill(elapsed)
+	l.units.refill(elapsed)
+
+	var delay time.Duration
+	if l.maxRequests > 0 {
+		delay = l.requests.wait(float64(n))
+	}
+	cost := float64(l.cost(method) * n)
+	if l.maxComputeUnits > 0 {
+		if d := l.units.wait(cost); d > delay {
+			delay = d
+		}
+	}
+	if delay > 0 {
+		return delay
+	}
+
+	l.requests.tokens -= float64(n)
+	l.units.tokens -= cost
+	return 0
+}
+
+func (l *RateLimiter) cost(method string) int {
+	if c, ok := l.costs[method]; ok {
+		return c
+	}
+	return l.defaultCost
+}
+
+// Observe adapts the rates to the result of a request
+func (l *RateLimiter) Observe(err error) {
+	switch {
+	case err == nil:
+		l.mu.Lock()
+		l.setFactor(l.factor + limiterIncrease)
+		l.mu.Unlock()
+	case errors.Is(err, ErrRateLimited):
+		var rlErr *RateLimitError
+		var retryAfter time.Duration
+		if errors.As(err, &rlErr) {
+			retryAfter = rlErr.RetryAfter
+		}
+		l.slowDown(retryAfter)
+	}
+}
+
+func (l *RateLimiter) slowDown(pause time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.setFactor(l.factor * limiterDecrease)
+	// no burst after a rate limit, the tokens come back at the new rate
+	l.requests.tokens = 0
+	l.units.tokens = 0
+	now := time.Now()
+	l.last = now
+	if pause > 0 {
+		l.pausedUntil = now.Add(pause)
+		l.last = l.pausedUntil
+	}
+}
+
+func (l *RateLimiter) setFactor(f float64) {
+	if f > 1 {
+		f = 1
+	}
+	if f < limiterMinFactor {
+		f = limiterMinFactor
+	}
+	l.factor = f
+	l.requests.rate = l.maxRequests * f
+	l.units.rate = l.maxComputeUnits * f
+}
+
+// Rates returns the current requests and compute units per second
+func (l *RateLimiter) Rates() (float64, float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.requests.rate, l.units.rate
+}
+
+// LimitedClient waits on the rate limiter before every request and tells it the results
+type LimitedClient struct {
+	client  JsonRpcClient
+	limiter *RateLimiter
+}
+
+var _ JsonRpcClient = &LimitedClient{}
+
+func NewLimitedClient(client JsonRpcClient, limiter *RateLimiter) *LimitedClient {
+	return &LimitedClient{client: client, limiter: limiter}
+}
+
+func (c *LimitedClient) GetCurrentBlockNumber(ctx context.Context) (uint64, error) {
+	if err := c.limiter.Wait(ctx, "eth_blockNumber", 1); err != nil {
+		return 0, err
+	}
+	n, err := c.client.GetCurrentBlockNumber(ctx)
+	c.limiter.Observe(err)
+	return n, err
+}
+
+func (c *LimitedClient) GetBlockByNumber(ctx context.Context, n uint64) (*Block, error) {
+	if err := c.limiter.Wait(ctx, "eth_getBlockByNumber", 1); err != nil {
+		return nil, err
+	}
+	b, err := c.client.GetBlockByNumber(ctx, n)
+	c.limiter.Observe(err)
+	return b, err
+}
+
+func (c *LimitedClient) GetBlocksByNumber(ctx context.Context, ns []uint64) ([]*Block, []error, error) {
+	if err := c.limiter.Wait(ctx, "eth_getBlockByNumber", len(ns)); err != nil {
+		return nil, nil, err
+	}
+	blocks, errs, err := c.client.GetBlocksByNumber(ctx, ns)
+	c.observeBatch(errs, err)
+	return blocks, errs, err
+}
+
+func (c *LimitedClient) GetBlockNumberByTag(ctx context.Context, tag string) (uint64, error) {
+	if err := c.limiter.Wait(ctx, "eth_getBlockByNumber", 1); err != nil {
+		return 0, err
+	}
+	n, err := c.client.GetBlockNumberByTag(ctx, tag)
+	c.limiter.Observe(err)
+	return n, err
+}
+
+func (c *LimitedClient) GetLogs(ctx context.Context, filter LogFilter) ([]Log, error) {
+	if err := c.limiter.Wait(ctx, "eth_getLogs", 1); err != nil {
+		return nil, err
+	}
+	logs, err := c.client.GetLogs(ctx, filter)
+	c.limiter.Observe(err)
+	return logs, err
+}
+
+func (c *LimitedClient) GetInternalTransfers(ctx context.Context, n uint64, mode string) ([]InternalTransfer, error) {
+	method := "debug_traceBlockByNumber"
+	if mode == TraceModeParity {
+		method = "trace_block"
+	}
+	if err := c.limiter.Wait(ctx, method, 1); err != nil {
+		return nil, err
+	}
+	transfers, err := c.client.GetInternalTransfers(ctx, n, mode)
+	c.limiter.Observe(err)
+	return transfers, err
+}
+
+func (c *LimitedClient) GetBlockReceipts(ctx context.Context, blockHash string) ([]Receipt, error) {
+	if err := c.limiter.Wait(ctx, "eth_getBlockReceipts", 1); err != nil {
+		return nil, err
+	}
+	receipts, err := c.client.GetBlockReceipts(ctx, blockHash)
+	c.limiter.Observe(err)
+	return receipts, err
+}
+
+func (c *LimitedClient) GetTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	if err := c.limiter.Wait(ctx, "eth_getTransactionReceipt", 1); err != nil {
+		return nil, err
+	}
+	receipt, err := c.client.GetTransactionReceipt(ctx, txHash)
+	c.limiter.Observe(err)
+	return receipt, err
+}
+
+func (c *LimitedClient) GetTransactionReceipts(ctx context.Context, txHashes []string) ([]*Receipt, []error, error) {
+	if err := c.limiter.Wait(ctx, "eth_getTransactionReceipt", len(txHashes)); err != nil {
+		return nil, nil, err
+	}
+	receipts, errs, err := c.client.GetTransactionReceipts(ctx, txHashes)
+	c.observeBatch(errs, err)
+	return receipts, errs, err
+}
+
+// in a batch the provider can limit only some of the elements
+func (c *LimitedClient) observeBatch(errs []error, err error) {
+	if err == nil {
+		for _, e := range errs {
+			if errors.Is(e, ErrRateLimited) {
+				err = e
+				break
+			}
+		}
+	}
+	c.limiter.Observe(err)
+}
@@ -0,0 +1,116 @@
+package jsonrpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("rate_limiter_allows_the_burst", func(t *testing.T) {
+		l := NewRateLimiter(10, 0, nil, 1)
+
+		for i := 0; i < 10; i++ {
+			assert.Zero(t, l.reserve("eth_blockNumber", 1))
+		}
+		assert.Greater(t, l.reserve("eth_blockNumber", 1), time.Duration(0))
+	})
+
+	t.Run("rate_limiter_compute_units", func(t *testing.T) {
+		l := NewRateLimiter(0, 100, map[string]int{"eth_getLogs": 75}, 10)
+
+		assert.Zero(t, l.reserve("eth_getLogs", 1))
+		// 25 units left, not enough for another eth_getLogs but enough for two cheap calls
+		assert.Greater(t, l.reserve("eth_getLogs", 1), time.Duration(0))
+		assert.Zero(t, l.reserve("eth_blockNumber", 2))
+	})
+
+	t.Run("rate_limiter_wait_respects_context", func(t *testing.T) {
+		l := NewRateLimiter(1, 0, nil, 1)
+		assert.NoError(t, l.Wait(context.Background(), "eth_blockNumber", 1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, l.Wait(ctx, "eth_blockNumber", 1), context.DeadlineExceeded)
+	})
+
+	t.Run("rate_limiter_slows_down_and_ramps_up", func(t *testing.T) {
+		l := NewRateLimiter(100, 1000, nil, 1)
+
+		l.Observe(ErrRateLimited)
+		rps, cus := l.Rates()
+		assert.Equal(t, 50.0, rps)
+		assert.Equal(t, 500.0, cus)
+
+		for i := 0; i < 10; i++ {
+			l.Observe(nil)
+		}
+		rps, _ = l.Rates()
+		assert.InDelta(t, 60.0, rps, 0.001)
+
+		for i := 0; i < 100; i++ {
+			l.Observe(nil)
+		}
+		rps, _ = l.Rates()
+		assert.Equal(t, 100.0, rps)
+	})
+
+	t.Run("rate_limiter_pauses_for_retry_after", func(t *testing.T) {
+		l := NewRateLimiter(100, 0, nil, 1)
+
+		l.Observe(&RateLimitError{RetryAfter: time.Second})
+
+		assert.InDelta(t, time.Second, l.reserve("eth_blockNumber", 1), float64(50*time.Millisecond))
+	})
+
+	t.Run("rate_limiter_ignores_other_errors", func(t *testing.T) {
+		l := NewRateLimiter(100, 0, nil, 1)
+
+		l.Observe(ErrServer)
+
+		rps, _ := l.Rates()
+		assert.Equal(t, 100.0, rps)
+	})
+}
+
+func TestLimitedClient(t *testing.T) {
+	t.Run("limited_client_slows_down_on_429", func(t *testing.T) {
+		client := &mockHTTPClient{response: &http.Response{
+			StatusCode: 429,
+			Header:     http.Header{"Retry-After": []string{"1"}},
+			Body:       io.NopCloser(strings.NewReader("Too Many Requests")),
+		}}
+		limiter := NewRateLimiter(10, 0, nil, 1)
+		c := NewLimitedClient(NewEthereum("https://test-rpc.com", client), limiter)
+
+		_, err := c.GetCurrentBlockNumber(context.Background())
+
+		var rlErr *RateLimitError
+		assert.ErrorAs(t, err, &rlErr)
+		assert.Equal(t, time.Second, rlErr.RetryAfter)
+		rps, _ := limiter.Rates()
+		assert.Equal(t, 5.0, rps)
+		assert.Greater(t, limiter.reserve("eth_blockNumber", 1), 900*time.Millisecond)
+	})
+
+	t.Run("limited_client_batch_partial_rate_limit", func(t *testing.T) {
+		client := &recordHTTPClient{response: `[
+			{"jsonrpc":"2.0","result":{"number":"0x64"},"id":1},
+			{"jsonrpc":"2.0","error":{"code":-32005,"message":"limit exceeded"},"id":2}
+		]`}
+		limiter := NewRateLimiter(10, 0, nil, 1)
+		c := NewLimitedClient(NewEthereum("https://test-rpc.com", client), limiter)
+
+		_, errs, err := c.GetBlocksByNumber(context.Background(), []uint64{100, 101})
+
+		assert.NoError(t, err)
+		assert.ErrorIs(t, errs[1], ErrRateLimited)
+		rps, _ := limiter.Rates()
+		assert.Equal(t, 5.0, rps)
+	})
+}
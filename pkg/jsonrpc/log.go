@@ -0,0 +1,45 @@
+package jsonrpc
+
+import (
+	"strings"
+)
+
+// keccak256("Transfer(address,address,uint256)")
+const TransferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// DecodeTransfer decodes an ERC-20 Transfer log. ERC-721 uses the same signature but with the
+// token id indexed (4 topics), so it is not decoded here. The amount is the raw uint256 in hex.
+func (l Log) DecodeTransfer() (from, to, amount string, ok bool) {
+	if len(l.Topics) != 3 || !strings.EqualFold(l.Topics[0], TransferTopic) {
+		return "", "", "", false
+	}
+
+	from, ok = topicToAddress(l.Topics[1])
+	if !ok {
+		return "", "", "", false
+	}
+	to, ok = topicToAddress(l.Topics[2])
+	if !ok {
+		return "", "", "", false
+	}
+
+	data := strings.TrimPrefix(strings.ToLower(l.Data), "0x")
+	if len(data) != 64 {
+		return "", "", "", false
+	}
+	amount = strings.TrimLeft(data, "0")
+	if amount == "" {
+		amount = "0"
+	}
+
+	return from, to, "0x" + amount, true
+}
+
+// the indexed addresses are left padded to 32 bytes
+func topicToAddress(topic string) (string, bool) {
+	t := strings.TrimPrefix(strings.ToLower(topic), "0x")
+	if len(t) != 64 || strings.TrimLeft(t[:24], "0") != "" {
+		return "", false
+	}
+	return "0x" + t[24:], true
+}
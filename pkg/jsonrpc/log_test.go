@@ -0,0 +1,68 @@
+package jsonrpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testFromTopic = "0x000000000000000000000000d8da6bf26964af9d7eed9e03e53415d37aa96045"
+	testToTopic   = "0x00000000000000000000000028c6c06298d514db089934071355e5743bf21d60"
+	testAmount    = "0x00000000000000000000000000000000000000000000000000000000000f4240"
+)
+
+func TestLog_DecodeTransfer(t *testing.T) {
+	t.Run("decode_transfer_success", func(t *testing.T) {
+		l := Log{Topics: []string{TransferTopic, testFromTopic, testToTopic}, Data: testAmount}
+
+		from, to, amount, ok := l.DecodeTransfer()
+
+		assert.True(t, ok)
+		assert.Equal(t, "0xd8da6bf26964af9d7eed9e03e53415d37aa96045", from)
+		assert.Equal(t, "0x28c6c06298d514db089934071355e5743bf21d60", to)
+		assert.Equal(t, "0xf4240", amount)
+	})
+
+	t.Run("decode_transfer_zero_amount", func(t *testing.T) {
+		l := Log{Topics: []string{TransferTopic, testFromTopic, testToTopic}, Data: "0x" + "0000000000000000000000000000000000000000000000000000000000000000"}
+
+		_, _, amount, ok := l.DecodeTransfer()
+
+		assert.True(t, ok)
+		assert.Equal(t, "0x0", amount)
+	})
+
+	t.Run("decode_transfer_erc721_is_ignored", func(t *testing.T) {
+		l := Log{Topics: []string{TransferTopic, testFromTopic, testToTopic, testAmount}, Data: "0x"}
+
+		_, _, _, ok := l.DecodeTransfer()
+
+		assert.False(t, ok)
+	})
+
+	t.Run("decode_transfer_other_event", func(t *testing.T) {
+		approval := "0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925"
+		l := Log{Topics: []string{approval, testFromTopic, testToTopic}, Data: testAmount}
+
+		_, _, _, ok := l.DecodeTransfer()
+
+		assert.False(t, ok)
+	})
+
+	t.Run("decode_transfer_invalid_topic", func(t *testing.T) {
+		l := Log{Topics: []string{TransferTopic, "0x1234", testToTopic}, Data: testAmount}
+
+		_, _, _, ok := l.DecodeTransfer()
+
+		assert.False(t, ok)
+	})
+
+	t.Run("decode_transfer_invalid_data", func(t *testing.T) {
+		l := Log{Topics: []string{TransferTopic, testFromTopic, testToTopic}, Data: "0x01"}
+
+		_, _, _, ok := l.DecodeTransfer()
+
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,286 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// weight of the last sample in the latency and error rate averages
+const healthAlpha = 0.2
+
+// what a failing provider adds to its score, it has to be more than any healthy latency so a
+// provider that fails fast doesn't go before the slower ones that answer
+const errorPenalty = time.Second
+
+type Provider struct {
+	Name   string
+	Client JsonRpcClient
+}
+
+type ProviderStats struct {
+	Name      string
+	Latency   time.Duration
+	ErrorRate float64
+	Head      uint64
+	Ejected   bool
+}
+
+type providerState struct {
+	Provider
+	latency   time.Duration
+	errorRate float64
+	head      uint64
+	ejected   bool
+}
+
+// MultiClient sends every request to the healthiest provider and fails over to the next
+// ones on errors. The providers whose head lags more than maxLag blocks behind the best
+// head are ejected until they catch up.
+type MultiClient struct {
+	mu        sync.Mutex
+	providers []*providerState
+	maxLag    uint64
+}
+
+var _ JsonRpcClient = &MultiClient{}
+
+func NewMultiClient(providers []Provider, maxLag uint64) *MultiClient {
+	m := &MultiClient{maxLag: maxLag}
+	for _, p := range providers {
+		m.providers = append(m.providers, &providerState{Provider: p})
+	}
+	return m
+}
+
+// Run checks the head of every provider on each interval, so the lagging ones are ejected
+// even when they are not getting requests
+func (m *MultiClient) Run(ctx context.Context, interval, reqTimeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.checkHeads(ctx, reqTimeout)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *MultiClient) checkHeads(ctx context.Context, reqTimeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, p := range m.providers {
+		wg.Add(1)
+		go func(p *providerState) {
+			defer wg.Done()
+			reqCtx, cancel := context.WithTimeout(ctx, reqTimeout)
+			defer cancel()
+
+			start := time.Now()
+			head, err := p.Client.GetCurrentBlockNumber(reqCtx)
+			m.record(p, time.Since(start), err)
+			if err == nil {
+				m.setHead(p, head)
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+// Stats returns the health of the providers, in the order they were given
+func (m *MultiClient) Stats() []ProviderStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]ProviderStats, len(m.providers))
+	for i, p := range m.providers {
+		stats[i] = ProviderStats{Name: p.Name, Latency: p.latency, ErrorRate: p.errorRate, Head: p.head, Ejected: p.ejected}
+	}
+	return stats
+}
+
+func (m *MultiClient) GetCurrentBlockNumber(ctx context.Context) (uint64, error) {
+	var head uint64
+	err := m.do(ctx, func(p *providerState) error {
+		var err error
+		head, err = p.Client.GetCurrentBlockNumber(ctx)
+		if err == nil {
+			m.setHead(p, head)
+		}
+		return err
+	})
+	return head, err
+}
+
+func (m *MultiClient) GetBlockByNumber(ctx context.Context, n uint64) (*Block, error) {
+	var block *Block
+	err := m.do(ctx, func(p *providerState) error {
+		var err error
+		block, err = p.Client.GetBlockByNumber(ctx, n)
+		return err
+	})
+	return block, err
+}
+
+func (m *MultiClient) GetBlocksByNumber(ctx context.Context, ns []uint64) ([]*Block, []error, error) {
+	var blocks []*Block
+	var errs []error
+	err := m.do(ctx, func(p *providerState) error {
+		var err error
+		blocks, errs, err = p.Client.GetBlocksByNumber(ctx, ns)
+		return err
+	})
+	return blocks, errs, err
+}
+
+func (m *MultiClient) GetBlockNumberByTag(ctx context.Context, tag string) (uint64, error) {
+	var n uint64
+	err := m.do(ctx, func(p *providerState) error {
+		var err error
+		n, err = p.Client.GetBlockNumberByTag(ctx, tag)
+		return err
+	})
+	return n, err
+}
+
+func (m *MultiClient) GetLogs(ctx context.Context, filter LogFilter) ([]Log, error) {
+	var logs []Log
+	err := m.do(ctx, func(p *providerState) error {
+		var err error
+		logs, err = p.Client.GetLogs(ctx, filter)
+		return err
+	})
+	return logs, err
+}
+
+func (m *MultiClient) GetInternalTransfers(ctx context.Context, n uint64, mode string) ([]InternalTransfer, error) {
+	var transfers []InternalTransfer
+	err := m.do(ctx, func(p *providerState) error {
+		var err error
+		transfers, err = p.Client.GetInternalTransfers(ctx, n, mode)
+		return err
+	})
+	return transfers, err
+}
+
+func (m *MultiClient) GetBlockReceipts(ctx context.Context, blockHash string) ([]Receipt, error) {
+	var receipts []Receipt
+	err := m.do(ctx, func(p *providerState) error {
+		var err error
+		receipts, err = p.Client.GetBlockReceipts(ctx, blockHash)
+		return err
+	})
+	return receipts, err
+}
+
+func (m *MultiClient) GetTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	var receipt *Receipt
+	err := m.do(ctx, func(p *providerState) error {
+		var err error
+		receipt, err = p.Client.GetTransactionReceipt(ctx, txHash)
+		return err
+	})
+	return receipt, err
+}
+
+func (m *MultiClient) GetTransactionReceipts(ctx context.Context, txHashes []string) ([]*Receipt, []error, error) {
+	var receipts []*Receipt
+	var errs []error
+	err := m.do(ctx, func(p *providerState) error {
+		var err error
+		receipts, errs, err = p.Client.GetTransactionReceipts(ctx, txHashes)
+		return err
+	})
+	return receipts, errs, err
+}
+
+// do runs the request on the providers from the healthiest until one succeeds
+func (m *MultiClient) do(ctx context.Context, fn func(*providerState) error) error {
+	err := errors.New("jsonrpc: no providers")
+	for _, p := range m.ranked() {
+		start := time.Now()
+		err = fn(p)
+		if ctx.Err() != nil {
+			return err
+		}
+		m.record(p, time.Since(start), err)
+		if err == nil {
+			return nil
+		}
+		log.Printf("multi: provider %s failed, trying the next one: %v", p.Name, err)
+	}
+	return err
+}
+
+// ranked returns the providers by score, the ejected ones go last so we still
+// have someone to ask when all of them are lagging
+func (m *MultiClient) ranked() []*providerState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ranked := make([]*providerState, len(m.providers))
+	copy(ranked, m.providers)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].ejected != ranked[j].ejected {
+			return !ranked[i].ejected
+		}
+		return ranked[i].score() < ranked[j].score()
+	})
+	return ranked
+}
+
+// score is the expected latency plus the error penalty, a provider failing half of the requests
+// counts as 500ms slower. The providers without samples score 0 so they get tried.
+func (p *providerState) score() float64 {
+	return float64(p.latency) + p.errorRate*float64(errorPenalty)
+}
+
+func (m *MultiClient) record(p *providerState, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the node being behind is not a failure, the head check takes care of it
+	failed := 0.0
+	if err != nil && !errors.Is(err, ErrBlockNotFound) {
+		failed = 1
+	}
+
+	if p.latency == 0 {
+		p.latency = latency
+	} else {
+		p.latency = time.Duration(healthAlpha*float64(latency) + (1-healthAlpha)*float64(p.latency))
+	}
+	p.errorRate = healthAlpha*failed + (1-healthAlpha)*p.errorRate
+}
+
+func (m *MultiClient) setHead(p *providerState, head uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if head > p.head {
+		p.head = head
+	}
+
+	var best uint64
+	for _, o := range m.providers {
+		if o.head > best {
+			best = o.head
+		}
+	}
+	for _, o := range m.providers {
+		ejected := best > o.head+m.maxLag
+		if ejected != o.ejected {
+			if ejected {
+				log.Printf("multi: ejecting provider %s, head %d is behind %d", o.Name, o.head, best)
+			} else {
+				log.Printf("multi: provider %s caught up at head %d", o.Name, o.head)
+			}
+			o.ejected = ejected
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProvider answers the heads and the blocks, the other methods are not used here
+type fakeProvider struct {
+	JsonRpcClient
+	mu    sync.Mutex
+	name  string
+	head  uint64
+	delay time.Duration
+	err   error
+	calls int
+	// the block to return, by default the hash is the provider name
+	block *Block
+}
+
+func (f *fakeProvider) GetCurrentBlockNumber(ctx context.Context) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	time.Sleep(f.delay)
+	return f.head, f.err
+}
+
+func (f *fakeProvider) GetBlockByNumber(ctx context.Context, n uint64) (*Block, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	time.Sleep(f.delay)
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.block != nil {
+		b := *f.block
+		return &b, nil
+	}
+	return &Block{Hash: f.name}, nil
+}
+
+func (f *fakeProvider) GetBlocksByNumber(ctx context.Context, ns []uint64) ([]*Block, []error, error) {
+	blocks := make([]*Block, len(ns))
+	errs := make([]error, len(ns))
+	for i, n := range ns {
+		blocks[i], errs[i] = f.GetBlockByNumber(ctx, n)
+	}
+	return blocks, errs, nil
+}
+
+func newTestMultiClient(maxLag uint64, fakes ...*fakeProvider) *MultiClient {
+	providers := make([]Provider, len(fakes))
+	for i, f := range fakes {
+		providers[i] = Provider{Name: f.name, Client: f}
+	}
+	return NewMultiClient(providers, maxLag)
+}
+
+func TestMultiClient(t *testing.T) {
+	t.Run("multi_client_fails_over", func(t *testing.T) {
+		a := &fakeProvider{name: "a", err: ErrServer}
+		b := &fakeProvider{name: "b"}
+		m := newTestMultiClient(5, a, b)
+
+		blk, err := m.GetBlockByNumber(context.Background(), 100)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "b", blk.Hash)
+		stats := m.Stats()
+		assert.Greater(t, stats[0].ErrorRate, 0.0)
+		assert.Equal(t, 0.0, stats[1].ErrorRate)
+	})
+
+	t.Run("multi_client_routes_to_the_healthiest", func(t *testing.T) {
+		a := &fakeProvider{name: "a", err: ErrServer}
+		b := &fakeProvider{name: "b"}
+		m := newTestMultiClient(5, a, b)
+		// a fails at once, b answers but it is slower
+		m.record(m.providers[1], 100*time.Millisecond, nil)
+
+		for i := 0; i < 5; i++ {
+			_, err := m.GetBlockByNumber(context.Background(), 100)
+			assert.NoError(t, err)
+		}
+
+		// after the first failure a goes to the end of the line
+		assert.Equal(t, 1, a.calls)
+		assert.Equal(t, 5, b.calls)
+	})
+
+	t.Run("multi_client_prefers_lower_latency", func(t *testing.T) {
+		slow := &fakeProvider{name: "slow"}
+		fast := &fakeProvider{name: "fast"}
+		m := newTestMultiClient(5, slow, fast)
+		m.record(m.providers[0], 20*time.Millisecond, nil)
+		m.record(m.providers[1], time.Millisecond, nil)
+
+		blk, err := m.GetBlockByNumber(context.Background(), 100)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "fast", blk.Hash)
+	})
+
+	t.Run("multi_client_ranks_by_errors_before_latency", func(t *testing.T) {
+		m := newTestMultiClient(5, &fakeProvider{name: "failing"}, &fakeProvider{name: "healthy"})
+		m.record(m.providers[0], time.Millisecond, ErrRateLimited)
+		m.record(m.providers[1], 100*time.Millisecond, nil)
+
+		assert.Equal(t, "healthy", m.ranked()[0].Name)
+	})
+
+	t.Run("multi_client_ejects_lagging_provider", func(t *testing.T) {
+		lagging := &fakeProvider{name: "lagging", head: 90}
+		synced := &fakeProvider{name: "synced", head: 100, delay: 5 * time.Millisecond}
+		m := newTestMultiClient(5, lagging, synced)
+		m.checkHeads(context.Background(), time.Second)
+
+		blk, err := m.GetBlockByNumber(context.Background(), 100)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "synced", blk.Hash)
+		assert.True(t, m.Stats()[0].Ejected)
+
+		lagging.mu.Lock()
+		lagging.head = 98
+		lagging.mu.Unlock()
+		m.checkHeads(context.Background(), time.Second)
+		assert.False(t, m.Stats()[0].Ejected)
+	})
+
+	t.Run("multi_client_uses_ejected_when_nobody_else_answers", func(t *testing.T) {
+		lagging := &fakeProvider{name: "lagging", head: 90}
+		synced := &fakeProvider{name: "synced", head: 100}
+		m := newTestMultiClient(5, lagging, synced)
+		m.checkHeads(context.Background(), time.Second)
+		synced.err = ErrServer
+
+		blk, err := m.GetBlockByNumber(context.Background(), 100)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "lagging", blk.Hash)
+	})
+
+	t.Run("multi_client_all_providers_fail", func(t *testing.T) {
+		m := newTestMultiClient(5, &fakeProvider{name: "a", err: ErrServer}, &fakeProvider{name: "b", err: ErrRateLimited})
+
+		_, err := m.GetBlockByNumber(context.Background(), 100)
+
+		assert.ErrorIs(t, err, ErrRateLimited)
+	})
+
+	t.Run("multi_client_block_not_found_is_not_a_failure", func(t *testing.T) {
+		a := &fakeProvider{name: "a", err: ErrBlockNotFound}
+		m := newTestMultiClient(5, a, &fakeProvider{name: "b"})
+
+		_, err := m.GetBlockByNumber(context.Background(), 100)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0.0, m.Stats()[0].ErrorRate)
+	})
+
+	t.Run("multi_client_stops_on_context_done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		a := &fakeProvider{name: "a", err: context.Canceled}
+		b := &fakeProvider{name: "b"}
+		m := newTestMultiClient(5, a, b)
+
+		_, err := m.GetBlockByNumber(ctx, 100)
+
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, 0, b.calls)
+	})
+}
@@ -0,0 +1,354 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuorumClient only trusts a block when quorum providers return the same hash, parent hash
+// and transactions. It asks quorum providers first and the others only on a disagreement,
+// the providers that disagree with the majority are quarantined. The logs, receipts and
+// traces the events come from are checked the same way, they must be equal in quorum
+// providers. The head and the block tags go to the base client.
+type QuorumClient struct {
+	JsonRpcClient
+	providers  []Provider
+	quorum     int
+	quarantine time.Duration
+
+	mu          sync.Mutex
+	quarantined map[string]time.Time
+}
+
+var _ JsonRpcClient = &QuorumClient{}
+
+func NewQuorumClient(base JsonRpcClient, providers []Provider, quorum int, quarantine time.Duration) *QuorumClient {
+	return &QuorumClient{
+		JsonRpcClient: base,
+		providers:     providers,
+		quorum:        quorum,
+		quarantine:    quarantine,
+		quarantined:   make(map[string]time.Time),
+	}
+}
+
+type quorumVote struct {
+	provider string
+	blocks   []*Block
+	errs     []error
+}
+
+func (q *QuorumClient) GetBlockByNumber(ctx context.Context, n uint64) (*Block, error) {
+	blocks, errs, err := q.GetBlocksByNumber(ctx, []uint64{n})
+	if err != nil {
+		return nil, err
+	}
+	return blocks[0], errs[0]
+}
+
+func (q *QuorumClient) GetBlocksByNumber(ctx context.Context, ns []uint64) ([]*Block, []error, error) {
+	available := q.available()
+	if len(available) < q.quorum {
+		return nil, nil, fmt.Errorf("%w: only %d providers available", ErrQuorumNotReached, len(available))
+	}
+
+	votes := q.ask(ctx, available[:q.quorum], ns)
+	blocks, errs, disputed := q.resolve(ns, votes)
+	if disputed && len(available) > q.quorum {
+		votes = append(votes, q.ask(ctx, available[q.quorum:], ns)...)
+		blocks, errs, _ = q.resolve(ns, votes)
+	}
+	return blocks, errs, nil
+}
+
+// Quarantined returns the providers that are out because they disagreed
+func (q *QuorumClient) Quarantined() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var names []string
+	for _, p := range q.providers {
+		if until, ok := q.quarantined[p.Name]; ok && time.Now().Before(until) {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+func (q *QuorumClient) available() []Provider {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var available []Provider
+	for _, p := range q.providers {
+		if until, ok := q.quarantined[p.Name]; ok {
+			if now.Before(until) {
+				continue
+			}
+			delete(q.quarantined, p.Name)
+		}
+		available = append(available, p)
+	}
+	return available
+}
+
+// ask gets the blocks from the providers at the same time
+func (q *QuorumClient) ask(ctx context.Context, providers []Provider, ns []uint64) []quorumVote {
+	votes := make([]quorumVote, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p Provider) {
+			defer wg.Done()
+			v := quorumVote{provider: p.Name}
+			if len(ns) == 1 {
+				// not every provider accepts batches, for a single block we don't need it
+				blk, err := p.Client.GetBlockByNumber(ctx, ns[0])
+				v.blocks, v.errs = []*Block{blk}, []error{err}
+			} else {
+				var err error
+				v.blocks, v.errs, err = p.Client.GetBlocksByNumber(ctx, ns)
+				if err != nil {
+					v.blocks, v.errs = make([]*Block, len(ns)), make([]error, len(ns))
+					for j := range ns {
+						v.errs[j] = err
+					}
+				}
+			}
+			votes[i] = v
+		}(i, p)
+	}
+	wg.Wait()
+	return votes
+}
+
+// resolve picks for every block the version with at least quorum votes, disputed says
+// that some block has no quorum yet
+func (q *QuorumClient) resolve(ns []uint64, votes []quorumVote) ([]*Block, []error, bool) {
+	blocks := make([]*Block, len(ns))
+	errs := make([]error, len(ns))
+	disputed := false
+
+	for i, n := range ns {
+		groups := make(map[string][]int)
+		var order []string
+		var lastErr error
+		notFound := false
+		for v, vote := range votes {
+			if err := vote.errs[i]; err != nil || vote.blocks[i] == nil {
+				if err == nil {
+					err = fmt.Errorf("%w: 0x%x", ErrBlockNotFound, n)
+				}
+				notFound = notFound || errors.Is(err, ErrBlockNotFound)
+				lastErr = err
+				continue
+			}
+			fp := blockFingerprint(vote.blocks[i])
+			if _, ok := groups[fp]; !ok {
+				order = append(order, fp)
+			}
+			groups[fp] = append(groups[fp], v)
+		}
+
+		best := ""
+		for _, fp := range order {
+			if len(groups[fp]) > len(groups[best]) {
+				best = fp
+			}
+		}
+
+		if len(groups[best]) < q.quorum {
+			disputed = true
+			switch {
+			case len(order) > 1:
+				log.Printf("quorum: providers disagree on block %d", n)
+				errs[i] = fmt.Errorf("%w: providers disagree on block %d", ErrQuorumNotReached, n)
+			case notFound:
+				// someone doesn't have the block yet, it is the same as the node being behind
+				errs[i] = fmt.Errorf("%w: 0x%x not in all the providers", ErrBlockNotFound, n)
+			default:
+				errs[i] = fmt.Errorf("%w: block %d: %v", ErrQuorumNotReached, n, lastErr)
+			}
+			continue
+		}
+
+		blocks[i] = votes[groups[best][0]].blocks[i]
+		for _, fp := range order {
+			if fp == best {
+				continue
+			}
+			for _, v := range groups[fp] {
+				q.quarantineProvider(votes[v].provider, fmt.Sprintf("block %d", n))
+			}
+		}
+	}
+	return blocks, errs, disputed
+}
+
+func (q *QuorumClient) quarantineProvider(name, what string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	log.Printf("quorum: provider %s disagrees with the majority on %s, quarantined for %s", name, what, q.quarantine)
+	q.quarantined[name] = time.Now().Add(q.quarantine)
+}
+
+func blockFingerprint(b *Block) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(b.Hash))
+	sb.WriteString("|")
+	sb.WriteString(strings.ToLower(b.ParentHash))
+	for _, tx := range b.Transactions {
+		sb.WriteString("|")
+		sb.WriteString(strings.ToLower(tx.Hash))
+	}
+	return sb.String()
+}
+
+func (q *QuorumClient) GetLogs(ctx context.Context, filter LogFilter) ([]Log, error) {
+	return quorumCall(ctx, q, "logs", func(c JsonRpcClient) ([]Log, error) {
+		return c.GetLogs(ctx, filter)
+	})
+}
+
+func (q *QuorumClient) GetInternalTransfers(ctx context.Context, n uint64, mode string) ([]InternalTransfer, error) {
+	return quorumCall(ctx, q, fmt.Sprintf("traces of block %d", n), func(c JsonRpcClient) ([]InternalTransfer, error) {
+		return c.GetInternalTransfers(ctx, n, mode)
+	})
+}
+
+func (q *QuorumClient) GetBlockReceipts(ctx context.Context, hash string) ([]Receipt, error) {
+	return quorumCall(ctx, q, "receipts of block "+hash, func(c JsonRpcClient) ([]Receipt, error) {
+		return c.GetBlockReceipts(ctx, hash)
+	})
+}
+
+func (q *QuorumClient) GetTransactionReceipt(ctx context.Context, hash string) (*Receipt, error) {
+	return quorumCall(ctx, q, "receipt "+hash, func(c JsonRpcClient) (*Receipt, error) {
+		return c.GetTransactionReceipt(ctx, hash)
+	})
+}
+
+// GetTransactionReceipts fails when any receipt has no quorum, the caller asks again for all of them
+func (q *QuorumClient) GetTransactionReceipts(ctx context.Context, hashes []string) ([]*Receipt, []error, error) {
+	receipts, err := quorumCall(ctx, q, "receipts", func(c JsonRpcClient) ([]*Receipt, error) {
+		receipts, errs, err := c.GetTransactionReceipts(ctx, hashes)
+		if err != nil {
+			return nil, err
+		}
+		for _, err := range errs {
+			if err != nil {
+				return nil, err
+			}
+		}
+		return receipts, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return receipts, make([]error, len(receipts)), nil
+}
+
+type quorumAnswer[T any] struct {
+	provider string
+	value    T
+	err      error
+}
+
+// quorumCall makes the call on the providers like the blocks, the answer must be the same
+// in quorum providers and the ones that answered something else are quarantined. An error
+// is not a disagreement, without quorum the last error is returned with ErrQuorumNotReached.
+func quorumCall[T any](ctx context.Context, q *QuorumClient, what string, call func(JsonRpcClient) (T, error)) (T, error) {
+	var zero T
+	available := q.available()
+	if len(available) < q.quorum {
+		return zero, fmt.Errorf("%w: only %d providers available", ErrQuorumNotReached, len(available))
+	}
+
+	answers := askAll(ctx, available[:q.quorum], call)
+	value, disputed, err := resolveAnswers(q, what, answers)
+	if disputed && len(available) > q.quorum {
+		answers = append(answers, askAll(ctx, available[q.quorum:], call)...)
+		value, _, err = resolveAnswers(q, what, answers)
+	}
+	return value, err
+}
+
+func askAll[T any](ctx context.Context, providers []Provider, call func(JsonRpcClient) (T, error)) []quorumAnswer[T] {
+	answers := make([]quorumAnswer[T], len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p Provider) {
+			defer wg.Done()
+			v, err := call(p.Client)
+			answers[i] = quorumAnswer[T]{provider: p.Name, value: v, err: err}
+		}(i, p)
+	}
+	wg.Wait()
+	return answers
+}
+
+// resolveAnswers picks the answer with at least quorum votes, disputed says there is none yet
+func resolveAnswers[T any](q *QuorumClient, what string, answers []quorumAnswer[T]) (T, bool, error) {
+	var zero T
+	groups := make(map[string][]int)
+	var order []string
+	var lastErr error
+	for i, a := range answers {
+		if a.err != nil {
+			lastErr = a.err
+			continue
+		}
+		fp, err := answerFingerprint(a.value)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if _, ok := groups[fp]; !ok {
+			order = append(order, fp)
+		}
+		groups[fp] = append(groups[fp], i)
+	}
+
+	best := ""
+	for _, fp := range order {
+		if len(groups[fp]) > len(groups[best]) {
+			best = fp
+		}
+	}
+
+	if len(groups[best]) < q.quorum {
+		if len(order) > 1 {
+			log.Printf("quorum: providers disagree on %s", what)
+			return zero, true, fmt.Errorf("%w: providers disagree on %s", ErrQuorumNotReached, what)
+		}
+		return zero, true, fmt.Errorf("%w: %s: %w", ErrQuorumNotReached, what, lastErr)
+	}
+
+	for _, fp := range order {
+		if fp == best {
+			continue
+		}
+		for _, i := range groups[fp] {
+			q.quarantineProvider(answers[i].provider, what)
+		}
+	}
+	return answers[groups[best][0]].value, false, nil
+}
+
+// answerFingerprint compares the answers by their json, the hex values are in any case
+func answerFingerprint(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(string(b)), nil
+}
@@ -0,0 +1,203 @@
+package jsonrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuorumClient(t *testing.T) {
+	honest := &Block{Hash: "0xa", ParentHash: "0x9", Transactions: []Transaction{{Hash: "0xtx1"}}}
+	// same block with a fake deposit
+	forged := &Block{Hash: "0xa", ParentHash: "0x9", Transactions: []Transaction{{Hash: "0xtx1"}, {Hash: "0xfake"}}}
+
+	newQuorum := func(quorum int, fakes ...*fakeProvider) *QuorumClient {
+		providers := make([]Provider, len(fakes))
+		for i, f := range fakes {
+			providers[i] = Provider{Name: f.name, Client: f}
+		}
+		return NewQuorumClient(&fakeProvider{name: "base"}, providers, quorum, time.Minute)
+	}
+
+	t.Run("quorum_client_agreement", func(t *testing.T) {
+		a := &fakeProvider{name: "a", block: honest}
+		b := &fakeProvider{name: "b", block: honest}
+		c := &fakeProvider{name: "c", block: honest}
+		q := newQuorum(2, a, b, c)
+
+		blk, err := q.GetBlockByNumber(context.Background(), 100)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "0xa", blk.Hash)
+		// only quorum providers are asked when they agree
+		assert.Equal(t, 0, c.calls)
+	})
+
+	t.Run("quorum_client_majority_wins_and_quarantines", func(t *testing.T) {
+		a := &fakeProvider{name: "a", block: forged}
+		b := &fakeProvider{name: "b", block: honest}
+		c := &fakeProvider{name: "c", block: honest}
+		q := newQuorum(2, a, b, c)
+
+		blk, err := q.GetBlockByNumber(context.Background(), 100)
+
+		assert.NoError(t, err)
+		assert.Len(t, blk.Transactions, 1)
+		assert.Equal(t, []string{"a"}, q.Quarantined())
+
+		// the quarantined provider is not asked anymore
+		_, err = q.GetBlockByNumber(context.Background(), 101)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, a.calls)
+	})
+
+	t.Run("quorum_client_no_majority", func(t *testing.T) {
+		a := &fakeProvider{name: "a", block: forged}
+		b := &fakeProvider{name: "b", block: honest}
+		q := newQuorum(2, a, b)
+
+		_, err := q.GetBlockByNumber(context.Background(), 100)
+
+		assert.ErrorIs(t, err, ErrQuorumNotReached)
+		assert.Empty(t, q.Quarantined())
+	})
+
+	t.Run("quorum_client_block_not_everywhere_yet", func(t *testing.T) {
+		a := &fakeProvider{name: "a", block: honest}
+		b := &fakeProvider{name: "b", err: ErrBlockNotFound}
+		q := newQuorum(2, a, b)
+
+		_, err := q.GetBlockByNumber(context.Background(), 100)
+
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+	})
+
+	t.Run("quorum_client_not_enough_providers", func(t *testing.T) {
+		q := newQuorum(3, &fakeProvider{name: "a"}, &fakeProvider{name: "b"})
+
+		_, err := q.GetBlockByNumber(context.Background(), 100)
+
+		assert.ErrorIs(t, err, ErrQuorumNotReached)
+	})
+
+	t.Run("quorum_client_batch", func(t *testing.T) {
+		a := &fakeProvider{name: "a", block: honest}
+		b := &fakeProvider{name: "b", block: honest}
+		q := newQuorum(2, a, b)
+
+		blocks, errs, err := q.GetBlocksByNumber(context.Background(), []uint64{100, 101})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []error{nil, nil}, errs)
+		assert.Len(t, blocks, 2)
+	})
+
+	t.Run("quorum_client_other_methods_use_base", func(t *testing.T) {
+		q := newQuorum(2, &fakeProvider{name: "a", head: 1}, &fakeProvider{name: "b", head: 2})
+		q.JsonRpcClient = &fakeProvider{name: "base", head: 100}
+
+		head, err := q.GetCurrentBlockNumber(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(100), head)
+	})
+}
+
+// dataProvider answers the logs and the receipts calls with its own data
+type dataProvider struct {
+	fakeProvider
+	logs     []Log
+	receipts []*Receipt
+}
+
+func (d *dataProvider) GetLogs(ctx context.Context, filter LogFilter) ([]Log, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls++
+	return d.logs, d.err
+}
+
+func (d *dataProvider) GetBlockReceipts(ctx context.Context, hash string) ([]Receipt, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	receipts := make([]Receipt, len(d.receipts))
+	for i, r := range d.receipts {
+		receipts[i] = *r
+	}
+	return receipts, nil
+}
+
+func (d *dataProvider) GetTransactionReceipts(ctx context.Context, hashes []string) ([]*Receipt, []error, error) {
+	return d.receipts, make([]error, len(d.receipts)), d.err
+}
+
+func TestQuorumClient_Data(t *testing.T) {
+	honestLogs := []Log{{Address: "0xtoken", TransactionHash: "0xtx1", LogIndex: "0x0"}}
+	// a fake token deposit
+	forgedLogs := append([]Log{{Address: "0xtoken", TransactionHash: "0xfake", LogIndex: "0x1"}}, honestLogs...)
+
+	newQuorum := func(quorum int, providers ...*dataProvider) *QuorumClient {
+		list := make([]Provider, len(providers))
+		for i, p := range providers {
+			list[i] = Provider{Name: p.name, Client: p}
+		}
+		return NewQuorumClient(&fakeProvider{name: "base"}, list, quorum, time.Minute)
+	}
+	provider := func(name string) *dataProvider {
+		return &dataProvider{fakeProvider: fakeProvider{name: name}}
+	}
+
+	t.Run("quorum_client_logs_majority_wins", func(t *testing.T) {
+		a, b, c := provider("a"), provider("b"), provider("c")
+		a.logs, b.logs, c.logs = forgedLogs, honestLogs, honestLogs
+		q := newQuorum(2, a, b, c)
+
+		logs, err := q.GetLogs(context.Background(), LogFilter{BlockHash: "0xa"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, honestLogs, logs)
+		assert.Equal(t, []string{"a"}, q.Quarantined())
+	})
+
+	t.Run("quorum_client_logs_no_majority", func(t *testing.T) {
+		a, b := provider("a"), provider("b")
+		a.logs, b.logs = forgedLogs, honestLogs
+		q := newQuorum(2, a, b)
+
+		_, err := q.GetLogs(context.Background(), LogFilter{BlockHash: "0xa"})
+
+		assert.ErrorIs(t, err, ErrQuorumNotReached)
+		assert.Empty(t, q.Quarantined())
+	})
+
+	t.Run("quorum_client_receipts_forged_status", func(t *testing.T) {
+		a, b, c := provider("a"), provider("b"), provider("c")
+		a.receipts = []*Receipt{{TransactionHash: "0xtx1", Status: "0x1"}}
+		b.receipts = []*Receipt{{TransactionHash: "0xtx1", Status: "0x0"}}
+		c.receipts = []*Receipt{{TransactionHash: "0xTX1", Status: "0x0"}}
+		q := newQuorum(2, a, b, c)
+
+		receipts, errs, err := q.GetTransactionReceipts(context.Background(), []string{"0xtx1"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []error{nil}, errs)
+		assert.Equal(t, "0x0", receipts[0].Status)
+		assert.Equal(t, []string{"a"}, q.Quarantined())
+	})
+
+	t.Run("quorum_client_keeps_the_error", func(t *testing.T) {
+		a, b := provider("a"), provider("b")
+		a.err, b.err = ErrMethodNotFound, ErrMethodNotFound
+		q := newQuorum(2, a, b)
+
+		_, err := q.GetBlockReceipts(context.Background(), "0xa")
+
+		// the fetcher falls back to the receipts of the transactions
+		assert.ErrorIs(t, err, ErrMethodNotFound)
+		assert.ErrorIs(t, err, ErrQuorumNotReached)
+		assert.Empty(t, q.Quarantined())
+	})
+}
@@ -0,0 +1,82 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	ReceiptStatusSuccess = "0x1"
+	ReceiptStatusFailed  = "0x0"
+)
+
+// GetBlockReceipts returns all the receipts of the block, by hash so they can't come from another fork
+func (e *Ethereum) GetBlockReceipts(ctx context.Context, blockHash string) ([]Receipt, error) {
+	payload := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_getBlockReceipts","params":[%q],"id":1}`, blockHash)
+	result, err := e.call(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if isNull(result) {
+		return nil, fmt.Errorf("%w: %s", ErrBlockNotFound, blockHash)
+	}
+
+	var receipts []Receipt
+	if err := json.Unmarshal(result, &receipts); err != nil {
+		return nil, fmt.Errorf("%w: unexpected result type for eth_getBlockReceipts: %v", ErrMalformedResponse, err)
+	}
+
+	return receipts, nil
+}
+
+func (e *Ethereum) GetTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	payload := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_getTransactionReceipt","params":[%q],"id":1}`, txHash)
+	result, err := e.call(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// same as the blocks, the node may not have indexed the transaction yet
+	if isNull(result) {
+		return nil, fmt.Errorf("%w: receipt of %s", ErrBlockNotFound, txHash)
+	}
+
+	var receipt Receipt
+	if err := json.Unmarshal(result, &receipt); err != nil {
+		return nil, fmt.Errorf("%w: unexpected result type for eth_getTransactionReceipt: %v", ErrMalformedResponse, err)
+	}
+
+	return &receipt, nil
+}
+
+// Failed says if the transaction reverted, the receipts before byzantium have no status
+// and are taken as successful
+func (r Receipt) Failed() bool {
+	return r.Status == ReceiptStatusFailed
+}
+
+// Fee is gasUsed * effectiveGasPrice in wei as a hex quantity, empty when the node
+// doesn't send the effective price (before london)
+func (r Receipt) Fee() string {
+	gasUsed, ok := parseQuantity(r.GasUsed)
+	if !ok {
+		return ""
+	}
+	price, ok := parseQuantity(r.EffectiveGasPrice)
+	if !ok {
+		return ""
+	}
+	return "0x" + new(big.Int).Mul(gasUsed, price).Text(16)
+}
+
+func parseQuantity(v string) (*big.Int, bool) {
+	s := strings.TrimPrefix(strings.ToLower(v), "0x")
+	if s == "" {
+		return nil, false
+	}
+	return new(big.Int).SetString(s, 16)
+}
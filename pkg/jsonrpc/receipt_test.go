@@ -0,0 +1,89 @@
+package jsonrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEthereum_GetBlockReceipts(t *testing.T) {
+	t.Run("get_block_receipts_success", func(t *testing.T) {
+		client := &recordHTTPClient{response: `{"jsonrpc":"2.0","result":[{"transactionHash":"0xtx1","blockHash":"0xabc","status":"0x1","gasUsed":"0x5208","effectiveGasPrice":"0x3b9aca00","contractAddress":null}],"id":1}`}
+		ethereum := NewEthereum("https://test-rpc.com", client)
+
+		receipts, err := ethereum.GetBlockReceipts(context.Background(), "0xabc")
+
+		assert.NoError(t, err)
+		assert.Len(t, receipts, 1)
+		assert.Equal(t, "0xtx1", receipts[0].TransactionHash)
+		assert.Nil(t, receipts[0].ContractAddress)
+		assert.Contains(t, client.body, `"method":"eth_getBlockReceipts","params":["0xabc"]`)
+	})
+
+	t.Run("get_block_receipts_method_not_found", func(t *testing.T) {
+		client := &recordHTTPClient{response: `{"jsonrpc":"2.0","error":{"code":-32601,"message":"the method eth_getBlockReceipts does not exist/is not available"},"id":1}`}
+		ethereum := NewEthereum("https://test-rpc.com", client)
+
+		_, err := ethereum.GetBlockReceipts(context.Background(), "0xabc")
+
+		assert.ErrorIs(t, err, ErrMethodNotFound)
+	})
+
+	t.Run("get_block_receipts_null", func(t *testing.T) {
+		ethereum := NewEthereum("https://test-rpc.com", &recordHTTPClient{response: `{"jsonrpc":"2.0","result":null,"id":1}`})
+
+		_, err := ethereum.GetBlockReceipts(context.Background(), "0xabc")
+
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+	})
+}
+
+func TestEthereum_GetTransactionReceipt(t *testing.T) {
+	t.Run("get_transaction_receipt_success", func(t *testing.T) {
+		client := &recordHTTPClient{response: `{"jsonrpc":"2.0","result":{"transactionHash":"0xtx1","blockHash":"0xabc","status":"0x0","gasUsed":"0x5208","contractAddress":"0xnew"},"id":1}`}
+		ethereum := NewEthereum("https://test-rpc.com", client)
+
+		receipt, err := ethereum.GetTransactionReceipt(context.Background(), "0xtx1")
+
+		assert.NoError(t, err)
+		assert.True(t, receipt.Failed())
+		assert.Equal(t, "0xnew", *receipt.ContractAddress)
+		assert.Contains(t, client.body, `"method":"eth_getTransactionReceipt","params":["0xtx1"]`)
+	})
+
+	t.Run("get_transaction_receipt_not_found", func(t *testing.T) {
+		ethereum := NewEthereum("https://test-rpc.com", &recordHTTPClient{response: `{"jsonrpc":"2.0","result":null,"id":1}`})
+
+		_, err := ethereum.GetTransactionReceipt(context.Background(), "0xtx1")
+
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+	})
+
+	t.Run("get_transaction_receipt_malformed_result", func(t *testing.T) {
+		ethereum := NewEthereum("https://test-rpc.com", &recordHTTPClient{response: `{"jsonrpc":"2.0","result":"0x1","id":1}`})
+
+		_, err := ethereum.GetTransactionReceipt(context.Background(), "0xtx1")
+
+		assert.ErrorIs(t, err, ErrMalformedResponse)
+	})
+}
+
+func TestReceipt(t *testing.T) {
+	t.Run("receipt_fee", func(t *testing.T) {
+		r := Receipt{GasUsed: "0x5208", EffectiveGasPrice: "0x3b9aca00"}
+		// 21000 * 1 gwei
+		assert.Equal(t, "0x1319718a5000", r.Fee())
+	})
+
+	t.Run("receipt_fee_without_effective_gas_price", func(t *testing.T) {
+		assert.Equal(t, "", Receipt{GasUsed: "0x5208"}.Fee())
+	})
+
+	t.Run("receipt_failed", func(t *testing.T) {
+		assert.True(t, Receipt{Status: ReceiptStatusFailed}.Failed())
+		assert.False(t, Receipt{Status: ReceiptStatusSuccess}.Failed())
+		// before byzantium there is no status
+		assert.False(t, Receipt{}.Failed())
+	})
+}
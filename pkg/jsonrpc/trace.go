@@ -0,0 +1,213 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// debug_traceBlockByNumber with the callTracer (geth, erigon, reth)
+	TraceModeCallTracer = "debug"
+	// trace_block with the parity style traces (erigon, nethermind, reth)
+	TraceModeParity = "parity"
+)
+
+type CallFrame struct {
+	Type    string      `json:"type"`
+	From    string      `json:"from"`
+	To      string      `json:"to"`
+	Value   string      `json:"value"`
+	Gas     string      `json:"gas"`
+	GasUsed string      `json:"gasUsed"`
+	Input   string      `json:"input"`
+	Output  string      `json:"output"`
+	Error   string      `json:"error"`
+	Calls   []CallFrame `json:"calls"`
+}
+
+type TxTrace struct {
+	TxHash string    `json:"txHash"`
+	Result CallFrame `json:"result"`
+	Error  string    `json:"error"`
+}
+
+type ParityTrace struct {
+	Action struct {
+		CallType      string `json:"callType"`
+		From          string `json:"from"`
+		To            string `json:"to"`
+		Value         string `json:"value"`
+		Address       string `json:"address"`
+		RefundAddress string `json:"refundAddress"`
+		Balance       string `json:"balance"`
+	} `json:"action"`
+	Result *struct {
+		Address string `json:"address"`
+	} `json:"result"`
+	Type            string `json:"type"`
+	TraceAddress    []int  `json:"traceAddress"`
+	TransactionHash string `json:"transactionHash"`
+	Error           string `json:"error"`
+}
+
+// InternalTransfer is a value transfer made inside a transaction, the path is the position
+// of the call in the call tree, "0.1" is the second call of the first call of the transaction.
+// Some nodes leave the tx hash out of the debug traces, then TxIndex and TxFrom are the position
+// and the sender of the transaction so the caller can pair it with the block transactions
+type InternalTransfer struct {
+	TxHash  string
+	TxIndex int
+	TxFrom  string
+	Type    string
+	From    string
+	To      string
+	Value   string
+	Path    string
+}
+
+// GetInternalTransfers traces the block and returns the internal calls that moved value
+func (e *Ethereum) GetInternalTransfers(ctx context.Context, blockNumber uint64, mode string) ([]InternalTransfer, error) {
+	switch mode {
+	case TraceModeCallTracer:
+		payload := fmt.Sprintf(`{"jsonrpc":"2.0","method":"debug_traceBlockByNumber","params":["0x%x",{"tracer":"callTracer"}],"id":1}`, blockNumber)
+		result, err := e.call(ctx, payload)
+		if err != nil {
+			return nil, err
+		}
+		var traces []TxTrace
+		if err := json.Unmarshal(result, &traces); err != nil {
+			return nil, fmt.Errorf("%w: unexpected result type for debug_traceBlockByNumber: %v", ErrMalformedResponse, err)
+		}
+		return FlattenCallFrames(traces), nil
+	case TraceModeParity:
+		payload := fmt.Sprintf(`{"jsonrpc":"2.0","method":"trace_block","params":["0x%x"],"id":1}`, blockNumber)
+		result, err := e.call(ctx, payload)
+		if err != nil {
+			return nil, err
+		}
+		if isNull(result) {
+			return nil, fmt.Errorf("%w: 0x%x", ErrBlockNotFound, blockNumber)
+		}
+		var traces []ParityTrace
+		if err := json.Unmarshal(result, &traces); err != nil {
+			return nil, fmt.Errorf("%w: unexpected result type for trace_block: %v", ErrMalformedResponse, err)
+		}
+		return FlattenParityTraces(traces), nil
+	}
+	return nil, fmt.Errorf("jsonrpc: unknown trace mode %q", mode)
+}
+
+// FlattenCallFrames walks the call trees skipping the top level call (it is the transaction itself),
+// the calls without value and the reverted subtrees
+func FlattenCallFrames(traces []TxTrace) []InternalTransfer {
+	var transfers []InternalTransfer
+	for ti, tr := range traces {
+		if tr.Error != "" || tr.Result.Error != "" {
+			continue
+		}
+		tx := InternalTransfer{TxHash: tr.TxHash}
+		if tr.TxHash == "" {
+			tx.TxIndex = ti
+			tx.TxFrom = tr.Result.From
+		}
+		for i, c := range tr.Result.Calls {
+			transfers = walkCallFrame(transfers, tx, c, strconv.Itoa(i))
+		}
+	}
+	return transfers
+}
+
+func walkCallFrame(transfers []InternalTransfer, tx InternalTransfer, c CallFrame, path string) []InternalTransfer {
+	if c.Error != "" {
+		return transfers
+	}
+	if movesValue(c.Type) && !isZeroQuantity(c.Value) {
+		transfers = append(transfers, InternalTransfer{
+			TxHash:  tx.TxHash,
+			TxIndex: tx.TxIndex,
+			TxFrom:  tx.TxFrom,
+			Type:    strings.ToUpper(c.Type),
+			From:    c.From,
+			To:      c.To,
+			Value:   c.Value,
+			Path:    path,
+		})
+	}
+	for i, child := range c.Calls {
+		transfers = walkCallFrame(transfers, tx, child, path+"."+strconv.Itoa(i))
+	}
+	return transfers
+}
+
+// FlattenParityTraces does the same for the flat parity traces, the failed calls
+// revert everything below them so we keep their addresses to skip the children
+func FlattenParityTraces(traces []ParityTrace) []InternalTransfer {
+	var transfers []InternalTransfer
+	failed := make(map[string][]string)
+	for _, tr := range traces {
+		path := tracePath(tr.TraceAddress)
+		if tr.Error != "" {
+			failed[tr.TransactionHash] = append(failed[tr.TransactionHash], path)
+			continue
+		}
+		if len(tr.TraceAddress) == 0 || underFailed(failed[tr.TransactionHash], path) {
+			continue
+		}
+
+		it := InternalTransfer{TxHash: tr.TransactionHash, Path: path}
+		switch tr.Type {
+		case "call":
+			if !movesValue(tr.Action.CallType) {
+				continue
+			}
+			it.Type, it.From, it.To, it.Value = "CALL", tr.Action.From, tr.Action.To, tr.Action.Value
+		case "create":
+			it.Type, it.From, it.Value = "CREATE", tr.Action.From, tr.Action.Value
+			if tr.Result != nil {
+				it.To = tr.Result.Address
+			}
+		case "suicide":
+			it.Type, it.From, it.To, it.Value = "SELFDESTRUCT", tr.Action.Address, tr.Action.RefundAddress, tr.Action.Balance
+		default:
+			continue
+		}
+		if isZeroQuantity(it.Value) {
+			continue
+		}
+		transfers = append(transfers, it)
+	}
+	return transfers
+}
+
+// delegatecall and staticcall don't move value, callcode sends it to the caller itself
+func movesValue(callType string) bool {
+	switch strings.ToUpper(callType) {
+	case "CALL", "CREATE", "CREATE2", "SELFDESTRUCT":
+		return true
+	}
+	return false
+}
+
+func isZeroQuantity(v string) bool {
+	return strings.TrimLeft(strings.TrimPrefix(strings.ToLower(v), "0x"), "0") == ""
+}
+
+func tracePath(addr []int) string {
+	parts := make([]string, len(addr))
+	for i, a := range addr {
+		parts[i] = strconv.Itoa(a)
+	}
+	return strings.Join(parts, ".")
+}
+
+func underFailed(failed []string, path string) bool {
+	for _, f := range failed {
+		if f == "" || path == f || strings.HasPrefix(path, f+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package jsonrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlattenCallFrames(t *testing.T) {
+	t.Run("flatten_call_frames_nested_value_calls", func(t *testing.T) {
+		traces := []TxTrace{{
+			TxHash: "0xtx1",
+			Result: CallFrame{Type: "CALL", From: "0xeoa", To: "0xmultisig", Value: "0x0", Calls: []CallFrame{
+				{Type: "STATICCALL", From: "0xmultisig", To: "0xoracle"},
+				{Type: "DELEGATECALL", From: "0xmultisig", To: "0xlib", Value: "0x5", Calls: []CallFrame{
+					{Type: "CALL", From: "0xmultisig", To: "0xuser", Value: "0xde0b6b3a7640000"},
+				}},
+			}},
+		}}
+
+		transfers := FlattenCallFrames(traces)
+
+		assert.Equal(t, []InternalTransfer{{TxHash: "0xtx1", Type: "CALL", From: "0xmultisig", To: "0xuser", Value: "0xde0b6b3a7640000", Path: "1.0"}}, transfers)
+	})
+
+	t.Run("flatten_call_frames_skips_top_level_and_zero_value", func(t *testing.T) {
+		traces := []TxTrace{{
+			TxHash: "0xtx1",
+			Result: CallFrame{Type: "CALL", From: "0xeoa", To: "0xuser", Value: "0x10", Calls: []CallFrame{
+				{Type: "CALL", From: "0xuser", To: "0xother", Value: "0x0"},
+			}},
+		}}
+
+		assert.Empty(t, FlattenCallFrames(traces))
+	})
+
+	t.Run("flatten_call_frames_skips_reverted", func(t *testing.T) {
+		traces := []TxTrace{
+			{TxHash: "0xtx1", Result: CallFrame{Type: "CALL", Error: "execution reverted", Calls: []CallFrame{
+				{Type: "CALL", From: "0xa", To: "0xb", Value: "0x1"},
+			}}},
+			{TxHash: "0xtx2", Result: CallFrame{Type: "CALL", Calls: []CallFrame{
+				{Type: "CALL", From: "0xa", To: "0xb", Value: "0x1", Error: "out of gas", Calls: []CallFrame{
+					{Type: "CALL", From: "0xb", To: "0xc", Value: "0x1"},
+				}},
+				{Type: "CREATE2", From: "0xa", To: "0xnew", Value: "0x2"},
+			}}},
+		}
+
+		transfers := FlattenCallFrames(traces)
+
+		assert.Len(t, transfers, 1)
+		assert.Equal(t, "CREATE2", transfers[0].Type)
+		assert.Equal(t, "1", transfers[0].Path)
+	})
+
+	t.Run("flatten_call_frames_without_tx_hash", func(t *testing.T) {
+		traces := []TxTrace{
+			{Result: CallFrame{Type: "CALL", From: "0xeoa1", To: "0xb"}},
+			{Result: CallFrame{Type: "CALL", From: "0xeoa2", To: "0xb", Calls: []CallFrame{
+				{Type: "CALL", From: "0xb", To: "0xc", Value: "0x1"},
+			}}},
+		}
+
+		transfers := FlattenCallFrames(traces)
+
+		assert.Equal(t, []InternalTransfer{{TxIndex: 1, TxFrom: "0xeoa2", Type: "CALL", From: "0xb", To: "0xc", Value: "0x1", Path: "0"}}, transfers)
+	})
+}
+
+func TestFlattenParityTraces(t *testing.T) {
+	trace := func(tx, typ string, addr []int, errMsg string) ParityTrace {
+		var tr ParityTrace
+		tr.TransactionHash, tr.Type, tr.TraceAddress, tr.Error = tx, typ, addr, errMsg
+		tr.Action.CallType, tr.Action.From, tr.Action.To, tr.Action.Value = "call", "0xa", "0xb", "0x1"
+		return tr
+	}
+
+	t.Run("flatten_parity_traces_success", func(t *testing.T) {
+		selfdestruct := trace("0xtx1", "suicide", []int{1}, "")
+		selfdestruct.Action.Address, selfdestruct.Action.RefundAddress, selfdestruct.Action.Balance = "0xc", "0xd", "0x2"
+
+		transfers := FlattenParityTraces([]ParityTrace{
+			trace("0xtx1", "call", []int{}, ""),
+			trace("0xtx1", "call", []int{0}, ""),
+			selfdestruct,
+		})
+
+		assert.Equal(t, []InternalTransfer{
+			{TxHash: "0xtx1", Type: "CALL", From: "0xa", To: "0xb", Value: "0x1", Path: "0"},
+			{TxHash: "0xtx1", Type: "SELFDESTRUCT", From: "0xc", To: "0xd", Value: "0x2", Path: "1"},
+		}, transfers)
+	})
+
+	t.Run("flatten_parity_traces_skips_failed_subtrees", func(t *testing.T) {
+		delegate := trace("0xtx2", "call", []int{1}, "")
+		delegate.Action.CallType = "delegatecall"
+
+		transfers := FlattenParityTraces([]ParityTrace{
+			trace("0xtx1", "call", []int{}, "Reverted"),
+			trace("0xtx1", "call", []int{0}, ""),
+			trace("0xtx2", "call", []int{}, ""),
+			trace("0xtx2", "call", []int{0}, "Reverted"),
+			trace("0xtx2", "call", []int{0, 0}, ""),
+			delegate,
+			trace("0xtx2", "call", []int{10}, ""),
+		})
+
+		assert.Len(t, transfers, 1)
+		assert.Equal(t, "10", transfers[0].Path)
+	})
+}
+
+func TestEthereum_GetInternalTransfers(t *testing.T) {
+	t.Run("get_internal_transfers_call_tracer", func(t *testing.T) {
+		client := &recordHTTPClient{response: `{"jsonrpc":"2.0","result":[{"txHash":"0xtx1","result":{"type":"CALL","from":"0xeoa","to":"0xmultisig","value":"0x0","calls":[{"type":"CALL","from":"0xmultisig","to":"0xuser","value":"0x1"}]}}],"id":1}`}
+		ethereum := NewEthereum("https://test-rpc.com", client)
+
+		transfers, err := ethereum.GetInternalTransfers(context.Background(), 100, TraceModeCallTracer)
+
+		assert.NoError(t, err)
+		assert.Len(t, transfers, 1)
+		assert.Equal(t, "0xuser", transfers[0].To)
+		assert.Contains(t, client.body, `"method":"debug_traceBlockByNumber"`)
+		assert.Contains(t, client.body, `"0x64",{"tracer":"callTracer"}`)
+	})
+
+	t.Run("get_internal_transfers_parity", func(t *testing.T) {
+		client := &recordHTTPClient{response: `{"jsonrpc":"2.0","result":[{"action":{"callType":"call","from":"0xmultisig","to":"0xuser","value":"0x1"},"type":"call","traceAddress":[0],"transactionHash":"0xtx1"}],"id":1}`}
+		ethereum := NewEthereum("https://test-rpc.com", client)
+
+		transfers, err := ethereum.GetInternalTransfers(context.Background(), 100, TraceModeParity)
+
+		assert.NoError(t, err)
+		assert.Len(t, transfers, 1)
+		assert.Contains(t, client.body, `"method":"trace_block"`)
+	})
+
+	t.Run("get_internal_transfers_parity_block_not_found", func(t *testing.T) {
+		ethereum := NewEthereum("https://test-rpc.com", &recordHTTPClient{response: `{"jsonrpc":"2.0","result":null,"id":1}`})
+
+		_, err := ethereum.GetInternalTransfers(context.Background(), 100, TraceModeParity)
+
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+	})
+
+	t.Run("get_internal_transfers_malformed_result", func(t *testing.T) {
+		ethereum := NewEthereum("https://test-rpc.com", &recordHTTPClient{response: `{"jsonrpc":"2.0","result":"0x1","id":1}`})
+
+		_, err := ethereum.GetInternalTransfers(context.Background(), 100, TraceModeCallTracer)
+
+		assert.ErrorIs(t, err, ErrMalformedResponse)
+	})
+
+	t.Run("get_internal_transfers_unknown_mode", func(t *testing.T) {
+		ethereum := NewEthereum("https://test-rpc.com", &recordHTTPClient{})
+
+		_, err := ethereum.GetInternalTransfers(context.Background(), 100, "other")
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,138 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jmsilvadev/de-crypto/pkg/utils"
+)
+
+// HeadSubscriber pushes the number of every new head, Connected says if the pushes are
+// arriving so the caller knows when it has to poll instead
+type HeadSubscriber interface {
+	SubscribeNewHeads(ctx context.Context, heads chan<- uint64)
+	Connected() bool
+}
+
+type WSClient struct {
+	url    string
+	dialer *websocket.Dialer
+	// the reconnect delay doubles on every failed attempt until the max
+	reconnectDelay    time.Duration
+	maxReconnectDelay time.Duration
+	connected         atomic.Bool
+}
+
+var _ HeadSubscriber = &WSClient{}
+
+func NewWSClient(url string, reconnectDelay, maxReconnectDelay time.Duration) *WSClient {
+	return &WSClient{
+		url:               url,
+		dialer:            websocket.DefaultDialer,
+		reconnectDelay:    reconnectDelay,
+		maxReconnectDelay: maxReconnectDelay,
+	}
+}
+
+func (w *WSClient) Connected() bool {
+	return w.connected.Load()
+}
+
+// SubscribeNewHeads subscribes to newHeads and sends the head numbers until the context is done,
+// when the socket drops it reconnects and subscribes again
+func (w *WSClient) SubscribeNewHeads(ctx context.Context, heads chan<- uint64) {
+	delay := w.reconnectDelay
+	for {
+		err := w.subscribe(ctx, heads, func() { delay = w.reconnectDelay })
+		w.connected.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("ws: newHeads subscription dropped, reconnecting in %s: %v", delay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > w.maxReconnectDelay {
+			delay = w.maxReconnectDelay
+		}
+	}
+}
+
+// subscribe runs one connection, onSubscribed is called when the subscription is confirmed
+func (w *WSClient) subscribe(ctx context.Context, heads chan<- uint64, onSubscribed func()) error {
+	conn, _, err := w.dialer.DialContext(ctx, w.url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// unblocks the read when the context is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	err = conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","method":"eth_subscribe","params":["newHeads"],"id":1}`))
+	if err != nil {
+		return err
+	}
+
+	var resp rpcResp
+	if err := conn.ReadJSON(&resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	var subID string
+	if err := json.Unmarshal(resp.Result, &subID); err != nil {
+		return fmt.Errorf("%w: unexpected result type for eth_subscribe: %v", ErrMalformedResponse, err)
+	}
+
+	w.connected.Store(true)
+	onSubscribed()
+
+	for {
+		var msg struct {
+			Method string `json:"method"`
+			Params struct {
+				Subscription string `json:"subscription"`
+				Result       struct {
+					Number string `json:"number"`
+				} `json:"result"`
+			} `json:"params"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+		if msg.Method != "eth_subscription" || msg.Params.Subscription != subID {
+			continue
+		}
+
+		n, err := utils.ParseHexUint64(msg.Params.Result.Number)
+		if err != nil {
+			log.Printf("ws: invalid head number %q", msg.Params.Result.Number)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case heads <- n:
+		}
+	}
+}
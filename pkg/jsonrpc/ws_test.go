@@ -0,0 +1,147 @@
+package jsonrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeWSNode answers eth_subscribe and pushes the heads, every connection gets the next
+// list of heads and is closed after sending them
+type fakeWSNode struct {
+	heads         [][]string
+	subscribeErr  bool
+	conns         atomic.Int32
+	subscriptions atomic.Int32
+}
+
+func (f *fakeWSNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	i := int(f.conns.Add(1)) - 1
+
+	var req struct {
+		Method string `json:"method"`
+		Params []any  `json:"params"`
+	}
+	if err := conn.ReadJSON(&req); err != nil || req.Method != "eth_subscribe" || req.Params[0] != "newHeads" {
+		return
+	}
+	if f.subscribeErr {
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"notifications not supported"}}`))
+		return
+	}
+	f.subscriptions.Add(1)
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"result":"0xsub"}`))
+
+	if i >= len(f.heads) {
+		// keeps the connection open until the client goes away
+		conn.ReadMessage()
+		return
+	}
+	// a notification from another subscription must be ignored
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0xother","result":{"number":"0x1"}}}`))
+	for _, n := range f.heads[i] {
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0xsub","result":{"number":"`+n+`","hash":"0xabc"}}}`))
+	}
+}
+
+func wsURL(s *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func receiveHeads(t *testing.T, heads <-chan uint64, n int) []uint64 {
+	var got []uint64
+	for len(got) < n {
+		select {
+		case h := <-heads:
+			got = append(got, h)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected %d heads, got %v", n, got)
+		}
+	}
+	return got
+}
+
+func TestWSClient_SubscribeNewHeads(t *testing.T) {
+	t.Run("subscribe_new_heads_pushes_heads", func(t *testing.T) {
+		node := &fakeWSNode{heads: [][]string{{"0x64", "0x65"}}}
+		server := httptest.NewServer(node)
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		heads := make(chan uint64, 10)
+		client := NewWSClient(wsURL(server), 10*time.Millisecond, 50*time.Millisecond)
+
+		go client.SubscribeNewHeads(ctx, heads)
+
+		assert.Equal(t, []uint64{100, 101}, receiveHeads(t, heads, 2))
+	})
+
+	t.Run("subscribe_new_heads_reconnects_and_resubscribes", func(t *testing.T) {
+		node := &fakeWSNode{heads: [][]string{{"0x64"}, {"0x65"}}}
+		server := httptest.NewServer(node)
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		heads := make(chan uint64, 10)
+		client := NewWSClient(wsURL(server), 10*time.Millisecond, 50*time.Millisecond)
+
+		go client.SubscribeNewHeads(ctx, heads)
+
+		assert.Equal(t, []uint64{100, 101}, receiveHeads(t, heads, 2))
+		assert.Eventually(t, client.Connected, time.Second, 10*time.Millisecond)
+		assert.GreaterOrEqual(t, node.subscriptions.Load(), int32(3))
+	})
+
+	t.Run("subscribe_new_heads_not_connected_on_subscribe_error", func(t *testing.T) {
+		node := &fakeWSNode{subscribeErr: true}
+		server := httptest.NewServer(node)
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client := NewWSClient(wsURL(server), 10*time.Millisecond, 20*time.Millisecond)
+
+		go client.SubscribeNewHeads(ctx, make(chan uint64))
+
+		assert.Eventually(t, func() bool { return node.conns.Load() >= 2 }, time.Second, 10*time.Millisecond)
+		assert.False(t, client.Connected())
+	})
+
+	t.Run("subscribe_new_heads_stops_with_context", func(t *testing.T) {
+		node := &fakeWSNode{}
+		server := httptest.NewServer(node)
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		client := NewWSClient(wsURL(server), 10*time.Millisecond, 50*time.Millisecond)
+		done := make(chan struct{})
+
+		go func() {
+			client.SubscribeNewHeads(ctx, make(chan uint64))
+			close(done)
+		}()
+
+		assert.Eventually(t, client.Connected, time.Second, 10*time.Millisecond)
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("expected the subscription to stop")
+		}
+		assert.False(t, client.Connected())
+	})
+}
@@ -3,89 +3,268 @@ package kafka
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
-	"time"
+	"sort"
+	"sync"
 
 	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/sink"
 	k "github.com/segmentio/kafka-go"
 )
 
+var errNotAsync = errors.New("kafka: the publisher is not in async mode")
+
+// messageWriter is the part of the kafka writer we use
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...k.Message) error
+	Close() error
+}
+
 type Publisher struct {
-	ctx context.Context
-	w   *k.Writer
+	ctx       context.Context
+	w         messageWriter
+	transport *k.Transport
+	brokers   []string
+	topic     string
+
+	async bool
+	// the async messages published since the last flush, the sessions have their own
+	pending deliveries
 }
 
-func NewPublisher(ctx context.Context, brokers []string, topic string) (*Publisher, error) {
-	log.Printf("registering new publisher Topic: %s", topic)
-	if len(brokers) == 0 || topic == "" {
+// deliveries are the async messages of one publisher or session waiting for a flush
+type deliveries struct {
+	mu   sync.Mutex
+	list []*delivery
+}
+
+// delivery follows an async message until the brokers answer, done is closed then
+type delivery struct {
+	msg      sink.Message
+	err      error
+	done     chan struct{}
+	callback func(sink.Message, error)
+}
+
+var _ sink.Sink = &Publisher{}
+
+func NewPublisher(ctx context.Context, cfg config.KafkaConfig) (*Publisher, error) {
+	log.Printf("registering new publisher Topic: %s", cfg.Topic)
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
 		return nil, errors.New("kafka: missing brokers or topic")
 	}
 
-	if err := ensureTopicExists(ctx, brokers, topic); err != nil {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := compression(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ensureTopicExists(ctx, transport, cfg); err != nil {
 		return nil, err
 	}
 
 	w := &k.Writer{
-		Addr:         k.TCP(brokers...),
-		Topic:        topic,
+		Addr:         k.TCP(cfg.Brokers...),
+		Topic:        cfg.Topic,
+		Transport:    transport,
 		Balancer:     &k.Hash{},
 		RequiredAcks: k.RequireAll,
 		BatchSize:    config.DefaultBatchSize,
 		BatchTimeout: config.DefaultFlushInterval,
 		WriteTimeout: config.DefaultRequestTimeout,
+		Compression:  codec,
 	}
-	return &Publisher{ctx: ctx, w: w}, nil
+	p := &Publisher{ctx: ctx, w: w, transport: transport, brokers: cfg.Brokers, topic: cfg.Topic, async: cfg.Async}
+	if p.async {
+		w.Async = true
+		w.Completion = p.complete
+	}
+	return p, nil
 }
 
 func (p *Publisher) Publish(b []byte) error {
-	return p.w.WriteMessages(p.ctx, k.Message{Value: b})
+	return sink.Publish(p.ctx, p, sink.Message{Value: b})
 }
 
-func (p *Publisher) Close() error {
-	return p.w.Close()
+// PublishBatch writes the whole batch in one call. In sync mode the writer only returns
+// when the brokers acked it, so Flush has nothing to do. In async mode it returns once the
+// messages are queued and Flush has the results.
+func (p *Publisher) PublishBatch(ctx context.Context, msgs []sink.Message) error {
+	if p.async {
+		return p.PublishAsync(ctx, msgs, nil)
+	}
+
+	batch := make([]k.Message, len(msgs))
+	for i, m := range msgs {
+		batch[i] = kafkaMessage(m)
+	}
+	err := p.w.WriteMessages(ctx, batch...)
+	var writeErrs k.WriteErrors
+	if errors.As(err, &writeErrs) {
+		return sink.BatchError(writeErrs)
+	}
+	return err
 }
 
-func ensureTopicExists(ctx context.Context, brokers []string, topic string) error {
-	conn, err := k.DialLeader(ctx, "tcp", brokers[0], topic, 0)
-	if err != nil {
-		maxRetries := 3
-		for attempt := 1; attempt <= maxRetries; attempt++ {
-			admin := k.Client{
-				Addr: k.TCP(brokers...),
-			}
-
-			_, createErr := admin.CreateTopics(ctx, &k.CreateTopicsRequest{
-				Topics: []k.TopicConfig{
-					{
-						Topic:             topic,
-						NumPartitions:     1,
-						ReplicationFactor: 1,
-					},
-				},
-			})
-
-			if createErr != nil {
-				log.Printf("Attempt %d: Failed to create topic %s: %v", attempt, topic, createErr)
-				if attempt == maxRetries {
-					return createErr
-				}
-				time.Sleep(time.Duration(attempt) * time.Second)
-				continue
-			}
-
-			log.Printf("Successfully created topic: %s", topic)
-			break
+// PublishAsync queues the messages and returns, done is called for every message when the
+// brokers acked it or it failed. The messages are also reported on the next Flush.
+func (p *Publisher) PublishAsync(ctx context.Context, msgs []sink.Message, done func(sink.Message, error)) error {
+	return p.publishAsync(ctx, msgs, done, &p.pending)
+}
+
+func (p *Publisher) publishAsync(ctx context.Context, msgs []sink.Message, done func(sink.Message, error), pending *deliveries) error {
+	if !p.async {
+		return errNotAsync
+	}
+
+	batch := make([]k.Message, len(msgs))
+	published := make([]*delivery, len(msgs))
+	for i, m := range msgs {
+		published[i] = &delivery{msg: m, done: make(chan struct{}), callback: done}
+		batch[i] = kafkaMessage(m)
+		batch[i].WriterData = published[i]
+	}
+	// the writer checks all the messages before it queues them, on error none was sent
+	if err := p.w.WriteMessages(ctx, batch...); err != nil {
+		return err
+	}
+
+	pending.mu.Lock()
+	pending.list = append(pending.list, published...)
+	pending.mu.Unlock()
+	return nil
+}
+
+// complete is called by the writer with every batch it wrote, the error is the same for
+// all the messages of the batch
+func (p *Publisher) complete(msgs []k.Message, err error) {
+	for _, m := range msgs {
+		d, ok := m.WriterData.(*delivery)
+		if !ok {
+			continue
 		}
+		d.err = err
+		if d.callback != nil {
+			d.callback(d.msg, err)
+		}
+		close(d.done)
+	}
+}
+
+// kafkaMessage keeps the key, so the hash balancer sends the messages with the same key
+// to the same partition and they keep their order
+func kafkaMessage(m sink.Message) k.Message {
+	msg := k.Message{Key: m.Key, Value: m.Value}
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		msg.Headers = append(msg.Headers, k.Header{Key: name, Value: []byte(m.Headers[name])})
+	}
+	return msg
+}
+
+// Flush waits for the async messages published since the last flush, in sync mode they
+// were acked already
+func (p *Publisher) Flush(ctx context.Context) error {
+	return p.pending.wait(ctx)
+}
 
-		time.Sleep(2 * time.Second)
+// wait takes the deliveries and waits for all of them
+func (d *deliveries) wait(ctx context.Context) error {
+	d.mu.Lock()
+	pending := d.list
+	d.list = nil
+	d.mu.Unlock()
 
-		conn, err = k.DialLeader(ctx, "tcp", brokers[0], topic, 0)
-		if err != nil {
-			log.Printf("Failed to connect to topic %s after creation: %v", topic, err)
-			return err
+	errs := make(sink.BatchError, len(pending))
+	failed := false
+	for i, d := range pending {
+		select {
+		case <-ctx.Done():
+			// we don't know about the rest, they are sent again
+			return ctx.Err()
+		case <-d.done:
 		}
+		errs[i] = d.err
+		failed = failed || d.err != nil
 	}
+	if failed {
+		return errs
+	}
+	return nil
+}
+
+// Health checks that some broker answers with the partitions of the topic
+func (p *Publisher) Health(ctx context.Context) error {
+	var err error
+	for _, b := range p.brokers {
+		client := &k.Client{Addr: k.TCP(b), Transport: p.transport, Timeout: config.DefaultRequestTimeout}
+		if _, err = describeTopic(ctx, client, p.topic); err == nil {
+			return nil
+		}
+	}
+	return err
+}
 
-	conn.Close()
+func (p *Publisher) Close() error {
+	err := p.w.Close()
+	p.transport.CloseIdleConnections()
+	return err
+}
+
+// Session returns a sink that writes with this publisher but only flushes its own messages.
+// The sink processor and the dlq redelivery publish and flush at the same time, with one
+// pending list the flush of one could take the results of the other.
+func (p *Publisher) Session() sink.Sink {
+	return &session{p: p}
+}
+
+type session struct {
+	p       *Publisher
+	pending deliveries
+}
+
+func (s *session) PublishBatch(ctx context.Context, msgs []sink.Message) error {
+	if s.p.async {
+		return s.p.publishAsync(ctx, msgs, nil, &s.pending)
+	}
+	return s.p.PublishBatch(ctx, msgs)
+}
+
+func (s *session) Flush(ctx context.Context) error {
+	return s.pending.wait(ctx)
+}
+
+func (s *session) Health(ctx context.Context) error {
+	return s.p.Health(ctx)
+}
+
+// the publisher is closed by its owner
+func (s *session) Close() error {
 	return nil
 }
+
+func compression(name string) (k.Compression, error) {
+	switch name {
+	case "", config.CompressionNone:
+		return 0, nil
+	case config.CompressionGzip:
+		return k.Gzip, nil
+	case config.CompressionSnappy:
+		return k.Snappy, nil
+	case config.CompressionLz4:
+		return k.Lz4, nil
+	case config.CompressionZstd:
+		return k.Zstd, nil
+	}
+	return 0, fmt.Errorf("kafka: unknown compression %q", name)
+}
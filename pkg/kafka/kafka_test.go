@@ -2,8 +2,14 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/sink"
+	k "github.com/segmentio/kafka-go"
 )
 
 func TestEnsureTopicExists(t *testing.T) {
@@ -11,12 +17,13 @@ func TestEnsureTopicExists(t *testing.T) {
 	defer cancel()
 	brokers := []string{"localhost:9092"}
 	topic := "test-topic-creation"
-	err := ensureTopicExists(ctx, brokers, topic)
+	cfg := config.KafkaConfig{Brokers: brokers, Topic: topic, Partitions: 1, ReplicationFactor: 1}
+	err := ensureTopicExists(ctx, &k.Transport{}, cfg)
 	if err != nil {
 		t.Logf("Topic creation test skipped (Kafka not available): %v", err)
 		t.Skip("Kafka not available for testing")
 	}
-	err = ensureTopicExists(ctx, brokers, topic)
+	err = ensureTopicExists(ctx, &k.Transport{}, cfg)
 	if err != nil {
 		t.Errorf("Topic should exist after creation: %v", err)
 	}
@@ -27,7 +34,7 @@ func TestNewPublisher_WithTopicCreation(t *testing.T) {
 	defer cancel()
 	brokers := []string{"localhost:9092"}
 	topic := "test-publisher-topic"
-	publisher, err := NewPublisher(ctx, brokers, topic)
+	publisher, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 	if err != nil {
 		t.Logf("Publisher creation test skipped (Kafka not available): %v", err)
 		t.Skip("Kafka not available for testing")
@@ -46,7 +53,7 @@ func TestPublisher_Publish(t *testing.T) {
 		defer cancel()
 		brokers := []string{"localhost:9092"}
 		topic := "test-publish-topic"
-		publisher, err := NewPublisher(ctx, brokers, topic)
+		publisher, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 		if err != nil {
 			t.Logf("Publisher creation test skipped (Kafka not available): %v", err)
 			t.Skip("Kafka not available for testing")
@@ -63,7 +70,7 @@ func TestPublisher_Publish(t *testing.T) {
 		defer cancel()
 		brokers := []string{"localhost:9092"}
 		topic := "test-publish-empty-topic"
-		publisher, err := NewPublisher(ctx, brokers, topic)
+		publisher, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 		if err != nil {
 			t.Logf("Publisher creation test skipped (Kafka not available): %v", err)
 			t.Skip("Kafka not available for testing")
@@ -80,7 +87,7 @@ func TestPublisher_Publish(t *testing.T) {
 		defer cancel()
 		brokers := []string{"localhost:9092"}
 		topic := "test-publish-large-topic"
-		publisher, err := NewPublisher(ctx, brokers, topic)
+		publisher, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 		if err != nil {
 			t.Logf("Publisher creation test skipped (Kafka not available): %v", err)
 			t.Skip("Kafka not available for testing")
@@ -100,7 +107,7 @@ func TestPublisher_Publish(t *testing.T) {
 		defer cancel()
 		brokers := []string{"localhost:9092"}
 		topic := "test-publish-multiple-topic"
-		publisher, err := NewPublisher(ctx, brokers, topic)
+		publisher, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 		if err != nil {
 			t.Logf("Publisher creation test skipped (Kafka not available): %v", err)
 			t.Skip("Kafka not available for testing")
@@ -126,7 +133,7 @@ func TestPublisher_Close(t *testing.T) {
 		defer cancel()
 		brokers := []string{"localhost:9092"}
 		topic := "test-close-topic"
-		publisher, err := NewPublisher(ctx, brokers, topic)
+		publisher, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 		if err != nil {
 			t.Logf("Publisher creation test skipped (Kafka not available): %v", err)
 			t.Skip("Kafka not available for testing")
@@ -141,7 +148,7 @@ func TestPublisher_Close(t *testing.T) {
 		defer cancel()
 		brokers := []string{"localhost:9092"}
 		topic := "test-close-multiple-topic"
-		publisher, err := NewPublisher(ctx, brokers, topic)
+		publisher, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 		if err != nil {
 			t.Logf("Publisher creation test skipped (Kafka not available): %v", err)
 			t.Skip("Kafka not available for testing")
@@ -160,7 +167,7 @@ func TestPublisher_Close(t *testing.T) {
 		defer cancel()
 		brokers := []string{"localhost:9092"}
 		topic := "test-publish-after-close-topic"
-		publisher, err := NewPublisher(ctx, brokers, topic)
+		publisher, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 		if err != nil {
 			t.Logf("Publisher creation test skipped (Kafka not available): %v", err)
 			t.Skip("Kafka not available for testing")
@@ -183,7 +190,7 @@ func TestNewPublisher_ErrorCases(t *testing.T) {
 		defer cancel()
 		brokers := []string{}
 		topic := "test-topic"
-		_, err := NewPublisher(ctx, brokers, topic)
+		_, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 		if err == nil {
 			t.Error("Expected error for empty brokers, but got none")
 		}
@@ -193,7 +200,7 @@ func TestNewPublisher_ErrorCases(t *testing.T) {
 		defer cancel()
 		brokers := []string{"localhost:9092"}
 		topic := ""
-		_, err := NewPublisher(ctx, brokers, topic)
+		_, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 		if err == nil {
 			t.Error("Expected error for empty topic, but got none")
 		}
@@ -203,7 +210,7 @@ func TestNewPublisher_ErrorCases(t *testing.T) {
 		defer cancel()
 		var brokers []string
 		topic := "test-topic"
-		_, err := NewPublisher(ctx, brokers, topic)
+		_, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 		if err == nil {
 			t.Error("Expected error for nil brokers, but got none")
 		}
@@ -216,7 +223,7 @@ func TestPublisher_Methods_UnitTests(t *testing.T) {
 		defer cancel()
 		brokers := []string{"invalid-broker:9092"}
 		topic := "test-topic"
-		publisher, err := NewPublisher(ctx, brokers, topic)
+		publisher, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 		if err == nil {
 			t.Error("Expected error for invalid broker, but got none")
 		}
@@ -239,7 +246,7 @@ func TestPublisher_Methods_UnitTests(t *testing.T) {
 		}
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
-				_, err := NewPublisher(ctx, tc.brokers, tc.topic)
+				_, err := NewPublisher(ctx, config.KafkaConfig{Brokers: tc.brokers, Topic: tc.topic})
 				if err == nil {
 					t.Errorf("Expected error for %s, but got none", tc.name)
 				}
@@ -254,7 +261,7 @@ func TestPublisher_Methods_DirectTesting(t *testing.T) {
 		defer cancel()
 		brokers := []string{"localhost:9092"}
 		topic := "test-methods-topic"
-		publisher, err := NewPublisher(ctx, brokers, topic)
+		publisher, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
 		if err == nil {
 			defer publisher.Close()
 			testMessage := []byte("test message")
@@ -320,3 +327,215 @@ func TestPublisher_Methods_WithoutKafka(t *testing.T) {
 		}
 	})
 }
+
+func TestPublisher_PublishBatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	brokers := []string{"localhost:9092"}
+	topic := "test-publish-batch-topic"
+	publisher, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic})
+	if err != nil {
+		t.Logf("Publisher creation test skipped (Kafka not available): %v", err)
+		t.Skip("Kafka not available for testing")
+	}
+	defer publisher.Close()
+	if err := publisher.Health(ctx); err != nil {
+		t.Errorf("Publisher should be healthy: %v", err)
+	}
+	err = publisher.PublishBatch(ctx, []sink.Message{
+		{Key: []byte("user1"), Value: []byte("message 1"), Headers: map[string]string{"event-type": "native"}},
+		{Key: []byte("user2"), Value: []byte("message 2")},
+	})
+	if err != nil {
+		t.Errorf("Failed to publish batch: %v", err)
+	}
+	if err := publisher.Flush(ctx); err != nil {
+		t.Errorf("Failed to flush: %v", err)
+	}
+}
+
+func TestKafkaMessage(t *testing.T) {
+	msg := kafkaMessage(sink.Message{
+		Key:     []byte("user1"),
+		Value:   []byte(`{"a":1}`),
+		Headers: map[string]string{"schema-version": "1", "chain-id": "1", "event-type": "native"},
+	})
+	if string(msg.Key) != "user1" || string(msg.Value) != `{"a":1}` {
+		t.Errorf("unexpected key or value: %q %q", msg.Key, msg.Value)
+	}
+	// sorted, so the same event always has the same headers
+	want := []string{"chain-id", "event-type", "schema-version"}
+	if len(msg.Headers) != len(want) {
+		t.Fatalf("expected %d headers, got %d", len(want), len(msg.Headers))
+	}
+	for i, h := range msg.Headers {
+		if h.Key != want[i] {
+			t.Errorf("header %d: expected %s, got %s", i, want[i], h.Key)
+		}
+	}
+}
+
+func TestPublisher_Async(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	brokers := []string{"localhost:9092"}
+	topic := "test-publish-async-topic"
+	publisher, err := NewPublisher(ctx, config.KafkaConfig{Brokers: brokers, Topic: topic, Async: true, Compression: config.CompressionSnappy})
+	if err != nil {
+		t.Logf("Publisher creation test skipped (Kafka not available): %v", err)
+		t.Skip("Kafka not available for testing")
+	}
+	defer publisher.Close()
+
+	acked := make(chan error, 2)
+	err = publisher.PublishAsync(ctx, []sink.Message{
+		{Key: []byte("user1"), Value: []byte("message 1")},
+		{Key: []byte("user2"), Value: []byte("message 2")},
+	}, func(m sink.Message, err error) { acked <- err })
+	if err != nil {
+		t.Fatalf("Failed to publish async: %v", err)
+	}
+	if err := publisher.Flush(ctx); err != nil {
+		t.Errorf("Failed to flush: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-acked; err != nil {
+			t.Errorf("Message %d failed: %v", i+1, err)
+		}
+	}
+}
+
+func TestPublisher_Flush(t *testing.T) {
+	newDelivery := func() *delivery {
+		return &delivery{done: make(chan struct{})}
+	}
+
+	t.Run("flush_reports_every_message", func(t *testing.T) {
+		p := &Publisher{async: true}
+		d1, d2, d3 := newDelivery(), newDelivery(), newDelivery()
+		var calls []string
+		d2.callback = func(m sink.Message, err error) { calls = append(calls, err.Error()) }
+		p.pending.list = []*delivery{d1, d2, d3}
+
+		go func() {
+			p.complete([]k.Message{{WriterData: d1}, {WriterData: d3}}, nil)
+			p.complete([]k.Message{{WriterData: d2}}, errors.New("broker down"))
+		}()
+		err := p.Flush(context.Background())
+		errs := sink.Errors(err, 3)
+		if errs[0] != nil || errs[1] == nil || errs[2] != nil {
+			t.Errorf("expected only the second message to fail, got %v", errs)
+		}
+		if len(calls) != 1 || calls[0] != "broker down" {
+			t.Errorf("expected the callback with the error, got %v", calls)
+		}
+		if p.Flush(context.Background()) != nil {
+			t.Error("the messages are only reported once")
+		}
+	})
+	t.Run("flush_gives_up_with_the_context", func(t *testing.T) {
+		p := &Publisher{async: true}
+		p.pending.list = []*delivery{newDelivery()}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := p.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the context error, got %v", err)
+		}
+	})
+	t.Run("publish_async_needs_the_async_mode", func(t *testing.T) {
+		p := &Publisher{}
+		if err := p.PublishAsync(context.Background(), nil, nil); !errors.Is(err, errNotAsync) {
+			t.Errorf("expected errNotAsync, got %v", err)
+		}
+	})
+}
+
+// fakeWriter completes the async writes in the background, the messages with the value
+// in fail fail
+type fakeWriter struct {
+	complete func([]k.Message, error)
+	fail     string
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...k.Message) error {
+	go func() {
+		for _, m := range msgs {
+			var err error
+			if string(m.Value) == w.fail {
+				err = errors.New("broker down")
+			}
+			w.complete([]k.Message{m}, err)
+		}
+	}()
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+func TestPublisher_Session(t *testing.T) {
+	newPublisher := func() *Publisher {
+		p := &Publisher{async: true}
+		p.w = &fakeWriter{complete: p.complete, fail: "fail"}
+		return p
+	}
+	ctx := context.Background()
+
+	t.Run("session_flushes_only_its_messages", func(t *testing.T) {
+		p := newPublisher()
+		redelivery := p.Session()
+		if err := p.PublishBatch(ctx, []sink.Message{{Value: []byte("fail")}}); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+		// the redelivery flushes between the publish and the flush of the processor
+		if err := sink.Publish(ctx, redelivery, sink.Message{Value: []byte("ok")}); err != nil {
+			t.Errorf("the session got the error of the publisher: %v", err)
+		}
+		if err := p.Flush(ctx); err == nil {
+			t.Error("the publisher lost the error of its message")
+		}
+	})
+	t.Run("concurrent_publish_and_flush", func(t *testing.T) {
+		p := newPublisher()
+		var wg sync.WaitGroup
+		for _, value := range []string{"ok", "fail"} {
+			s := p.Session()
+			wg.Add(1)
+			go func(value string) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					err := sink.Publish(ctx, s, sink.Message{Value: []byte(value)})
+					if (err != nil) != (value == "fail") {
+						t.Errorf("%s message %d: unexpected result %v", value, i, err)
+						return
+					}
+				}
+			}(value)
+		}
+		wg.Wait()
+	})
+	t.Run("session_does_not_close_the_publisher", func(t *testing.T) {
+		p := newPublisher()
+		if err := p.Session().Close(); err != nil {
+			t.Errorf("Failed to close the session: %v", err)
+		}
+	})
+}
+
+func TestCompression(t *testing.T) {
+	for name, want := range map[string]k.Compression{
+		"":                       0,
+		config.CompressionNone:   0,
+		config.CompressionGzip:   k.Gzip,
+		config.CompressionSnappy: k.Snappy,
+		config.CompressionLz4:    k.Lz4,
+		config.CompressionZstd:   k.Zstd,
+	} {
+		got, err := compression(name)
+		if err != nil || got != want {
+			t.Errorf("%q: expected %v, got %v %v", name, want, got, err)
+		}
+	}
+	if _, err := compression("brotli"); err == nil {
+		t.Error("expected error for an unknown compression")
+	}
+}
@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+)
+
+// writeCert writes a self signed certificate and its key, it works as the CA and as the client cert
+func writeCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "de-crypto"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir)
+
+	t.Run("tls_config_with_ca_and_client_cert", func(t *testing.T) {
+		tlsCfg, err := tlsConfig(config.KafkaTLSConfig{Enabled: true, CAFile: certFile, CertFile: certFile, KeyFile: keyFile})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tlsCfg.RootCAs == nil {
+			t.Error("expected the ca in the root pool")
+		}
+		if len(tlsCfg.Certificates) != 1 {
+			t.Errorf("expected the client certificate, got %d", len(tlsCfg.Certificates))
+		}
+	})
+	t.Run("tls_config_with_system_roots", func(t *testing.T) {
+		tlsCfg, err := tlsConfig(config.KafkaTLSConfig{Enabled: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tlsCfg.RootCAs != nil || len(tlsCfg.Certificates) != 0 {
+			t.Error("expected the system roots and no client certificate")
+		}
+	})
+	t.Run("tls_config_with_invalid_files", func(t *testing.T) {
+		if _, err := tlsConfig(config.KafkaTLSConfig{CAFile: filepath.Join(dir, "missing.pem")}); err == nil {
+			t.Error("expected error for a missing ca")
+		}
+		if _, err := tlsConfig(config.KafkaTLSConfig{CAFile: keyFile}); err == nil {
+			t.Error("expected error for a ca without certificates")
+		}
+		if _, err := tlsConfig(config.KafkaTLSConfig{CertFile: certFile}); err == nil {
+			t.Error("expected error for a client certificate without key")
+		}
+	})
+}
+
+func TestSASLMechanism(t *testing.T) {
+	for mechanism, name := range map[string]string{
+		config.SASLPlain:       "PLAIN",
+		config.SASLScramSHA256: "SCRAM-SHA-256",
+		config.SASLScramSHA512: "SCRAM-SHA-512",
+	} {
+		m, err := saslMechanism(config.KafkaSASLConfig{Mechanism: mechanism, Username: "user", Password: "secret"})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", mechanism, err)
+			continue
+		}
+		if m.Name() != name {
+			t.Errorf("expected %s, got %s", name, m.Name())
+		}
+	}
+
+	if m, err := saslMechanism(config.KafkaSASLConfig{}); m != nil || err != nil {
+		t.Errorf("expected no sasl, got %v %v", m, err)
+	}
+	if _, err := saslMechanism(config.KafkaSASLConfig{Mechanism: "gssapi"}); err == nil {
+		t.Error("expected error for an unknown mechanism")
+	}
+}
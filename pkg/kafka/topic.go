@@ -0,0 +1,191 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	k "github.com/segmentio/kafka-go"
+)
+
+const (
+	configRetention     = "retention.ms"
+	configCleanupPolicy = "cleanup.policy"
+)
+
+// ErrTopicMismatch is returned when the topic exists with other settings than the config,
+// we don't change a topic that is already there
+var ErrTopicMismatch = errors.New("kafka: topic doesn't match the config")
+
+// ensureTopicExists creates the topic when it is missing and checks an existing one, every
+// broker is tried until one answers
+func ensureTopicExists(ctx context.Context, transport *k.Transport, cfg config.KafkaConfig) error {
+	var err error
+	for _, b := range cfg.Brokers {
+		client := &k.Client{Addr: k.TCP(b), Transport: transport, Timeout: config.DefaultRequestTimeout}
+		err = ensureTopic(ctx, client, cfg)
+		if err == nil || errors.Is(err, ErrTopicMismatch) {
+			return err
+		}
+		log.Printf("kafka: broker %s: %v", b, err)
+	}
+	return err
+}
+
+func ensureTopic(ctx context.Context, client *k.Client, cfg config.KafkaConfig) error {
+	topic, err := describeTopic(ctx, client, cfg.Topic)
+	if errors.Is(err, k.UnknownTopicOrPartition) {
+		if err := createTopic(ctx, client, cfg); err != nil {
+			return err
+		}
+		topic, err = waitForLeaders(ctx, client, cfg.Topic)
+	}
+	if err != nil {
+		return err
+	}
+
+	configs := map[string]string{}
+	if cfg.Retention > 0 || cfg.CleanupPolicy != "" {
+		if configs, err = describeConfigs(ctx, client, cfg.Topic); err != nil {
+			return err
+		}
+	}
+	return checkTopic(cfg, topic, configs)
+}
+
+func describeTopic(ctx context.Context, client *k.Client, name string) (k.Topic, error) {
+	resp, err := client.Metadata(ctx, &k.MetadataRequest{Topics: []string{name}})
+	if err != nil {
+		return k.Topic{}, err
+	}
+	for _, t := range resp.Topics {
+		if t.Name == name {
+			return t, t.Error
+		}
+	}
+	return k.Topic{}, k.UnknownTopicOrPartition
+}
+
+func createTopic(ctx context.Context, client *k.Client, cfg config.KafkaConfig) error {
+	topic := k.TopicConfig{
+		Topic:             cfg.Topic,
+		NumPartitions:     cfg.Partitions,
+		ReplicationFactor: cfg.ReplicationFactor,
+	}
+	if topic.NumPartitions <= 0 {
+		topic.NumPartitions = config.DefaultKafkaPartitions
+	}
+	if topic.ReplicationFactor <= 0 {
+		topic.ReplicationFactor = config.DefaultKafkaReplicationFactor
+	}
+	if cfg.Retention > 0 {
+		topic.ConfigEntries = append(topic.ConfigEntries, k.ConfigEntry{ConfigName: configRetention, ConfigValue: strconv.FormatInt(cfg.Retention.Milliseconds(), 10)})
+	}
+	if cfg.CleanupPolicy != "" {
+		topic.ConfigEntries = append(topic.ConfigEntries, k.ConfigEntry{ConfigName: configCleanupPolicy, ConfigValue: cfg.CleanupPolicy})
+	}
+
+	resp, err := client.CreateTopics(ctx, &k.CreateTopicsRequest{Topics: []k.TopicConfig{topic}})
+	if err != nil {
+		return err
+	}
+	// another instance may have created it in the meantime, it is checked like any other
+	if err := resp.Errors[cfg.Topic]; err != nil && !errors.Is(err, k.TopicAlreadyExists) {
+		return err
+	}
+	log.Printf("Successfully created topic: %s", cfg.Topic)
+	return nil
+}
+
+// waitForLeaders waits until every partition of a new topic has a leader, before that
+// the writes fail
+func waitForLeaders(ctx context.Context, client *k.Client, name string) (k.Topic, error) {
+	var err error
+	for attempt := 1; attempt <= 10; attempt++ {
+		var topic k.Topic
+		topic, err = describeTopic(ctx, client, name)
+		if err == nil {
+			for _, p := range topic.Partitions {
+				if p.Error != nil {
+					err = p.Error
+					break
+				}
+			}
+		}
+		if err == nil && len(topic.Partitions) > 0 {
+			return topic, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return k.Topic{}, ctx.Err()
+		case <-time.After(time.Duration(attempt) * 200 * time.Millisecond):
+		}
+	}
+	return k.Topic{}, fmt.Errorf("kafka: topic %s has no leaders: %w", name, err)
+}
+
+func describeConfigs(ctx context.Context, client *k.Client, name string) (map[string]string, error) {
+	resp, err := client.DescribeConfigs(ctx, &k.DescribeConfigsRequest{
+		Resources: []k.DescribeConfigRequestResource{{
+			ResourceType: k.ResourceTypeTopic,
+			ResourceName: name,
+			ConfigNames:  []string{configRetention, configCleanupPolicy},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	configs := map[string]string{}
+	for _, r := range resp.Resources {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		for _, e := range r.ConfigEntries {
+			configs[e.ConfigName] = e.ConfigValue
+		}
+	}
+	return configs, nil
+}
+
+// checkTopic compares the topic with the config, only what is set in the config is checked.
+// The defaults of a new topic are not checked, see createTopic.
+func checkTopic(cfg config.KafkaConfig, topic k.Topic, configs map[string]string) error {
+	var diffs []string
+	if cfg.Partitions > 0 && len(topic.Partitions) != cfg.Partitions {
+		diffs = append(diffs, fmt.Sprintf("%d partitions, want %d", len(topic.Partitions), cfg.Partitions))
+	}
+	if cfg.ReplicationFactor > 0 && len(topic.Partitions) > 0 && len(topic.Partitions[0].Replicas) != cfg.ReplicationFactor {
+		diffs = append(diffs, fmt.Sprintf("replication factor %d, want %d", len(topic.Partitions[0].Replicas), cfg.ReplicationFactor))
+	}
+	if cfg.Retention > 0 {
+		want := strconv.FormatInt(cfg.Retention.Milliseconds(), 10)
+		if got := configs[configRetention]; got != want {
+			diffs = append(diffs, fmt.Sprintf("%s %s, want %s", configRetention, got, want))
+		}
+	}
+	if cfg.CleanupPolicy != "" {
+		if got := configs[configCleanupPolicy]; cleanupPolicy(got) != cleanupPolicy(cfg.CleanupPolicy) {
+			diffs = append(diffs, fmt.Sprintf("%s %s, want %s", configCleanupPolicy, got, cfg.CleanupPolicy))
+		}
+	}
+
+	if len(diffs) > 0 {
+		return fmt.Errorf("%w: %s has %s", ErrTopicMismatch, cfg.Topic, strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// the brokers may list the policies in any order
+func cleanupPolicy(p string) string {
+	policies := strings.Split(strings.ReplaceAll(p, " ", ""), ",")
+	sort.Strings(policies)
+	return strings.Join(policies, ",")
+}
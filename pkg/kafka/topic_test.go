@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	k "github.com/segmentio/kafka-go"
+)
+
+func testTopic(partitions, replicas int) k.Topic {
+	topic := k.Topic{Name: "events"}
+	for i := 0; i < partitions; i++ {
+		topic.Partitions = append(topic.Partitions, k.Partition{ID: i, Replicas: make([]k.Broker, replicas)})
+	}
+	return topic
+}
+
+func TestCheckTopic(t *testing.T) {
+	cfg := config.KafkaConfig{
+		Topic:             "events",
+		Partitions:        6,
+		ReplicationFactor: 3,
+		Retention:         168 * time.Hour,
+		CleanupPolicy:     config.CleanupPolicyCompactDelete,
+	}
+
+	t.Run("check_topic_matching", func(t *testing.T) {
+		configs := map[string]string{"retention.ms": "604800000", "cleanup.policy": "delete,compact"}
+		if err := checkTopic(cfg, testTopic(6, 3), configs); err != nil {
+			t.Errorf("topic should match: %v", err)
+		}
+	})
+	t.Run("check_topic_with_other_settings", func(t *testing.T) {
+		configs := map[string]string{"retention.ms": "86400000", "cleanup.policy": "delete"}
+		err := checkTopic(cfg, testTopic(1, 1), configs)
+		if !errors.Is(err, ErrTopicMismatch) {
+			t.Fatalf("expected ErrTopicMismatch, got %v", err)
+		}
+		for _, diff := range []string{"1 partitions, want 6", "replication factor 1, want 3", "retention.ms 86400000", "cleanup.policy delete"} {
+			if !strings.Contains(err.Error(), diff) {
+				t.Errorf("expected %q in %q", diff, err.Error())
+			}
+		}
+	})
+	t.Run("check_topic_with_the_settings_not_set", func(t *testing.T) {
+		// a managed cluster topic, with the getters of the service and nothing in the env
+		for _, name := range []string{"KAFKA_PARTITIONS", "KAFKA_REPLICATION_FACTOR", "KAFKA_RETENTION", "KAFKA_CLEANUP_POLICY"} {
+			os.Unsetenv(name)
+		}
+		cfg := config.KafkaConfig{
+			Topic:             "events",
+			Partitions:        config.GetKafkaPartitions(),
+			ReplicationFactor: config.GetKafkaReplicationFactor(),
+			Retention:         config.GetKafkaRetention(),
+			CleanupPolicy:     config.GetKafkaCleanupPolicy(),
+		}
+		if err := checkTopic(cfg, testTopic(6, 3), nil); err != nil {
+			t.Errorf("nothing was set, got %v", err)
+		}
+	})
+	t.Run("check_topic_only_what_is_configured", func(t *testing.T) {
+		if err := checkTopic(config.KafkaConfig{Topic: "events"}, testTopic(12, 2), nil); err != nil {
+			t.Errorf("nothing to check, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// the schema types of the registry, avro is the default so it is not sent
+const (
+	TypeAvro     = "AVRO"
+	TypeProtobuf = "PROTOBUF"
+)
+
+var ErrSchemaNotFound = errors.New("schema: not found in the registry")
+
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Registry talks to a Confluent compatible schema registry, the ids are cached
+type Registry struct {
+	url      string
+	client   HTTPClient
+	username string
+	password string
+
+	mu  sync.Mutex
+	ids map[string]int
+}
+
+func NewRegistry(registryURL string, client HTTPClient, username, password string) *Registry {
+	return &Registry{
+		url:      strings.TrimRight(registryURL, "/"),
+		client:   client,
+		username: username,
+		password: password,
+		ids:      make(map[string]int),
+	}
+}
+
+type schemaRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+type schemaResponse struct {
+	ID int `json:"id"`
+}
+
+type registryError struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// Register adds the schema to the subject, the registry returns the id it already has
+// when the schema was registered before
+func (r *Registry) Register(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	return r.schemaID(ctx, "/subjects/"+url.PathEscape(subject)+"/versions", subject, schemaType, schema)
+}
+
+// Lookup returns the id of a schema that was registered before, for when the service
+// can't register them
+func (r *Registry) Lookup(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	return r.schemaID(ctx, "/subjects/"+url.PathEscape(subject), subject, schemaType, schema)
+}
+
+func (r *Registry) schemaID(ctx context.Context, path, subject, schemaType, schema string) (int, error) {
+	if schemaType == TypeAvro {
+		schemaType = ""
+	}
+	key := subject + "\x00" + schemaType + "\x00" + schema
+
+	r.mu.Lock()
+	id, ok := r.ids[key]
+	r.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	body, err := json.Marshal(schemaRequest{Schema: schema, SchemaType: schemaType})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var regErr registryError
+		_ = json.Unmarshal(data, &regErr)
+		if resp.StatusCode == http.StatusNotFound {
+			return 0, fmt.Errorf("%w: %s: %s", ErrSchemaNotFound, subject, regErr.Message)
+		}
+		return 0, fmt.Errorf("schema: registry status %d: %s", resp.StatusCode, regErr.Message)
+	}
+
+	var res schemaResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return 0, fmt.Errorf("schema: unexpected registry response: %w", err)
+	}
+
+	r.mu.Lock()
+	r.ids[key] = res.ID
+	r.mu.Unlock()
+	return res.ID, nil
+}
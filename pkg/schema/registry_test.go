@@ -0,0 +1,124 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRegistry keeps the schemas of every subject like the registry does, the same schema
+// gets the same id
+type fakeRegistry struct {
+	*httptest.Server
+	mu       sync.Mutex
+	ids      map[string]int
+	subjects map[string]map[string]int
+	requests int
+	auth     string
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	f := &fakeRegistry{ids: map[string]int{}, subjects: map[string]map[string]int{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeRegistry) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	f.auth = r.Header.Get("Authorization")
+
+	var req schemaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Schema == "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(registryError{ErrorCode: 42201, Message: "Invalid schema"})
+		return
+	}
+	key := req.SchemaType + req.Schema
+
+	path := strings.TrimPrefix(r.URL.Path, "/subjects/")
+	subject, register := strings.CutSuffix(path, "/versions")
+	if register {
+		if _, ok := f.ids[key]; !ok {
+			f.ids[key] = len(f.ids) + 1
+		}
+		if f.subjects[subject] == nil {
+			f.subjects[subject] = map[string]int{}
+		}
+		f.subjects[subject][key] = f.ids[key]
+		json.NewEncoder(w).Encode(schemaResponse{ID: f.ids[key]})
+		return
+	}
+
+	id, ok := f.subjects[subject][key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(registryError{ErrorCode: 40403, Message: "Schema not found"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"subject": subject, "id": id, "version": 1})
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("registry_registers_and_caches_the_ids", func(t *testing.T) {
+		f := newFakeRegistry(t)
+		r := NewRegistry(f.URL+"/", http.DefaultClient, "", "")
+
+		id, err := r.Register(ctx, "events-value", TypeAvro, `{"type":"string"}`)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, id)
+		id, err = r.Register(ctx, "events-value", TypeProtobuf, `syntax = "proto3";`)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, id)
+
+		id, err = r.Register(ctx, "events-value", TypeAvro, `{"type":"string"}`)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, id)
+		assert.Equal(t, 2, f.requests)
+	})
+
+	t.Run("registry_looks_up_registered_schemas", func(t *testing.T) {
+		f := newFakeRegistry(t)
+		r := NewRegistry(f.URL, http.DefaultClient, "", "")
+
+		_, err := r.Lookup(ctx, "events-value", TypeAvro, `{"type":"string"}`)
+		assert.ErrorIs(t, err, ErrSchemaNotFound)
+
+		registered, err := r.Register(ctx, "events-value", TypeAvro, `{"type":"string"}`)
+		assert.NoError(t, err)
+		// a new client, nothing cached
+		r = NewRegistry(f.URL, http.DefaultClient, "", "")
+		id, err := r.Lookup(ctx, "events-value", TypeAvro, `{"type":"string"}`)
+		assert.NoError(t, err)
+		assert.Equal(t, registered, id)
+	})
+
+	t.Run("registry_errors", func(t *testing.T) {
+		f := newFakeRegistry(t)
+		r := NewRegistry(f.URL, http.DefaultClient, "", "")
+		_, err := r.Register(ctx, "events-value", TypeAvro, "")
+		assert.ErrorContains(t, err, "registry status 422: Invalid schema")
+
+		f.Close()
+		_, err = r.Register(ctx, "events-value", TypeAvro, `{"type":"string"}`)
+		assert.Error(t, err)
+	})
+
+	t.Run("registry_with_basic_auth", func(t *testing.T) {
+		f := newFakeRegistry(t)
+		r := NewRegistry(f.URL, http.DefaultClient, "key", "secret")
+		_, err := r.Register(ctx, "events-value", TypeAvro, `{"type":"string"}`)
+		assert.NoError(t, err)
+		assert.Equal(t, "Basic a2V5OnNlY3JldA==", f.auth)
+	})
+}
@@ -0,0 +1,83 @@
+package schema
+
+import "encoding/binary"
+
+// Frame prefixes the payload with the Confluent wire format, a zero magic byte and the
+// schema id, so the consumers find the schema in the registry
+func Frame(schemaID int, payload []byte) []byte {
+	b := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(b[1:], uint32(schemaID))
+	return append(b, payload...)
+}
+
+// FrameProtobuf also has the index of the message in the .proto file, a single 0 for the first one
+func FrameProtobuf(schemaID int, payload []byte) []byte {
+	b := make([]byte, 6, 6+len(payload))
+	binary.BigEndian.PutUint32(b[1:], uint32(schemaID))
+	return append(b, payload...)
+}
+
+// Proto writes the protobuf wire format, proto3 style: the zero values are not written
+type Proto struct {
+	buf []byte
+}
+
+func (p *Proto) String(field int, v string) {
+	if v == "" {
+		return
+	}
+	p.tag(field, 2)
+	p.buf = binary.AppendUvarint(p.buf, uint64(len(v)))
+	p.buf = append(p.buf, v...)
+}
+
+func (p *Proto) Uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, 0)
+	p.buf = binary.AppendUvarint(p.buf, v)
+}
+
+func (p *Proto) Bool(field int, v bool) {
+	if !v {
+		return
+	}
+	p.tag(field, 0)
+	p.buf = append(p.buf, 1)
+}
+
+func (p *Proto) Bytes() []byte {
+	return p.buf
+}
+
+func (p *Proto) tag(field int, wireType uint64) {
+	p.buf = binary.AppendUvarint(p.buf, uint64(field)<<3|wireType)
+}
+
+// Avro writes the avro binary encoding, the fields go in the order of the schema
+type Avro struct {
+	buf []byte
+}
+
+func (a *Avro) String(v string) {
+	a.Long(int64(len(v)))
+	a.buf = append(a.buf, v...)
+}
+
+// Long is zigzag encoded
+func (a *Avro) Long(v int64) {
+	a.buf = binary.AppendVarint(a.buf, v)
+}
+
+func (a *Avro) Boolean(v bool) {
+	if v {
+		a.buf = append(a.buf, 1)
+		return
+	}
+	a.buf = append(a.buf, 0)
+}
+
+func (a *Avro) Bytes() []byte {
+	return a.buf
+}
@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrame(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 0, 1, 0x2c, 'a'}, Frame(300, []byte("a")))
+	assert.Equal(t, []byte{0, 0, 0, 1, 0x2c, 0, 'a'}, FrameProtobuf(300, []byte("a")))
+}
+
+func TestProto(t *testing.T) {
+	var p Proto
+	p.String(1, "testing")
+	p.String(2, "")
+	p.Uint64(3, 150)
+	p.Uint64(4, 0)
+	p.Bool(5, true)
+	p.Bool(6, false)
+	p.String(21, "a")
+
+	// the examples of the protobuf encoding docs
+	want := []byte{0x0a, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g', 0x18, 0x96, 0x01, 0x28, 0x01, 0xaa, 0x01, 0x01, 'a'}
+	assert.Equal(t, want, p.Bytes())
+}
+
+func TestAvro(t *testing.T) {
+	var a Avro
+	a.String("foo")
+	a.String("")
+	a.Long(1)
+	a.Long(-64)
+	a.Long(64)
+	a.Boolean(true)
+	a.Boolean(false)
+
+	// the examples of the avro spec
+	want := []byte{0x06, 'f', 'o', 'o', 0x00, 0x02, 0x7f, 0x80, 0x01, 0x01, 0x00}
+	assert.Equal(t, want, a.Bytes())
+}
@@ -0,0 +1,90 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrClosed = errors.New("sink: closed")
+
+// Message is an event to publish, the key and the headers are metadata for the sinks
+// that have them, like the kafka partition key
+type Message struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// Sink is where the events go. A message is only delivered after PublishBatch and Flush
+// returned without errors, the sink processor acks the blocks after that.
+type Sink interface {
+	// PublishBatch sends the messages, when only some of them fail the error is a BatchError.
+	// An async sink returns before the messages are delivered.
+	PublishBatch(ctx context.Context, msgs []Message) error
+	// Flush waits until the messages published since the last flush are delivered, a
+	// BatchError has them in the order they were published, without the ones PublishBatch
+	// already failed
+	Flush(ctx context.Context) error
+	Close() error
+	// Health says if the sink can take messages now
+	Health(ctx context.Context) error
+}
+
+// Sessions is a sink shared by goroutines that publish and flush on their own, a session
+// only flushes the messages it published
+type Sessions interface {
+	Session() Sink
+}
+
+// Session returns a new session of the sink when it has them. The sinks without sessions
+// deliver everything on every flush, so they can be shared as they are.
+func Session(s Sink) Sink {
+	if sessions, ok := s.(Sessions); ok {
+		return sessions.Session()
+	}
+	return s
+}
+
+// BatchError has the error of every message of the batch, nil for the ones delivered
+type BatchError []error
+
+func (e BatchError) Error() string {
+	failed := 0
+	var first error
+	for _, err := range e {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	return fmt.Sprintf("sink: %d of %d messages failed: %v", failed, len(e), first)
+}
+
+// Errors returns the error of every message, the same error for all of them
+// when the whole batch failed
+func Errors(err error, n int) []error {
+	errs := make([]error, n)
+	if err == nil {
+		return errs
+	}
+	var batchErr BatchError
+	if errors.As(err, &batchErr) && len(batchErr) == n {
+		copy(errs, batchErr)
+		return errs
+	}
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Publish sends one message and flushes it
+func Publish(ctx context.Context, s Sink, msg Message) error {
+	if err := s.PublishBatch(ctx, []Message{msg}); err != nil {
+		return err
+	}
+	return s.Flush(ctx)
+}
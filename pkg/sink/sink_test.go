@@ -0,0 +1,51 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors(t *testing.T) {
+	errDown := errors.New("down")
+
+	t.Run("errors_without_error", func(t *testing.T) {
+		assert.Equal(t, []error{nil, nil}, Errors(nil, 2))
+	})
+	t.Run("errors_whole_batch_failed", func(t *testing.T) {
+		assert.Equal(t, []error{errDown, errDown}, Errors(errDown, 2))
+	})
+	t.Run("errors_partial_failure", func(t *testing.T) {
+		err := BatchError{nil, errDown}
+		assert.Equal(t, []error{nil, errDown}, Errors(err, 2))
+		assert.Contains(t, err.Error(), "1 of 2 messages failed")
+	})
+}
+
+func TestPublish(t *testing.T) {
+	s := NewWriterSink(&failingWriter{})
+	assert.Error(t, Publish(context.Background(), s, Message{Value: []byte(`{}`)}))
+}
+
+func TestSession(t *testing.T) {
+	t.Run("session_of_a_sink_without_sessions", func(t *testing.T) {
+		s := NewStdout()
+		assert.Same(t, s, Session(s))
+	})
+	t.Run("session_of_a_sink_with_sessions", func(t *testing.T) {
+		s := &sessionSink{Sink: NewStdout()}
+		assert.NotSame(t, s, Session(s))
+	})
+}
+
+type sessionSink struct{ Sink }
+
+func (s *sessionSink) Session() Sink { return &sessionSink{Sink: s.Sink} }
+
+type failingWriter struct{}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
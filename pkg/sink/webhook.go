@@ -0,0 +1,272 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/jmsilvadev/de-crypto/pkg/dlq"
+)
+
+const (
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// errPermanent is a response that will not change if we send it again, like a 400
+var errPermanent = errors.New("webhook: permanent failure")
+
+type webhookEndpoint struct {
+	url string
+	// limits the requests in flight to the endpoint
+	sem chan struct{}
+	// the deliveries that failed all the attempts
+	parked *dlq.Queue
+}
+
+// WebhookSink posts the events to every endpoint, signed with HMAC-SHA256. A delivery is
+// retried with backoff and parked on disk when it keeps failing, so a broken endpoint
+// doesn't hold the others. The batch only fails when a delivery couldn't be parked.
+type WebhookSink struct {
+	client    *http.Client
+	cfg       config.WebhookConfig
+	endpoints []*webhookEndpoint
+}
+
+var _ Sink = &WebhookSink{}
+
+func NewWebhookSink(client *http.Client, cfg config.WebhookConfig) (*WebhookSink, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("webhook: missing urls")
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+
+	s := &WebhookSink{client: client, cfg: cfg}
+	for _, u := range cfg.URLs {
+		// one park queue per endpoint, named by the hash of the url
+		sum := sha256.Sum256([]byte(u))
+		parked, err := dlq.Open(filepath.Join(cfg.ParkDir, hex.EncodeToString(sum[:8])), config.DefaultDLQSegmentSize)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.endpoints = append(s.endpoints, &webhookEndpoint{url: u, sem: make(chan struct{}, cfg.Concurrency), parked: parked})
+	}
+	return s, nil
+}
+
+// PublishBatch delivers the messages to all the endpoints, in batch mode the whole
+// batch goes in one request as a json array
+func (s *WebhookSink) PublishBatch(ctx context.Context, msgs []Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	reqs := make([]Message, len(msgs))
+	for i, m := range msgs {
+		reqs[i] = Message{Value: m.Value, Headers: map[string]string{"content-type": contentType(m)}}
+	}
+	if s.cfg.Batch {
+		bodies := make([][]byte, len(msgs))
+		for i, m := range msgs {
+			bodies[i] = m.Value
+		}
+		ct := "application/json"
+		if contentType(msgs[0]) == "application/cloudevents+json" {
+			ct = "application/cloudevents-batch+json"
+		}
+		reqs = []Message{{Value: jsonArray(bodies), Headers: map[string]string{"content-type": ct}}}
+	}
+
+	errs := make([]error, len(reqs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, e := range s.endpoints {
+		for i, req := range reqs {
+			wg.Add(1)
+			go func(e *webhookEndpoint, i int, req Message) {
+				defer wg.Done()
+				if err := s.deliver(ctx, e, req); err != nil {
+					mu.Lock()
+					errs[i] = err
+					mu.Unlock()
+				}
+			}(e, i, req)
+		}
+	}
+	wg.Wait()
+
+	if s.cfg.Batch {
+		return errs[0]
+	}
+	for _, err := range errs {
+		if err != nil {
+			return BatchError(errs)
+		}
+	}
+	return nil
+}
+
+// deliver sends the body until it works, it returns an error only when the
+// delivery failed and couldn't be parked
+func (s *WebhookSink) deliver(ctx context.Context, e *webhookEndpoint, req Message) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case e.sem <- struct{}{}:
+	}
+	defer func() { <-e.sem }()
+
+	var err error
+	for attempt := 0; attempt < s.cfg.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.backoff(attempt - 1)):
+			}
+		}
+
+		err = s.post(ctx, e.url, req.Value, req.Headers["content-type"])
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			// we are shutting down, the sink processor keeps it
+			return ctx.Err()
+		}
+		if errors.Is(err, errPermanent) {
+			break
+		}
+	}
+
+	log.Printf("webhook: delivery to %s parked: %v", e.url, err)
+	if perr := e.parked.Append(dlq.Record{Message: req.Value, Headers: req.Headers, Error: err.Error()}); perr != nil {
+		return fmt.Errorf("webhook: parking delivery to %s: %w", e.url, perr)
+	}
+	return nil
+}
+
+func (s *WebhookSink) post(ctx context.Context, url string, body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.cfg.Secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(HeaderTimestamp, ts)
+		req.Header.Set(HeaderSignature, "sha256="+Sign(s.cfg.Secret, ts, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		return fmt.Errorf("webhook: http status %d", resp.StatusCode)
+	}
+	return fmt.Errorf("%w: http status %d", errPermanent, resp.StatusCode)
+}
+
+func (s *WebhookSink) backoff(attempt int) time.Duration {
+	d := s.cfg.RetryBaseDelay << attempt
+	if d <= 0 || d > s.cfg.RetryMaxDelay {
+		return s.cfg.RetryMaxDelay
+	}
+	return d
+}
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.body", the receivers check it with the
+// same secret and reject old timestamps so a captured request can't be replayed
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// the deliveries are synchronous, there is nothing buffered
+func (s *WebhookSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+// Health checks that every endpoint answers, any status is fine
+func (s *WebhookSink) Health(ctx context.Context) error {
+	for _, e := range s.endpoints {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, e.url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// Parked returns how many deliveries are parked for every endpoint
+func (s *WebhookSink) Parked() map[string]int {
+	parked := make(map[string]int, len(s.endpoints))
+	for _, e := range s.endpoints {
+		parked[e.url] = e.parked.Len()
+	}
+	return parked
+}
+
+func (s *WebhookSink) Close() error {
+	var err error
+	for _, e := range s.endpoints {
+		if cerr := e.parked.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func jsonArray(msgs [][]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, m := range msgs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(m)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+// the content type of the message, json when it doesn't say
+func contentType(m Message) string {
+	if ct := m.Headers["content-type"]; ct != "" {
+		return ct
+	}
+	return "application/json"
+}
@@ -0,0 +1,201 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmsilvadev/de-crypto/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// webhookServer records the bodies it gets and answers with the status of the handler
+type webhookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	bodies   []string
+	calls    atomic.Int32
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+}
+
+func newWebhookServer(t *testing.T, status func(call int32) int, delay time.Duration) *webhookServer {
+	w := &webhookServer{}
+	w.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		n := w.inFlight.Add(1)
+		defer w.inFlight.Add(-1)
+		for {
+			m := w.maxSeen.Load()
+			if n <= m || w.maxSeen.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+
+		body, _ := io.ReadAll(r.Body)
+		call := w.calls.Add(1)
+		code := status(call)
+		if code < 300 {
+			w.mu.Lock()
+			w.bodies = append(w.bodies, string(body))
+			w.mu.Unlock()
+		}
+		rw.WriteHeader(code)
+	}))
+	t.Cleanup(w.Close)
+	return w
+}
+
+func ok(int32) int { return http.StatusOK }
+
+func newTestWebhookSink(t *testing.T, urls ...string) *WebhookSink {
+	s, err := NewWebhookSink(http.DefaultClient, config.WebhookConfig{
+		URLs:           urls,
+		Secret:         "s3cr3t",
+		Concurrency:    4,
+		MaxAttempts:    3,
+		RetryBaseDelay: time.Millisecond,
+		RetryMaxDelay:  5 * time.Millisecond,
+		ParkDir:        t.TempDir(),
+	})
+	assert.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestWebhookSink(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("webhook_sink_signs_the_body", func(t *testing.T) {
+		headers := make(chan http.Header, 1)
+		bodies := make(chan []byte, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			headers <- r.Header
+			bodies <- b
+		}))
+		defer srv.Close()
+
+		s := newTestWebhookSink(t, srv.URL)
+		assert.NoError(t, s.PublishBatch(ctx, []Message{{Value: []byte(`{"a":1}`)}}))
+
+		h, body := <-headers, <-bodies
+		assert.Equal(t, `{"a":1}`, string(body))
+		assert.Equal(t, "application/json", h.Get("Content-Type"))
+		ts := h.Get(HeaderTimestamp)
+		assert.NotEmpty(t, ts)
+		assert.Equal(t, "sha256="+Sign("s3cr3t", ts, body), h.Get(HeaderSignature))
+
+		msg := Message{Value: []byte{0x0a, 0x01, 'a'}, Headers: map[string]string{"content-type": "application/x-protobuf"}}
+		assert.NoError(t, s.PublishBatch(ctx, []Message{msg}))
+		h, body = <-headers, <-bodies
+		assert.Equal(t, msg.Value, body)
+		assert.Equal(t, "application/x-protobuf", h.Get("Content-Type"))
+	})
+
+	t.Run("webhook_sink_single_and_batched", func(t *testing.T) {
+		srv := newWebhookServer(t, ok, 0)
+		s := newTestWebhookSink(t, srv.URL)
+
+		assert.NoError(t, s.PublishBatch(ctx, []Message{{Value: []byte(`{"a":1}`)}, {Value: []byte(`{"a":2}`)}}))
+		assert.Equal(t, int32(2), srv.calls.Load())
+
+		s.cfg.Batch = true
+		assert.NoError(t, s.PublishBatch(ctx, []Message{{Value: []byte(`{"a":1}`)}, {Value: []byte(`{"a":2}`)}}))
+		assert.Equal(t, int32(3), srv.calls.Load())
+		assert.Contains(t, srv.bodies, `[{"a":1},{"a":2}]`)
+	})
+
+	t.Run("webhook_sink_cloud_events_batch", func(t *testing.T) {
+		contentTypes := make(chan string, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			contentTypes <- r.Header.Get("Content-Type")
+		}))
+		defer srv.Close()
+
+		s := newTestWebhookSink(t, srv.URL)
+		s.cfg.Batch = true
+		ce := map[string]string{"content-type": "application/cloudevents+json"}
+		assert.NoError(t, s.PublishBatch(ctx, []Message{{Value: []byte(`{"id":"1"}`), Headers: ce}}))
+		assert.Equal(t, "application/cloudevents-batch+json", <-contentTypes)
+	})
+
+	t.Run("webhook_sink_retries_server_errors", func(t *testing.T) {
+		srv := newWebhookServer(t, func(call int32) int {
+			if call < 3 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusOK
+		}, 0)
+		s := newTestWebhookSink(t, srv.URL)
+
+		assert.NoError(t, s.PublishBatch(ctx, []Message{{Value: []byte(`{"a":1}`)}}))
+		assert.Equal(t, int32(3), srv.calls.Load())
+		assert.Equal(t, 0, s.Parked()[srv.URL])
+	})
+
+	t.Run("webhook_sink_parks_failing_deliveries", func(t *testing.T) {
+		down := newWebhookServer(t, func(int32) int { return http.StatusInternalServerError }, 0)
+		rejects := newWebhookServer(t, func(int32) int { return http.StatusBadRequest }, 0)
+		up := newWebhookServer(t, ok, 0)
+		s := newTestWebhookSink(t, down.URL, rejects.URL, up.URL)
+
+		// a broken endpoint doesn't fail the batch for the others
+		assert.NoError(t, s.PublishBatch(ctx, []Message{{Value: []byte(`{"a":1}`)}}))
+		assert.Equal(t, int32(3), down.calls.Load())
+		// a 400 will never work, no retries
+		assert.Equal(t, int32(1), rejects.calls.Load())
+		assert.Equal(t, []string{`{"a":1}`}, up.bodies)
+
+		parked := s.Parked()
+		assert.Equal(t, 1, parked[down.URL])
+		assert.Equal(t, 1, parked[rejects.URL])
+		assert.Equal(t, 0, parked[up.URL])
+	})
+
+	t.Run("webhook_sink_concurrency_per_endpoint", func(t *testing.T) {
+		srv := newWebhookServer(t, ok, 20*time.Millisecond)
+		s := newTestWebhookSink(t, srv.URL)
+		s.endpoints[0].sem = make(chan struct{}, 2)
+
+		msgs := make([]Message, 8)
+		for i := range msgs {
+			msgs[i] = Message{Value: []byte(`{}`)}
+		}
+		assert.NoError(t, s.PublishBatch(ctx, msgs))
+		assert.Equal(t, int32(8), srv.calls.Load())
+		assert.LessOrEqual(t, srv.maxSeen.Load(), int32(2))
+	})
+
+	t.Run("webhook_sink_does_not_park_on_shutdown", func(t *testing.T) {
+		srv := newWebhookServer(t, func(int32) int { return http.StatusServiceUnavailable }, 0)
+		s := newTestWebhookSink(t, srv.URL)
+		s.cfg.RetryBaseDelay, s.cfg.RetryMaxDelay = time.Second, time.Second
+
+		cancelCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		err := s.PublishBatch(cancelCtx, []Message{{Value: []byte(`{"a":1}`)}})
+		assert.Error(t, err)
+		assert.ErrorIs(t, Errors(err, 1)[0], context.DeadlineExceeded)
+		assert.Equal(t, 0, s.Parked()[srv.URL])
+	})
+
+	t.Run("webhook_sink_health", func(t *testing.T) {
+		srv := newWebhookServer(t, ok, 0)
+		s := newTestWebhookSink(t, srv.URL)
+		assert.NoError(t, s.Health(ctx))
+
+		srv.Close()
+		assert.Error(t, s.Health(ctx))
+	})
+
+	t.Run("webhook_sink_without_urls", func(t *testing.T) {
+		_, err := NewWebhookSink(http.DefaultClient, config.WebhookConfig{})
+		assert.Error(t, err)
+	})
+}
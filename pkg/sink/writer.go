@@ -0,0 +1,104 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriterSink writes the messages as json lines, one message per line
+type WriterSink struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+	// for the files we sync on flush, so the flushed messages survive a crash
+	file   *os.File
+	closed bool
+}
+
+var _ Sink = &WriterSink{}
+
+// NewStdout prints the messages, useful to run locally without a broker
+func NewStdout() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: bufio.NewWriter(w)}
+}
+
+// NewFileSink appends the messages to a json lines file
+func NewFileSink(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterSink{w: bufio.NewWriter(f), file: f}, nil
+}
+
+// PublishBatch writes only the values, the key and the headers are in the event
+func (s *WriterSink) PublishBatch(ctx context.Context, msgs []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	for _, m := range msgs {
+		if _, err := s.w.Write(m.Value); err != nil {
+			return err
+		}
+		if err := s.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *WriterSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.file != nil {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+func (s *WriterSink) Health(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if s.file != nil {
+		_, err := s.file.Stat()
+		return err
+	}
+	return nil
+}
+
+func (s *WriterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	err := s.w.Flush()
+	if s.file != nil {
+		if cerr := s.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterSink(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("writer_sink_writes_json_lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		s := NewWriterSink(&buf)
+
+		assert.NoError(t, s.PublishBatch(ctx, []Message{{Value: []byte(`{"a":1}`)}, {Value: []byte(`{"a":2}`)}}))
+		// buffered until the flush
+		assert.Empty(t, buf.String())
+		assert.NoError(t, s.Flush(ctx))
+		assert.Equal(t, "{\"a\":1}\n{\"a\":2}\n", buf.String())
+		assert.NoError(t, s.Health(ctx))
+	})
+
+	t.Run("file_sink_appends", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "events.jsonl")
+		s, err := NewFileSink(path)
+		assert.NoError(t, err)
+		assert.NoError(t, Publish(ctx, s, Message{Value: []byte(`{"a":1}`)}))
+		assert.NoError(t, s.Close())
+
+		s, err = NewFileSink(path)
+		assert.NoError(t, err)
+		assert.NoError(t, Publish(ctx, s, Message{Value: []byte(`{"a":2}`)}))
+		assert.NoError(t, s.Health(ctx))
+		assert.NoError(t, s.Close())
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "{\"a\":1}\n{\"a\":2}\n", string(data))
+	})
+
+	t.Run("file_sink_invalid_path", func(t *testing.T) {
+		_, err := NewFileSink(filepath.Join(t.TempDir(), "missing", "events.jsonl"))
+		assert.Error(t, err)
+	})
+
+	t.Run("writer_sink_closed", func(t *testing.T) {
+		s := NewWriterSink(&bytes.Buffer{})
+		assert.NoError(t, s.Close())
+		assert.NoError(t, s.Close())
+		assert.ErrorIs(t, s.PublishBatch(ctx, []Message{{Value: []byte(`{}`)}}), ErrClosed)
+		assert.ErrorIs(t, s.Flush(ctx), ErrClosed)
+		assert.ErrorIs(t, s.Health(ctx), ErrClosed)
+	})
+}